@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// planResolutions records the proposed resolutions of a dry run, with the
+// diff from upstream of every resolved file
+func planResolutions(ctx context.Context, cfg *config.Config, services *Services, conflicts []interfaces.GitConflict) {
+	if services.Plan == nil {
+		return
+	}
+
+	log := logrus.WithField("component", "dry-run")
+	internalDir := fmt.Sprintf("%s/internal", cfg.ActualWorkingDir)
+	upstreamBranch := fmt.Sprintf("upstream/%s", cfg.Git.Branch)
+
+	diffs := map[string]string{}
+	for _, file := range reviewedFiles(conflicts) {
+		diff, err := services.Git.Diff(ctx, internalDir, upstreamBranch, "HEAD", []string{file})
+		if err != nil {
+			log.WithError(err).WithField("file", file).Warn("Failed to diff resolved file")
+			continue
+		}
+		diffs[file] = diff
+	}
+
+	services.Plan.SetResolutions(conflicts, diffs)
+}
+
+// writePlan writes the report of a dry run to the report directory
+func writePlan(cfg *config.Config, services *Services) {
+	if services.Plan == nil {
+		return
+	}
+
+	log := logrus.WithField("component", "dry-run")
+	path, err := services.Plan.Write(cfg.ReportDir)
+	if err != nil {
+		log.WithError(err).Error("Failed to write dry run report")
+		return
+	}
+	log.WithField("report", path).Info("Dry run report written")
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -12,12 +14,18 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/BlindspotSoftware/rebAIser/internal/ai"
+	"github.com/BlindspotSoftware/rebAIser/internal/calendar"
 	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/dryrun"
 	"github.com/BlindspotSoftware/rebAIser/internal/git"
 	"github.com/BlindspotSoftware/rebAIser/internal/github"
 	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/markers"
+	"github.com/BlindspotSoftware/rebAIser/internal/memory"
 	"github.com/BlindspotSoftware/rebAIser/internal/notify"
 	"github.com/BlindspotSoftware/rebAIser/internal/test"
+	"github.com/BlindspotSoftware/rebAIser/internal/usage"
+	"github.com/BlindspotSoftware/rebAIser/internal/validate"
 	"strings"
 )
 
@@ -27,6 +35,7 @@ var CLI struct {
 	DryRun       bool   `short:"d" help:"Dry run mode - don't make actual changes"`
 	RunOnce      bool   `short:"o" help:"Run once and exit (don't run periodically)"`
 	KeepArtifacts bool   `short:"k" help:"Keep temporary working directory artifacts (don't cleanup)"`
+	Force        bool   `short:"f" help:"Rebase even if upstream and internal did not move since the last rebase"`
 	Version      bool   `short:"v" help:"Show version information"`
 }
 
@@ -61,6 +70,7 @@ func main() {
 		cfg.DryRun = true
 	}
 	cfg.KeepArtifacts = CLI.KeepArtifacts
+	cfg.Force = CLI.Force
 
 	// Create context for graceful shutdown
 	appCtx, cancel := context.WithCancel(context.Background())
@@ -105,10 +115,14 @@ func runRebaser(ctx context.Context, cfg *config.Config) error {
 
 	log.WithField("interval", cfg.Interval).Info("Starting rebaser with configured interval")
 
-	// Run initial rebase
-	if err := performRebase(ctx, cfg, services); err != nil {
-		log.WithError(err).Error("Initial rebase failed")
+	// Run initial rebase. --force only applies to it, the scheduled runs
+	// skip again if nothing moved.
+	if !outsideWorkingHours(cfg, services, time.Now()) {
+		if err := performRebase(ctx, cfg, services); err != nil {
+			log.WithError(err).Error("Initial rebase failed")
+		}
 	}
+	cfg.Force = false
 
 	// Run periodic rebases
 	for {
@@ -116,7 +130,10 @@ func runRebaser(ctx context.Context, cfg *config.Config) error {
 		case <-ctx.Done():
 			log.Info("Shutting down rebaser")
 			return nil
-		case <-ticker.C:
+		case now := <-ticker.C:
+			if outsideWorkingHours(cfg, services, now) {
+				continue
+			}
 			if err := performRebase(ctx, cfg, services); err != nil {
 				log.WithError(err).Error("Periodic rebase failed")
 			}
@@ -130,6 +147,25 @@ type Services struct {
 	GitHub interfaces.GitHubService
 	Notify interfaces.NotifyService
 	Test   interfaces.TestService
+	// Usage records the AI usage of the current run
+	Usage *usage.Ledger
+	// Memory holds past resolutions, nil if the memory is disabled
+	Memory *memory.Store
+	// Plan records what a dry run would have done, nil unless dry running
+	Plan *dryrun.Plan
+	// Calendar knows the working hours, nil if every hour is one
+	Calendar *calendar.Calendar
+}
+
+// outsideWorkingHours reports if a scheduled run is to be skipped because it
+// is outside working hours
+func outsideWorkingHours(cfg *config.Config, services *Services, now time.Time) bool {
+	if !cfg.Calendar.WorkingHoursOnly || services.Calendar.IsWorkingTime(now) {
+		return false
+	}
+
+	logrus.WithField("component", "rebaser").Info("Outside working hours, skipping scheduled rebase")
+	return true
 }
 
 func initializeServices(cfg *config.Config) (*Services, error) {
@@ -149,41 +185,122 @@ func initializeServices(cfg *config.Config) (*Services, error) {
 		}
 	}
 
-	// Auto-detect provider and get the appropriate API key
-	var provider, apiKey string
-	usingOpenRouter := cfg.AI.OpenRouterAPIKey != ""
-	usingOpenAI := cfg.AI.OpenAIAPIKey != ""
-	
-	if usingOpenRouter && usingOpenAI {
-		log.Warn("Both OpenAI and OpenRouter API keys are set. Using OpenRouter by default.")
-		provider = "openrouter"
-		apiKey = cfg.AI.OpenRouterAPIKey
-	} else if usingOpenRouter {
-		provider = "openrouter"
-		apiKey = cfg.AI.OpenRouterAPIKey
-	} else if usingOpenAI {
-		provider = "openai"
-		apiKey = cfg.AI.OpenAIAPIKey
-	} else {
-		return nil, fmt.Errorf("no AI API key provided. Set either OPENAI_API_KEY or OPENROUTER_API_KEY environment variable")
+	apiKey := cfg.AI.APIKey()
+	if apiKey == "" && cfg.AI.Provider != config.ProviderLocal {
+		return nil, fmt.Errorf("no API key provided for AI provider %s. Set %s or choose another ai.provider", cfg.AI.Provider, config.ProviderAPIKeyEnv(cfg.AI.Provider))
+	}
+
+	operations, err := aiOperations(cfg.AI)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]usage.Price, len(cfg.AI.Prices))
+	for model, price := range cfg.AI.Prices {
+		prices[model] = usage.Price{Input: price.Input, Output: price.Output, CacheRead: price.CacheRead, CacheWrite: price.CacheWrite}
+	}
+	ledger := usage.NewLedger(prices, usage.Limits{
+		MaxCost:   cfg.AI.MaxCostPerRun,
+		MaxTokens: cfg.AI.MaxTokensPerRun,
+	})
+
+	var workCalendar *calendar.Calendar
+	if cfg.Calendar.Enabled {
+		opts := cfg.Calendar.Options()
+		if cfg.Calendar.HolidaysFile != "" {
+			opts.Holidays, err = calendar.ReadHolidays(cfg.Calendar.HolidaysFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		workCalendar, err = calendar.New(opts)
+		if err != nil {
+			return nil, fmt.Errorf("calendar: %w", err)
+		}
+	}
+
+	var store *memory.Store
+	if cfg.AI.Memory.Enabled {
+		store, err = memory.Open(filepath.Join(cfg.StateDir, "resolutions.json"))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	services := &Services{
 		Git:    git.NewService(),
-		AI:     ai.NewService(provider, apiKey, cfg.AI.BaseURL, cfg.AI.Model, cfg.AI.MaxTokens),
+		AI: ai.New(ai.Options{
+			Provider:      cfg.AI.Provider,
+			APIKey:        apiKey,
+			BaseURL:       cfg.AI.BaseURL,
+			Model:         cfg.AI.Model,
+			MaxTokens:     cfg.AI.MaxTokens,
+			ContextWindow: cfg.AI.ContextWindow,
+			Timeout:       cfg.AI.Timeout,
+			Operations:    operations,
+			Ledger:        ledger,
+			Voting: ai.Voting{
+				Samples:       cfg.AI.Voting.Samples,
+				ConflictTypes: cfg.AI.Voting.ConflictTypes,
+				Patterns:      cfg.AI.Voting.Patterns,
+				Judge:         cfg.AI.Voting.OnDisagreement == config.DisagreementJudge,
+			},
+			Memory:   store,
+			Examples: cfg.AI.Memory.Examples,
+		}),
 		GitHub: github.NewService(cfg.GitHub.Token, cfg.GitHub.Owner, cfg.GitHub.Repo),
 		Notify: notify.NewService(cfg.Slack.WebhookURL, cfg.Slack.Channel, cfg.Slack.Username),
 		Test:   test.NewService(testCommands),
+		Usage:  ledger,
+		Memory: store,
+
+		Calendar: workCalendar,
+	}
+
+	// Dry runs record every change outside the working directory instead
+	// of making it
+	if cfg.DryRun {
+		log.Info("Dry run mode, nothing will be pushed, opened or sent")
+		services.Plan = dryrun.NewPlan()
+		services.Git = dryrun.NewGitService(services.Git, services.Plan)
+		services.GitHub = dryrun.NewGitHubService(services.GitHub, services.Plan)
+		services.Notify = dryrun.NewNotifyService(services.Plan)
 	}
 
 	log.Info("Services initialized successfully")
 	return services, nil
 }
 
+// aiOperations returns the model chains of the AI operations with the API
+// keys of their providers
+func aiOperations(cfg config.AIConfig) (map[string][]ai.Model, error) {
+	operations := make(map[string][]ai.Model)
+	for operation, models := range cfg.Operations {
+		for _, model := range models {
+			apiKey := cfg.ProviderAPIKey(model.Provider)
+			if apiKey == "" && model.Provider != config.ProviderLocal {
+				return nil, fmt.Errorf("no API key provided for AI provider %s used by %s. Set %s", model.Provider, operation, config.ProviderAPIKeyEnv(model.Provider))
+			}
+
+			operations[operation] = append(operations[operation], ai.Model{
+				Provider: model.Provider,
+				APIKey:   apiKey,
+				BaseURL:  model.BaseURL,
+				Model:    model.Model,
+			})
+		}
+	}
+	return operations, nil
+}
+
 func performRebase(ctx context.Context, cfg *config.Config, services *Services) error {
 	log := logrus.WithField("component", "rebase")
 	log.Info("Starting rebase operation")
 
+	// Every run starts with a fresh usage budget
+	services.Usage.Reset()
+	defer logUsageSummary(services.Usage)
+
 	// Ensure cleanup runs regardless of success or failure
 	defer func() {
 		if err := cleanupWorkingDirectory(cfg); err != nil {
@@ -191,44 +308,70 @@ func performRebase(ctx context.Context, cfg *config.Config, services *Services)
 		}
 	}()
 
+	// Dry runs report what they would have done, also when they fail
+	branchName := fmt.Sprintf("%s%d", rebaseBranchPrefix, time.Now().Unix())
+	services.Plan.Reset(branchName)
+	defer writePlan(cfg, services)
+
+	// Merge the rebase PRs of earlier runs that are due
+	mergeRebasePRs(ctx, cfg, services)
+
+	// Skip the rebase if neither repository moved since the last one
+	heads, unchanged := nothingToRebase(ctx, cfg, services)
+	if unchanged {
+		return nil
+	}
+
 	// Phase 1: Setup and Git Operations
 	if err := setupWorkingDirectory(ctx, cfg, services); err != nil {
 		sendErrorNotification(ctx, services, "AI Rebaser - Setup Failed", "Failed to setup working directory", err)
 		return fmt.Errorf("setup failed: %w", err)
 	}
 
-	// Phase 2: Perform Rebase and Handle Conflicts
-	branchName := fmt.Sprintf("ai-rebase-%d", time.Now().Unix())
+	// Learn from the rebase PRs merged since the last run
+	learnResolutions(ctx, cfg, services)
+
+	// Phase 2 & 3: Perform Rebase and Resolve Conflicts with AI at every stop
 	conflicts, err := performGitRebase(ctx, cfg, services, branchName)
 	if err != nil {
 		sendErrorNotification(ctx, services, "AI Rebaser - Git Rebase Failed", "Failed to perform git rebase", err)
 		return fmt.Errorf("git rebase failed: %w", err)
 	}
-
-	// Phase 3: Resolve Conflicts with AI (if any)
-	if len(conflicts) > 0 {
-		if err := resolveConflictsWithAI(ctx, cfg, services, conflicts); err != nil {
-			sendErrorNotification(ctx, services, "AI Rebaser - Conflict Resolution Failed", 
-				fmt.Sprintf("Failed to resolve %d conflicts with AI", len(conflicts)), err)
-			return fmt.Errorf("conflict resolution failed: %w", err)
-		}
-	}
-
-	// Phase 4: Run Tests
-	if err := runTests(ctx, cfg, services); err != nil {
+	planResolutions(ctx, cfg, services, conflicts)
+
+	// Phase 4: Run Tests. Conflict markers left for a human would only make
+	// them fail.
+	var failedTests []string
+	if hasUnresolved(conflicts) {
+		log.Warn("Conflicts were left unresolved, skipping tests")
+	} else if failedTests, err = runTests(ctx, cfg, services, conflicts); err != nil {
 		sendErrorNotification(ctx, services, "AI Rebaser - Tests Failed", "Tests failed after rebase", err)
 		return fmt.Errorf("tests failed: %w", err)
 	}
 
-	// Phase 5: Create PR
-	pr, err := createPullRequest(ctx, cfg, services, conflicts, branchName)
+	// Phase 5: Review the rebased changes as a whole
+	findings, err := reviewRebase(ctx, cfg, services, conflicts)
+	if err != nil {
+		sendErrorNotification(ctx, services, "AI Rebaser - Review Failed", "AI review of the rebase found blocking problems", err)
+		return fmt.Errorf("review failed: %w", err)
+	}
+
+	// Phase 6: Create PR
+	pr, err := createPullRequest(ctx, cfg, services, conflicts, findings, failedTests, branchName)
 	if err != nil {
 		sendErrorNotification(ctx, services, "AI Rebaser - PR Creation Failed", "Failed to create pull request", err)
 		return fmt.Errorf("PR creation failed: %w", err)
 	}
 
-	// Phase 6: Send Notifications
-	if err := sendNotifications(ctx, cfg, services, pr, conflicts); err != nil {
+	// Learn the final resolutions of the AI's conflicts once the PR is
+	// merged. A dry run has no PR to learn from.
+	if !cfg.DryRun {
+		rememberResolutions(services, pr, conflicts)
+	}
+	recordRebase(cfg, heads)
+
+	// Phase 7: Send Notifications
+	if err := sendNotifications(ctx, cfg, services, pr, conflicts, failedTests); err != nil {
 		log.WithError(err).Warn("Failed to send notifications")
 	}
 
@@ -251,9 +394,18 @@ func setupWorkingDirectory(ctx context.Context, cfg *config.Config, services *Se
 	cfg.ActualWorkingDir = tempDir
 	log.WithField("temp_dir", tempDir).Info("Created temporary working directory")
 
-	// Clone internal repository
+	// Clone internal repository, from the mirror cache if there is one
 	internalDir := fmt.Sprintf("%s/internal", cfg.ActualWorkingDir)
-	if err := services.Git.Clone(ctx, cfg.Git.InternalRepo, internalDir); err != nil {
+	if cfg.Git.WorkingDir != "" {
+		mirrorDir := filepath.Join(cfg.Git.WorkingDir, "mirror.git")
+		remotes := map[string]string{"upstream": cfg.Git.UpstreamRepo}
+		if err := services.Git.UpdateMirror(ctx, mirrorDir, cfg.Git.InternalRepo, remotes); err != nil {
+			return fmt.Errorf("failed to update mirror cache: %w", err)
+		}
+		if err := services.Git.CloneShared(ctx, mirrorDir, cfg.Git.InternalRepo, internalDir); err != nil {
+			return fmt.Errorf("failed to clone internal repo from mirror cache: %w", err)
+		}
+	} else if err := services.Git.Clone(ctx, cfg.Git.InternalRepo, internalDir); err != nil {
 		// If clone fails, try to fetch (repo might already exist)
 		log.WithError(err).Info("Clone failed, attempting to fetch instead")
 		if err := services.Git.Fetch(ctx, internalDir); err != nil {
@@ -261,6 +413,11 @@ func setupWorkingDirectory(ctx context.Context, cfg *config.Config, services *Se
 		}
 	}
 
+	// Always write the merge base into conflict hunks
+	if err := services.Git.SetConfig(ctx, internalDir, "merge.conflictStyle", "zdiff3"); err != nil {
+		return fmt.Errorf("failed to configure conflict style: %w", err)
+	}
+
 	// Add upstream remote and fetch
 	if err := services.Git.AddRemote(ctx, internalDir, "upstream", cfg.Git.UpstreamRepo); err != nil {
 		return fmt.Errorf("failed to add upstream remote: %w", err)
@@ -270,11 +427,22 @@ func setupWorkingDirectory(ctx context.Context, cfg *config.Config, services *Se
 		return fmt.Errorf("failed to fetch from repositories: %w", err)
 	}
 
+	// Replay the resolutions recorded in earlier runs or seeded by humans
+	if cfg.Git.Rerere.Enabled {
+		seed := ""
+		if cfg.Git.Rerere.SeedBranch != "" {
+			seed = fmt.Sprintf("origin/%s", cfg.Git.Rerere.SeedBranch)
+		}
+		if err := services.Git.EnableRerere(ctx, internalDir, filepath.Join(cfg.StateDir, "rr-cache"), seed); err != nil {
+			return fmt.Errorf("failed to enable rerere: %w", err)
+		}
+	}
+
 	log.Info("Working directory setup completed")
 	return nil
 }
 
-// Phase 2: Perform git rebase and detect conflicts
+// Phase 2: Perform git rebase and resolve conflicts at every stop
 func performGitRebase(ctx context.Context, cfg *config.Config, services *Services, branchName string) ([]interfaces.GitConflict, error) {
 	log := logrus.WithField("component", "git-rebase")
 	log.Info("Starting git rebase operation")
@@ -297,60 +465,458 @@ func performGitRebase(ctx context.Context, cfg *config.Config, services *Service
 		log.WithError(err).Info("Rebase conflicts detected, proceeding with conflict resolution")
 	}
 
-	// Get conflicts if any
-	conflicts, err := services.Git.GetConflicts(ctx, internalDir)
+	// Drive the rebase through every remaining patch
+	conflicts, err := driveRebase(ctx, cfg, services, internalDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get conflicts: %w", err)
+		if abortErr := services.Git.AbortRebase(ctx, internalDir); abortErr != nil {
+			log.WithError(abortErr).Warn("Failed to abort rebase")
+		}
+		return nil, err
 	}
 
 	log.WithField("conflicts", len(conflicts)).Info("Git rebase completed")
 	return conflicts, nil
 }
 
-// Phase 3: Resolve conflicts using AI
-func resolveConflictsWithAI(ctx context.Context, cfg *config.Config, services *Services, conflicts []interfaces.GitConflict) error {
+// maxRebaseStops guards against a rebase that never makes progress
+const maxRebaseStops = 1000
+
+// driveRebase resolves the conflicts of each stop of an in-progress rebase and
+// continues it until all patches are applied. It returns every conflict that was
+// resolved along the way.
+func driveRebase(ctx context.Context, cfg *config.Config, services *Services, internalDir string) ([]interfaces.GitConflict, error) {
+	log := logrus.WithField("component", "git-rebase")
+
+	resolved := []interfaces.GitConflict{}
+	// Files left for a human keep their conflict markers, later patches
+	// touching them nest new markers inside
+	handedOff := map[string]bool{}
+	for stop := 1; ; stop++ {
+		inProgress, err := services.Git.RebaseInProgress(ctx, internalDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check rebase state: %w", err)
+		}
+		if !inProgress {
+			return resolved, nil
+		}
+		if stop > maxRebaseStops {
+			return nil, fmt.Errorf("rebase did not finish after %d stops", maxRebaseStops)
+		}
+
+		conflicts, err := services.Git.GetConflicts(ctx, internalDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get conflicts: %w", err)
+		}
+
+		log.WithFields(logrus.Fields{
+			"stop":      stop,
+			"conflicts": len(conflicts),
+		}).Info("Rebase stopped")
+
+		for _, conflict := range conflicts {
+			if conflict.MarkerError != "" && !handedOff[conflict.File] {
+				return nil, fmt.Errorf("failed to parse conflict markers of %s: %s", conflict.File, conflict.MarkerError)
+			}
+		}
+
+		if len(conflicts) > 0 {
+			conflicts, err = resolveConflictsWithAI(ctx, cfg, services, conflicts)
+			if err != nil {
+				return nil, fmt.Errorf("conflict resolution failed: %w", err)
+			}
+			resolved = append(resolved, conflicts...)
+			for _, conflict := range conflicts {
+				if conflict.Unresolved {
+					handedOff[conflict.File] = true
+				}
+			}
+
+			// Only human resolutions are replayed, so rerere must not
+			// record the resolutions of the AI and the policies
+			if cfg.Git.Rerere.Enabled && !allReplayed(conflicts) {
+				if err := services.Git.ClearRerere(ctx, internalDir); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		err = services.Git.ContinueRebase(ctx, internalDir)
+		if err == nil || isConflictError(err) {
+			// Either finished or stopped on the next conflicting patch
+			continue
+		}
+		if len(conflicts) > 0 || !isEmptyPatchError(err) {
+			return nil, fmt.Errorf("failed to continue rebase: %w", err)
+		}
+
+		// The patch has nothing left to apply, upstream already has its
+		// changes. Dropping it loses nothing.
+		log.WithError(err).Info("Patch is empty, skipping it")
+		if err := services.Git.SkipCommit(ctx, internalDir); err != nil && !isConflictError(err) {
+			return nil, fmt.Errorf("failed to skip patch: %w", err)
+		}
+	}
+}
+
+// allReplayed reports whether rerere resolved all conflicts of a stop
+func allReplayed(conflicts []interfaces.GitConflict) bool {
+	for _, conflict := range conflicts {
+		if !conflict.Replayed {
+			return false
+		}
+	}
+	return true
+}
+
+// Phase 3: Resolve the conflicts of a single rebase stop using AI and stage them.
+// The returned conflicts record the action taken for each of them.
+func resolveConflictsWithAI(ctx context.Context, cfg *config.Config, services *Services, conflicts []interfaces.GitConflict) ([]interfaces.GitConflict, error) {
 	log := logrus.WithField("component", "conflict-resolution")
 	log.WithField("conflicts", len(conflicts)).Info("Resolving conflicts with AI")
 
 	internalDir := fmt.Sprintf("%s/internal", cfg.ActualWorkingDir)
 
+	resolved := make([]interfaces.GitConflict, 0, len(conflicts))
+	regenerated := map[string]bool{}
 	for _, conflict := range conflicts {
-		log.WithField("file", conflict.File).Info("Resolving conflict")
-		
-		// Use AI to resolve the conflict
-		resolution, err := services.AI.ResolveConflict(ctx, conflict)
+		log.WithFields(logrus.Fields{
+			"file": conflict.File,
+			"type": conflict.Type,
+		}).Info("Resolving conflict")
+
+		var action string
+		var resolution *interfaces.ConflictResolution
+		var err error
+		if policy := matchConflictPolicy(cfg.Git.ConflictPolicies, conflict); policy != nil {
+			action, err = applyConflictPolicy(ctx, cfg, services, internalDir, *policy, conflict, regenerated)
+		} else if conflict.Replayed {
+			// rerere already wrote the recorded resolution
+			action = "replayed human resolution"
+			if err = services.Git.StageFile(ctx, internalDir, conflict.File); err != nil {
+				err = fmt.Errorf("failed to stage replayed resolution of %s: %w", conflict.File, err)
+			}
+		} else if conflict.MarkerError != "" {
+			// The markers of an earlier handoff are still in the file
+			err = needsHuman("conflict markers nest inside the unresolved ones of an earlier patch: %s", conflict.MarkerError)
+		} else {
+			action, resolution, err = resolveConflict(ctx, cfg, services, internalDir, conflict)
+		}
+
+		if reason, ok := handoffReason(ctx, err); ok && cfg.Git.Handoff != config.HandoffAbort {
+			log.WithError(err).WithField("file", conflict.File).Warn("Leaving conflict for a human")
+			action, err = leaveUnresolved(ctx, cfg, services, internalDir, conflict, reason)
+			conflict.Unresolved = true
+		}
 		if err != nil {
-			return fmt.Errorf("AI failed to resolve conflict in %s: %w", conflict.File, err)
+			return nil, err
 		}
 
-		// Apply the resolution
-		if err := services.Git.ResolveConflict(ctx, internalDir, conflict.File, resolution); err != nil {
-			return fmt.Errorf("failed to apply resolution for %s: %w", conflict.File, err)
+		conflict.Action = action
+		conflict.ResolvedByAI = resolution != nil
+		conflict.Resolution = resolution
+		resolved = append(resolved, conflict)
+	}
+
+	log.Info("All conflicts resolved successfully")
+	return resolved, nil
+}
+
+// handoffReason reports whether a failed conflict can be left for a human,
+// and why. Failures of the AI are, failures of git and canceled runs are not.
+func handoffReason(ctx context.Context, err error) (string, bool) {
+	var human *needsHumanError
+	var failure *aiFailureError
+	switch {
+	case err == nil || ctx.Err() != nil:
+		return "", false
+	case errors.Is(err, usage.ErrLimitExceeded):
+		return "AI usage limit reached", true
+	case errors.As(err, &human):
+		return human.reason, true
+	case errors.As(err, &failure):
+		return failure.err.Error(), true
+	}
+	return "", false
+}
+
+// leaveUnresolved stages a conflicted file for a human to resolve in the pull
+// request, so the rebase can go on. The file keeps its conflict markers, or
+// in sidecar mode is staged at its upstream version with the conflict next to
+// it in a .rej file.
+func leaveUnresolved(ctx context.Context, cfg *config.Config, services *Services, internalDir string, conflict interfaces.GitConflict, reason string) (string, error) {
+	if cfg.Git.Handoff == config.HandoffSidecar && isContentConflict(conflict) {
+		if err := services.Git.CheckoutSide(ctx, internalDir, conflict.File, interfaces.SideUpstream); err != nil {
+			return "", fmt.Errorf("failed to keep upstream version of %s: %w", conflict.File, err)
+		}
+		sidecar := conflict.File + ".rej"
+		if err := services.Git.ResolveConflict(ctx, internalDir, sidecar, conflict.Content); err != nil {
+			return "", fmt.Errorf("failed to stage %s: %w", sidecar, err)
 		}
+		return fmt.Sprintf("left unresolved for a human, conflict in %s: %s", sidecar, reason), nil
 	}
 
-	// Generate commit message for the resolved conflicts
-	changes := make([]string, len(conflicts))
-	for i, conflict := range conflicts {
-		changes[i] = conflict.File
+	if err := services.Git.ResolveConflict(ctx, internalDir, conflict.File, conflict.Content); err != nil {
+		return "", fmt.Errorf("failed to stage %s with conflict markers: %w", conflict.File, err)
 	}
-	
-	commitMessage, err := services.AI.GenerateCommitMessage(ctx, changes)
+
+	// The other paths of a rename conflict stay unmerged otherwise
+	for _, path := range []string{conflict.RenamedFrom, conflict.RenamedTo} {
+		if path == "" || path == conflict.File {
+			continue
+		}
+		if err := services.Git.RemoveFile(ctx, internalDir, path); err != nil {
+			return "", fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+
+	return fmt.Sprintf("left unresolved for a human: %s", reason), nil
+}
+
+// isContentConflict reports whether both sides changed the content of a file
+func isContentConflict(conflict interfaces.GitConflict) bool {
+	return conflict.Type == "" || conflict.Type == interfaces.ConflictBothModified || conflict.Type == interfaces.ConflictAddedByBoth
+}
+
+// unresolvedReasons lists the conflicts left for a human with the reason
+func unresolvedReasons(conflicts []interfaces.GitConflict) []string {
+	var reasons []string
+	for _, conflict := range conflicts {
+		if conflict.Unresolved {
+			reasons = append(reasons, fmt.Sprintf("%s (%s)", conflict.File, conflict.Action))
+		}
+	}
+	return reasons
+}
+
+// hasUnresolved reports whether conflicts were left for a human
+func hasUnresolved(conflicts []interfaces.GitConflict) bool {
+	for _, conflict := range conflicts {
+		if conflict.Unresolved {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConflict applies the resolution strategy of the conflict's type. It
+// returns a description of the action taken and the AI's resolution if the
+// AI wrote the resolved content.
+func resolveConflict(ctx context.Context, cfg *config.Config, services *Services, internalDir string, conflict interfaces.GitConflict) (string, *interfaces.ConflictResolution, error) {
+	switch conflict.Type {
+	case interfaces.ConflictDeletedByUs:
+		// Keep the internal changes, a reviewer decides whether they
+		// still belong in the tree
+		if err := services.Git.CheckoutSide(ctx, internalDir, conflict.File, interfaces.SideInternal); err != nil {
+			return "", nil, fmt.Errorf("failed to keep internal version of %s: %w", conflict.File, err)
+		}
+		return "kept internal version, the file was deleted upstream", nil, nil
+
+	case interfaces.ConflictDeletedByThem:
+		if err := services.Git.RemoveFile(ctx, internalDir, conflict.File); err != nil {
+			return "", nil, fmt.Errorf("failed to delete %s: %w", conflict.File, err)
+		}
+		return "deleted, the internal patch removes the file", nil, nil
+
+	case interfaces.ConflictRenamed:
+		return resolveRenameConflict(ctx, cfg, services, internalDir, conflict)
+	}
+
+	// Content conflicts: both-modified and added-by-both
+	if conflict.Binary {
+		return "", nil, fmt.Errorf("binary conflict in %s has no matching conflict policy", conflict.File)
+	}
+
+	resolution, err := resolveConflictContent(ctx, cfg, services, conflict)
 	if err != nil {
-		return fmt.Errorf("failed to generate commit message: %w", err)
+		return "", nil, &aiFailureError{file: conflict.File, err: err}
 	}
 
-	// Commit the resolved conflicts
-	if err := services.Git.Commit(ctx, internalDir, commitMessage); err != nil {
-		return fmt.Errorf("failed to commit resolved conflicts: %w", err)
+	// Apply and stage the resolution
+	if err := services.Git.ResolveConflict(ctx, internalDir, conflict.File, resolution.Resolution); err != nil {
+		return "", nil, fmt.Errorf("failed to apply resolution for %s: %w", conflict.File, err)
 	}
+	return "merged with AI" + reviewNote(cfg, resolution), resolution, nil
+}
 
-	log.Info("All conflicts resolved successfully")
-	return nil
+// resolveRenameConflict keeps a file renamed by both sides at its upstream
+// path, merged with the changes of the internal version, and removes the
+// other paths
+func resolveRenameConflict(ctx context.Context, cfg *config.Config, services *Services, internalDir string, conflict interfaces.GitConflict) (string, *interfaces.ConflictResolution, error) {
+	var action string
+	switch {
+	case conflict.File == conflict.RenamedFrom:
+		action = "deleted, both sides moved the file away"
+		if err := services.Git.RemoveFile(ctx, internalDir, conflict.File); err != nil {
+			return "", nil, fmt.Errorf("failed to delete %s: %w", conflict.File, err)
+		}
+		return action, nil, nil
+
+	case conflict.RenamedTo == "" || conflict.RenamedTo == conflict.File:
+		action = "kept the only remaining version"
+
+	case len(conflict.Hunks) > 0:
+		action = fmt.Sprintf("merged with AI into the upstream path, internal patch renamed it to %s", conflict.RenamedTo)
+
+	default:
+		action = fmt.Sprintf("merged into the upstream path, internal patch renamed it to %s", conflict.RenamedTo)
+	}
+
+	// Without hunks the content was merged cleanly and needs no AI
+	content := conflict.Content
+	var resolution *interfaces.ConflictResolution
+	if len(conflict.Hunks) > 0 {
+		var err error
+		resolution, err = resolveConflictContent(ctx, cfg, services, conflict)
+		if err != nil {
+			return "", nil, &aiFailureError{file: conflict.File, err: err}
+		}
+		content = resolution.Resolution
+		action += reviewNote(cfg, resolution)
+	}
+
+	if err := services.Git.ResolveConflict(ctx, internalDir, conflict.File, content); err != nil {
+		return "", nil, fmt.Errorf("failed to apply resolution for %s: %w", conflict.File, err)
+	}
+
+	for _, path := range []string{conflict.RenamedFrom, conflict.RenamedTo} {
+		if path == "" || path == conflict.File {
+			continue
+		}
+		if err := services.Git.RemoveFile(ctx, internalDir, path); err != nil {
+			return "", nil, fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+
+	return action, resolution, nil
+}
+
+// reviewNote flags resolutions the AI is not confident enough about to apply
+// without a closer look
+func reviewNote(cfg *config.Config, resolution *interfaces.ConflictResolution) string {
+	if resolution.Confidence >= cfg.AI.Confidence.AutoApply {
+		return ""
+	}
+	return fmt.Sprintf(", flagged for review (confidence %.2f)", resolution.Confidence)
+}
+
+// resolveConflictContent returns the AI's resolution of a conflicted file.
+// Every AI resolution is validated, and rejected ones are retried with the
+// problems as feedback until the configured number of retries is used up.
+// Each retry moves on to the next model configured for conflict resolution.
+// Resolutions the AI is not confident enough about are left for a human.
+func resolveConflictContent(ctx context.Context, cfg *config.Config, services *Services, conflict interfaces.GitConflict) (*interfaces.ConflictResolution, error) {
+	log := logrus.WithFields(logrus.Fields{
+		"component": "conflict-resolution",
+		"file":      conflict.File,
+	})
+
+	var problems []string
+	for attempt := 0; attempt <= cfg.AI.Validation.MaxRetries; attempt++ {
+		conflict.Feedback = problems
+
+		resolution, err := generateResolution(ctx, cfg, services, conflict)
+		if err == nil {
+			err = validateResolution(ctx, cfg, conflict, resolution.Resolution)
+		}
+		if err == nil {
+			if resolution.Confidence < cfg.AI.Confidence.Review {
+				return nil, needsHuman("AI confidence %.2f is below the review threshold of %.2f", resolution.Confidence, cfg.AI.Confidence.Review)
+			}
+			return resolution, nil
+		}
+		if errors.Is(err, ai.ErrPromptTooLarge) || errors.Is(err, ai.ErrNoConsensus) {
+			return nil, needsHuman("%v", err)
+		}
+		if !errors.Is(err, errInvalidResolution) && !errors.Is(err, ai.ErrTruncated) && !errors.Is(err, ai.ErrMalformedResponse) {
+			return nil, err
+		}
+
+		log.WithError(err).WithField("attempt", attempt+1).Warn("AI resolution rejected")
+		problems = append(problems, err.Error())
+	}
+
+	return nil, fmt.Errorf("%w after %d attempts: %s", errUnresolved, len(problems), strings.Join(problems, "; "))
+}
+
+// generateResolution asks the AI for the resolved content of a conflicted
+// file. In hunk mode every conflict hunk is resolved on its own and spliced
+// back into the file, so the lines outside the hunks are never touched by the
+// AI. Files too large for file mode fall back to hunk mode.
+func generateResolution(ctx context.Context, cfg *config.Config, services *Services, conflict interfaces.GitConflict) (*interfaces.ConflictResolution, error) {
+	if cfg.AI.ResolutionMode == config.ResolutionModeFile || len(conflict.Hunks) == 0 {
+		resolution, err := services.AI.ResolveConflict(ctx, conflict)
+		if errors.Is(err, ai.ErrPromptTooLarge) && len(conflict.Hunks) > 0 {
+			logrus.WithField("file", conflict.File).WithError(err).Warn("File too large to resolve as a whole, resolving hunk by hunk")
+			return generateHunkResolution(ctx, services, conflict)
+		}
+		if err != nil {
+			return nil, err
+		}
+		cleaned := *resolution
+		cleaned.Resolution = validate.Clean(resolution.Resolution)
+		return &cleaned, nil
+	}
+
+	return generateHunkResolution(ctx, services, conflict)
+}
+
+// generateHunkResolution resolves every conflict hunk on its own and splices
+// the resolutions back into the file
+func generateHunkResolution(ctx context.Context, services *Services, conflict interfaces.GitConflict) (*interfaces.ConflictResolution, error) {
+	resolutions := make([]*interfaces.ConflictResolution, 0, len(conflict.Hunks))
+	contents := make([]string, 0, len(conflict.Hunks))
+	for _, hunk := range conflict.Hunks {
+		resolution, err := services.AI.ResolveConflictHunk(ctx, conflict, hunk)
+		if err != nil {
+			return nil, fmt.Errorf("hunk at lines %d-%d: %w", hunk.StartLine, hunk.EndLine, err)
+		}
+
+		content := validate.Clean(resolution.Resolution)
+		if err := validateHunk(conflict, hunk, content); err != nil {
+			return nil, err
+		}
+		resolutions = append(resolutions, resolution)
+		contents = append(contents, content)
+	}
+
+	content, err := markers.Splice(conflict.Content, conflict.Hunks, contents)
+	if err != nil {
+		return nil, err
+	}
+	return combineResolutions(content, conflict.Hunks, resolutions), nil
+}
+
+// combineResolutions merges the resolutions of the hunks of a file. The file
+// is only as certain as its least certain hunk.
+func combineResolutions(content string, hunks []interfaces.ConflictHunk, resolutions []*interfaces.ConflictResolution) *interfaces.ConflictResolution {
+	combined := &interfaces.ConflictResolution{Resolution: content, Confidence: 1}
+
+	rationales := make([]string, 0, len(resolutions))
+	for i, resolution := range resolutions {
+		combined.Confidence = min(combined.Confidence, resolution.Confidence)
+		if i == 0 {
+			combined.Strategy = resolution.Strategy
+		} else if combined.Strategy != resolution.Strategy {
+			combined.Strategy = interfaces.StrategyCombined
+		}
+		combined.Risks = append(combined.Risks, resolution.Risks...)
+
+		if len(resolutions) == 1 {
+			rationales = append(rationales, resolution.Rationale)
+		} else {
+			rationales = append(rationales, fmt.Sprintf("lines %d-%d: %s", hunks[i].StartLine, hunks[i].EndLine, resolution.Rationale))
+		}
+	}
+	combined.Rationale = strings.Join(rationales, "; ")
+
+	return combined
 }
 
-// Phase 4: Run tests to validate the rebase
-func runTests(ctx context.Context, cfg *config.Config, services *Services) error {
+// Phase 4: Run tests to validate the rebase. Failures in a rebase with AI
+// resolved conflicts are handed to the repair loop. It returns the tests
+// still failing when the AI usage limit stopped the repair, for a human to
+// fix in a draft PR.
+func runTests(ctx context.Context, cfg *config.Config, services *Services, conflicts []interfaces.GitConflict) ([]string, error) {
 	log := logrus.WithField("component", "testing")
 	log.Info("Running tests")
 
@@ -359,37 +925,83 @@ func runTests(ctx context.Context, cfg *config.Config, services *Services) error
 	// Run the test suite
 	result, err := services.Test.RunTests(ctx, internalDir)
 	if err != nil {
-		return fmt.Errorf("failed to run tests: %w", err)
+		return nil, fmt.Errorf("failed to run tests: %w", err)
 	}
 
 	if !result.Success {
 		log.WithField("failed_tests", result.FailedTests).Error("Tests failed")
-		return fmt.Errorf("tests failed: %v", result.FailedTests)
+
+		files := aiResolvedFiles(conflicts)
+		if len(files) == 0 || cfg.Tests.MaxRepairAttempts <= 0 {
+			return nil, fmt.Errorf("tests failed: %v", result.FailedTests)
+		}
+
+		result, err = repairBuild(ctx, cfg, services, files, result)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Success {
+			log.WithField("failed_tests", result.FailedTests).Warn("Leaving failing tests for a human")
+			return result.FailedTests, nil
+		}
 	}
 
 	log.WithField("duration", result.Duration).Info("All tests passed")
-	return nil
+	return nil, nil
 }
 
-// Phase 5: Create pull request
-func createPullRequest(ctx context.Context, cfg *config.Config, services *Services, conflicts []interfaces.GitConflict, branchName string) (*interfaces.PullRequest, error) {
+// Phase 6: Create pull request
+func createPullRequest(ctx context.Context, cfg *config.Config, services *Services, conflicts []interfaces.GitConflict, findings []interfaces.ReviewFinding, failedTests []string, branchName string) (*interfaces.PullRequest, error) {
 	log := logrus.WithField("component", "pr-creation")
 	log.Info("Creating pull request")
 
 	internalDir := fmt.Sprintf("%s/internal", cfg.ActualWorkingDir)
 
-	// Push the branch to GitHub
-	if err := services.Git.Push(ctx, internalDir, branchName); err != nil {
+	// Conflicts and failing tests left for a human keep the PR from being
+	// merged as-is
+	unresolved := hasUnresolved(conflicts)
+	draft := unresolved || len(failedTests) > 0
+
+	// Replace the rebase PRs of earlier runs if the policy says so
+	stale, kept := staleRebasePRs(ctx, cfg, services)
+	existing := supersedeTarget(cfg, stale, draft)
+
+	// Push the branch to GitHub, over the branch of the PR being updated
+	if existing != nil {
+		if err := services.Git.ForcePush(ctx, internalDir, branchName, existing.Head, existing.HeadSHA); err != nil {
+			return nil, fmt.Errorf("failed to push branch: %w", err)
+		}
+	} else if err := services.Git.Push(ctx, internalDir, branchName); err != nil {
 		return nil, fmt.Errorf("failed to push branch: %w", err)
 	}
 
 	// Generate PR description with AI
 	commits := []string{} // TODO: Get actual commit messages
 	prDescription, err := services.AI.GeneratePRDescription(ctx, commits, conflicts)
+	if errors.Is(err, usage.ErrLimitExceeded) {
+		log.WithError(err).Warn("AI usage limit reached, using a plain PR description")
+		prDescription, err = "Automated rebase of the internal patches onto upstream.", nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate PR description: %w", err)
 	}
 
+	// Record how every conflict was resolved, what the review found and
+	// what the AI cost
+	prDescription += formatResolutionSummary(conflicts)
+	prDescription += formatReviewFindings(findings)
+	prDescription += formatUsageSummary(services.Usage)
+	prDescription += formatKeptPRs(kept)
+
+	if unresolved {
+		prDescription = "> [!WARNING]\n> Some conflicts were left unresolved. Finish the files below before merging, tests were not run.\n\n" +
+			formatHandoffChecklist(conflicts) + "\n" + prDescription
+	}
+	if len(failedTests) > 0 {
+		prDescription = "> [!WARNING]\n> The AI usage limit stopped the repair of failing tests. Fix them below before merging.\n\n" +
+			formatFailingTests(failedTests) + "\n" + prDescription
+	}
+
 	// Create the PR
 	prTitle := fmt.Sprintf("AI-assisted rebase - %s", time.Now().Format("2006-01-02"))
 	prRequest := interfaces.CreatePRRequest{
@@ -397,12 +1009,20 @@ func createPullRequest(ctx context.Context, cfg *config.Config, services *Servic
 		Body:  prDescription,
 		Head:  branchName,
 		Base:  cfg.Git.Branch,
-		Draft: false,
+		Draft: draft,
 	}
 
-	pr, err := services.GitHub.CreatePullRequest(ctx, prRequest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create PR: %w", err)
+	var pr *interfaces.PullRequest
+	if existing != nil {
+		pr, err = services.GitHub.UpdatePullRequest(ctx, existing.Number, prTitle, prDescription)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update PR: %w", err)
+		}
+	} else {
+		pr, err = services.GitHub.CreatePullRequest(ctx, prRequest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create PR: %w", err)
+		}
 	}
 
 	// Add reviewers if configured
@@ -412,12 +1032,14 @@ func createPullRequest(ctx context.Context, cfg *config.Config, services *Servic
 		}
 	}
 
+	closeStalePRs(ctx, services, stale, pr)
+
 	log.WithField("pr_number", pr.Number).Info("Pull request created successfully")
 	return pr, nil
 }
 
-// Phase 6: Send notifications
-func sendNotifications(ctx context.Context, cfg *config.Config, services *Services, pr *interfaces.PullRequest, conflicts []interfaces.GitConflict) error {
+// Phase 7: Send notifications
+func sendNotifications(ctx context.Context, cfg *config.Config, services *Services, pr *interfaces.PullRequest, conflicts []interfaces.GitConflict, failedTests []string) error {
 	log := logrus.WithField("component", "notifications")
 	log.Info("Sending notifications")
 
@@ -436,11 +1058,34 @@ func sendNotifications(ctx context.Context, cfg *config.Config, services *Servic
 			pr.Number)
 	}
 
+	level := interfaces.NotificationLevelSuccess
+	actionRequired := false
+	if hasUnresolved(conflicts) {
+		messageText = fmt.Sprintf("⚠️ AI-assisted rebase left conflicts unresolved: %s. Draft PR #%d needs a human to finish them.", strings.Join(unresolvedReasons(conflicts), "; "), pr.Number)
+		level = interfaces.NotificationLevelWarning
+		actionRequired = true
+	}
+	if len(failedTests) > 0 {
+		messageText = fmt.Sprintf("⚠️ AI usage limit reached while repairing failing tests: %s. Draft PR #%d needs a human to fix them.", strings.Join(failedTests, ", "), pr.Number)
+		level = interfaces.NotificationLevelWarning
+		actionRequired = true
+	}
+	if totals := services.Usage.Totals(); totals.Calls > 0 {
+		messageText += fmt.Sprintf("\n\nAI usage: %s", formatUsageTotals(totals))
+	}
+
+	title := "AI Rebaser - Rebase Completed"
+	if actionRequired {
+		title = "AI Rebaser - Action Required"
+	}
+
 	message := interfaces.NotificationMessage{
-		Title:   "AI Rebaser - Rebase Completed",
+		Title:   title,
 		Message: messageText,
 		URL:     pr.HTMLURL,
-		Level:   interfaces.NotificationLevelSuccess,
+		Level:   level,
+
+		ActionRequired: actionRequired,
 	}
 
 	if err := services.Notify.SendMessage(ctx, message); err != nil {
@@ -471,6 +1116,12 @@ func isConflictError(err error) bool {
 	return err != nil && (strings.Contains(err.Error(), "conflict") || strings.Contains(err.Error(), "CONFLICT"))
 }
 
+// isEmptyPatchError reports if a rebase step failed because the patch has no
+// changes left
+func isEmptyPatchError(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "nothing to commit") || strings.Contains(err.Error(), "No changes"))
+}
+
 // Cleanup working directory unless artifacts should be kept
 func cleanupWorkingDirectory(cfg *config.Config) error {
 	if cfg.KeepArtifacts {
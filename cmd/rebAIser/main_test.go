@@ -3,7 +3,11 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,11 +15,30 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/BlindspotSoftware/rebAIser/internal/ai"
+	"github.com/BlindspotSoftware/rebAIser/internal/calendar"
 	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/dryrun"
+	"github.com/BlindspotSoftware/rebAIser/internal/git"
 	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/markers"
+	"github.com/BlindspotSoftware/rebAIser/internal/memory"
 	"github.com/BlindspotSoftware/rebAIser/internal/mocks"
+	"github.com/BlindspotSoftware/rebAIser/internal/state"
+	"github.com/BlindspotSoftware/rebAIser/internal/usage"
+	"github.com/BlindspotSoftware/rebAIser/internal/validate"
 )
 
+// aiResolution is a confident AI resolution with the given content
+func aiResolution(content string) *interfaces.ConflictResolution {
+	return &interfaces.ConflictResolution{
+		Resolution: content,
+		Confidence: 0.9,
+		Strategy:   interfaces.StrategyCombined,
+		Rationale:  "Kept the changes of both sides",
+	}
+}
+
 func TestInitializeServices(t *testing.T) {
 	cfg := &config.Config{
 		AI: config.AIConfig{
@@ -45,6 +68,38 @@ func TestInitializeServices(t *testing.T) {
 	assert.NotNil(t, services.Test)
 }
 
+func TestInitializeServices_MissingAPIKey(t *testing.T) {
+	cfg := &config.Config{
+		AI: config.AIConfig{Provider: config.ProviderAnthropic, OpenAIAPIKey: "test-key"},
+	}
+
+	_, err := initializeServices(cfg)
+	assert.EqualError(t, err, "no API key provided for AI provider anthropic. Set ANTHROPIC_API_KEY or choose another ai.provider")
+}
+
+func TestAIOperations(t *testing.T) {
+	cfg := config.AIConfig{
+		AnthropicAPIKey: "anthropic-key",
+		Operations: map[string][]config.ModelConfig{
+			config.OperationResolveConflict: {
+				{Provider: config.ProviderAnthropic, Model: "claude-sonnet-4-5"},
+				{Provider: config.ProviderLocal, BaseURL: "http://gpu-box:8000/v1"},
+			},
+		},
+	}
+
+	operations, err := aiOperations(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []ai.Model{
+		{Provider: config.ProviderAnthropic, APIKey: "anthropic-key", Model: "claude-sonnet-4-5"},
+		{Provider: config.ProviderLocal, BaseURL: "http://gpu-box:8000/v1"},
+	}, operations[config.OperationResolveConflict])
+
+	cfg.Operations[config.OperationCommitMessage] = []config.ModelConfig{{Provider: config.ProviderOpenAI, Model: "gpt-4o-mini"}}
+	_, err = aiOperations(cfg)
+	assert.ErrorContains(t, err, "no API key provided for AI provider openai used by commit_message")
+}
+
 func TestPerformRebase_Success(t *testing.T) {
 	// Setup mocks
 	mockGit := &mocks.MockGitService{}
@@ -63,7 +118,6 @@ func TestPerformRebase_Success(t *testing.T) {
 
 	cfg := &config.Config{
 		Git: config.GitConfig{
-			WorkingDir:   "/tmp/test",
 			InternalRepo: "https://github.com/test/internal.git",
 			UpstreamRepo: "https://github.com/test/upstream.git",
 			Branch:       "main",
@@ -77,11 +131,12 @@ func TestPerformRebase_Success(t *testing.T) {
 
 	// Mock setup expectations
 	mockGit.On("Clone", ctx, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("SetConfig", ctx, mock.AnythingOfType("string"), "merge.conflictStyle", "zdiff3").Return(nil)
 	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
 	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
 	mockGit.On("CreateBranch", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
 	mockGit.On("Rebase", ctx, mock.AnythingOfType("string"), "upstream/main").Return(nil)
-	mockGit.On("GetConflicts", ctx, mock.AnythingOfType("string")).Return([]interfaces.GitConflict{}, nil)
+	mockGit.On("RebaseInProgress", ctx, mock.AnythingOfType("string")).Return(false, nil)
 
 	// Mock test expectations
 	testResult := &interfaces.TestResult{
@@ -135,7 +190,6 @@ func TestPerformRebase_WithConflicts(t *testing.T) {
 
 	cfg := &config.Config{
 		Git: config.GitConfig{
-			WorkingDir:   "/tmp/test",
 			InternalRepo: "https://github.com/test/internal.git",
 			UpstreamRepo: "https://github.com/test/upstream.git",
 			Branch:       "main",
@@ -159,17 +213,19 @@ func TestPerformRebase_WithConflicts(t *testing.T) {
 
 	// Mock setup expectations
 	mockGit.On("Clone", ctx, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("SetConfig", ctx, mock.AnythingOfType("string"), "merge.conflictStyle", "zdiff3").Return(nil)
 	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
 	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
 	mockGit.On("CreateBranch", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
 	mockGit.On("Rebase", ctx, mock.AnythingOfType("string"), "upstream/main").Return(errors.New("rebase conflicts detected"))
+	mockGit.On("RebaseInProgress", ctx, mock.AnythingOfType("string")).Return(true, nil).Once()
 	mockGit.On("GetConflicts", ctx, mock.AnythingOfType("string")).Return(conflicts, nil)
 
 	// Mock AI conflict resolution
-	mockAI.On("ResolveConflict", ctx, conflicts[0]).Return("resolved content", nil)
+	mockAI.On("ResolveConflict", ctx, conflicts[0]).Return(aiResolution("resolved content"), nil)
 	mockGit.On("ResolveConflict", ctx, mock.AnythingOfType("string"), "test.go", "resolved content").Return(nil)
-	mockAI.On("GenerateCommitMessage", ctx, []string{"test.go"}).Return("AI: Resolve conflicts in test.go", nil)
-	mockGit.On("Commit", ctx, mock.AnythingOfType("string"), "AI: Resolve conflicts in test.go").Return(nil)
+	mockGit.On("ContinueRebase", ctx, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("RebaseInProgress", ctx, mock.AnythingOfType("string")).Return(false, nil)
 
 	// Mock test expectations
 	testResult := &interfaces.TestResult{
@@ -181,13 +237,19 @@ func TestPerformRebase_WithConflicts(t *testing.T) {
 
 	// Mock GitHub expectations
 	mockGit.On("Push", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
-	mockAI.On("GeneratePRDescription", ctx, []string{}, conflicts).Return("Test PR description with conflicts", nil)
+	resolved := []interfaces.GitConflict{conflicts[0]}
+	resolved[0].Action = "merged with AI"
+	resolved[0].ResolvedByAI = true
+	resolved[0].Resolution = aiResolution("resolved content")
+	mockAI.On("GeneratePRDescription", ctx, []string{}, resolved).Return("Test PR description with conflicts", nil)
 	
 	pr := &interfaces.PullRequest{
 		Number:  124,
 		HTMLURL: "https://github.com/test/internal/pull/124",
 	}
-	mockGitHub.On("CreatePullRequest", ctx, mock.AnythingOfType("interfaces.CreatePRRequest")).Return(pr, nil)
+	mockGitHub.On("CreatePullRequest", ctx, mock.MatchedBy(func(req interfaces.CreatePRRequest) bool {
+		return strings.Contains(req.Body, "| `test.go` | both-modified | merged with AI |")
+	})).Return(pr, nil)
 	mockGitHub.On("AddReviewers", ctx, 124, []string{"core-team"}).Return(nil)
 
 	// Mock notification expectations
@@ -205,6 +267,278 @@ func TestPerformRebase_WithConflicts(t *testing.T) {
 	mockTest.AssertExpectations(t)
 }
 
+func TestPerformRebase_DryRun(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockGitHub := &mocks.MockGitHubService{}
+	mockNotify := &mocks.MockNotifyService{}
+	mockTest := &mocks.MockTestService{}
+
+	// Wrapped like initializeServices does for dry runs
+	plan := dryrun.NewPlan()
+	services := &Services{
+		Git:    dryrun.NewGitService(mockGit, plan),
+		AI:     mockAI,
+		GitHub: dryrun.NewGitHubService(mockGitHub, plan),
+		Notify: dryrun.NewNotifyService(plan),
+		Test:   mockTest,
+		Plan:   plan,
+	}
+
+	cfg := &config.Config{
+		DryRun:    true,
+		ReportDir: t.TempDir(),
+		Git: config.GitConfig{
+			InternalRepo: "https://github.com/test/internal.git",
+			UpstreamRepo: "https://github.com/test/upstream.git",
+			Branch:       "main",
+		},
+		GitHub: config.GitHubConfig{
+			ReviewersTeam: "core-team",
+		},
+	}
+
+	ctx := context.Background()
+
+	conflicts := []interfaces.GitConflict{
+		{
+			File:    "test.go",
+			Content: "conflict content",
+			Ours:    "our version",
+			Theirs:  "their version",
+		},
+	}
+
+	mockGit.On("Clone", ctx, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("SetConfig", ctx, mock.AnythingOfType("string"), "merge.conflictStyle", "zdiff3").Return(nil)
+	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
+	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("CreateBranch", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("Rebase", ctx, mock.AnythingOfType("string"), "upstream/main").Return(errors.New("rebase conflicts detected"))
+	mockGit.On("RebaseInProgress", ctx, mock.AnythingOfType("string")).Return(true, nil).Once()
+	mockGit.On("GetConflicts", ctx, mock.AnythingOfType("string")).Return(conflicts, nil)
+	mockAI.On("ResolveConflict", ctx, conflicts[0]).Return(aiResolution("resolved content"), nil)
+	mockGit.On("ResolveConflict", ctx, mock.AnythingOfType("string"), "test.go", "resolved content").Return(nil)
+	mockGit.On("ContinueRebase", ctx, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("RebaseInProgress", ctx, mock.AnythingOfType("string")).Return(false, nil)
+	mockGit.On("Diff", ctx, mock.AnythingOfType("string"), "upstream/main", "HEAD", []string{"test.go"}).Return("-our version\n+resolved content\n", nil)
+	mockTest.On("RunTests", ctx, mock.AnythingOfType("string")).Return(&interfaces.TestResult{Success: true}, nil)
+	mockAI.On("GeneratePRDescription", ctx, []string{}, mock.Anything).Return("Test PR description", nil)
+
+	err := performRebase(ctx, cfg, services)
+
+	require.NoError(t, err)
+	mockGit.AssertNotCalled(t, "Push", mock.Anything, mock.Anything, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "CreatePullRequest", mock.Anything, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "AddReviewers", mock.Anything, mock.Anything, mock.Anything)
+	mockNotify.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything)
+
+	reports, err := filepath.Glob(filepath.Join(cfg.ReportDir, "ai-rebase-*.md"))
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	report, err := os.ReadFile(reports[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "## Pull Request: AI-assisted rebase")
+	assert.Contains(t, string(report), "reviewers: core-team")
+	assert.Contains(t, string(report), "| `test.go` | both-modified | merged with AI |")
+	assert.Contains(t, string(report), "+resolved content")
+	assert.Contains(t, string(report), "### AI Rebaser - Rebase Completed (success)")
+
+	_, err = os.Stat(strings.TrimSuffix(reports[0], ".md") + ".json")
+	assert.NoError(t, err)
+}
+
+func TestPerformRebase_UsageLimitOpensDraftPR(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockGitHub := &mocks.MockGitHubService{}
+	mockNotify := &mocks.MockNotifyService{}
+	mockTest := &mocks.MockTestService{}
+
+	services := &Services{
+		Git:    mockGit,
+		AI:     mockAI,
+		GitHub: mockGitHub,
+		Notify: mockNotify,
+		Test:   mockTest,
+		Usage:  usage.NewLedger(nil, usage.Limits{MaxTokens: 1000}),
+	}
+
+	cfg := &config.Config{
+		Git: config.GitConfig{
+			InternalRepo: "https://github.com/test/internal.git",
+			UpstreamRepo: "https://github.com/test/upstream.git",
+			Branch:       "main",
+		},
+	}
+
+	ctx := context.Background()
+
+	conflicts := []interfaces.GitConflict{{File: "test.go", Content: "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n"}}
+	limitErr := fmt.Errorf("%w: 1000 of 1000 tokens used", usage.ErrLimitExceeded)
+
+	mockGit.On("Clone", ctx, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("SetConfig", ctx, mock.AnythingOfType("string"), "merge.conflictStyle", "zdiff3").Return(nil)
+	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
+	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("CreateBranch", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("Rebase", ctx, mock.AnythingOfType("string"), "upstream/main").Return(errors.New("rebase conflicts detected"))
+	mockGit.On("RebaseInProgress", ctx, mock.AnythingOfType("string")).Return(true, nil).Once()
+	mockGit.On("GetConflicts", ctx, mock.AnythingOfType("string")).Return(conflicts, nil)
+
+	// The conflict is committed with its markers
+	mockAI.On("ResolveConflict", ctx, conflicts[0]).Return(nil, limitErr)
+	mockGit.On("ResolveConflict", ctx, mock.AnythingOfType("string"), "test.go", conflicts[0].Content).Return(nil)
+	mockGit.On("ContinueRebase", ctx, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("RebaseInProgress", ctx, mock.AnythingOfType("string")).Return(false, nil)
+
+	mockGit.On("Push", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
+	mockAI.On("GeneratePRDescription", ctx, []string{}, mock.Anything).Return("", limitErr)
+
+	pr := &interfaces.PullRequest{Number: 125, HTMLURL: "https://github.com/test/internal/pull/125"}
+	mockGitHub.On("CreatePullRequest", ctx, mock.MatchedBy(func(req interfaces.CreatePRRequest) bool {
+		return req.Draft &&
+			strings.Contains(req.Body, "Some conflicts were left unresolved") &&
+			strings.Contains(req.Body, "- [ ] `test.go`: left unresolved for a human: AI usage limit reached") &&
+			strings.Contains(req.Body, "| `test.go` | both-modified | left unresolved for a human: AI usage limit reached |")
+	})).Return(pr, nil)
+	mockNotify.On("SendMessage", ctx, mock.MatchedBy(func(msg interfaces.NotificationMessage) bool {
+		return msg.Level == interfaces.NotificationLevelWarning && msg.ActionRequired && strings.Contains(msg.Message, "Draft PR #125")
+	})).Return(nil)
+
+	err := performRebase(ctx, cfg, services)
+
+	assert.NoError(t, err)
+	mockGit.AssertExpectations(t)
+	mockAI.AssertExpectations(t)
+	mockGitHub.AssertExpectations(t)
+	mockNotify.AssertExpectations(t)
+	mockTest.AssertNotCalled(t, "RunTests", mock.Anything, mock.Anything)
+}
+
+func TestPerformGitRebase_HandsOffFailedConflicts(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	services := &Services{Git: mockGit, AI: mockAI}
+
+	cfg := &config.Config{
+		Git:              config.GitConfig{Branch: "main", Handoff: config.HandoffSidecar},
+		ActualWorkingDir: "/tmp/test-handoff",
+	}
+	internalDir := "/tmp/test-handoff/internal"
+
+	ctx := context.Background()
+
+	content := "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n"
+	conflicts := []interfaces.GitConflict{
+		{File: "a.c", Content: content},
+		{File: "b.c", Content: content},
+	}
+
+	mockGit.On("CreateBranch", ctx, internalDir, "ai-rebase-test").Return(nil)
+	mockGit.On("Rebase", ctx, internalDir, "upstream/main").Return(errors.New("rebase conflicts detected"))
+	mockGit.On("RebaseInProgress", ctx, internalDir).Return(true, nil).Once()
+	mockGit.On("GetConflicts", ctx, internalDir).Return(conflicts, nil)
+
+	// The good resolution is kept
+	mockAI.On("ResolveConflict", ctx, conflicts[0]).Return(aiResolution("ab\n"), nil)
+	mockGit.On("ResolveConflict", ctx, internalDir, "a.c", "ab\n").Return(nil)
+
+	// The failed one is committed as upstream with the conflict in a sidecar
+	mockAI.On("ResolveConflict", ctx, conflicts[1]).Return(nil, errors.New("API unavailable"))
+	mockGit.On("CheckoutSide", ctx, internalDir, "b.c", interfaces.SideUpstream).Return(nil)
+	mockGit.On("ResolveConflict", ctx, internalDir, "b.c.rej", content).Return(nil)
+
+	mockGit.On("ContinueRebase", ctx, internalDir).Return(nil)
+	mockGit.On("RebaseInProgress", ctx, internalDir).Return(false, nil)
+
+	resolved, err := performGitRebase(ctx, cfg, services, "ai-rebase-test")
+
+	require.NoError(t, err)
+	require.Len(t, resolved, 2)
+	assert.Equal(t, "merged with AI", resolved[0].Action)
+	assert.False(t, resolved[0].Unresolved)
+	assert.Equal(t, "left unresolved for a human, conflict in b.c.rej: API unavailable", resolved[1].Action)
+	assert.True(t, resolved[1].Unresolved)
+	assert.False(t, resolved[1].ResolvedByAI)
+
+	assert.Equal(t, "## Needs a Human\n\n- [ ] `b.c`: left unresolved for a human, conflict in b.c.rej: API unavailable\n", formatHandoffChecklist(resolved))
+	mockGit.AssertExpectations(t)
+	mockAI.AssertExpectations(t)
+}
+
+// runGit runs git in dir with a fixed identity and fails the test on errors
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Dev", "GIT_AUTHOR_EMAIL=dev@example.com",
+		"GIT_COMMITTER_NAME=Dev", "GIT_COMMITTER_EMAIL=dev@example.com")
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %v: %s", args, output)
+	return string(output)
+}
+
+// commitFile writes file in the repository at dir and commits it
+func commitFile(t *testing.T, dir, file, content, message string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(content), 0644))
+	runGit(t, dir, "add", file)
+	runGit(t, dir, "commit", "-q", "-m", message)
+}
+
+func TestPerformGitRebase_HandsOffNestedConflicts(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Upstream and two internal patches all change the same line
+	workDir := t.TempDir()
+	upstreamDir := filepath.Join(workDir, "upstream")
+	internalDir := filepath.Join(workDir, "internal")
+	require.NoError(t, os.Mkdir(upstreamDir, 0755))
+	runGit(t, upstreamDir, "init", "-q", "-b", "main")
+	commitFile(t, upstreamDir, "a.c", "one\ntwo\nthree\n", "Add a.c")
+
+	runGit(t, workDir, "clone", "-q", upstreamDir, internalDir)
+	runGit(t, internalDir, "remote", "add", "upstream", upstreamDir)
+	commitFile(t, internalDir, "a.c", "one\ntwo internal\nthree\n", "Change two")
+	commitFile(t, internalDir, "a.c", "one\ntwo internal again\nthree\n", "Change two again")
+
+	commitFile(t, upstreamDir, "a.c", "one\ntwo upstream\nthree\n", "Change two upstream")
+	runGit(t, internalDir, "fetch", "-q", "upstream")
+
+	mockAI := &mocks.MockAIService{}
+	services := &Services{Git: git.NewService(), AI: mockAI}
+	cfg := &config.Config{
+		Git:              config.GitConfig{Branch: "main", Handoff: config.HandoffMarkers},
+		ActualWorkingDir: workDir,
+	}
+
+	ctx := context.Background()
+	limitErr := fmt.Errorf("%w: 1000 of 1000 tokens used", usage.ErrLimitExceeded)
+	mockAI.On("ResolveConflict", ctx, mock.Anything).Return(nil, limitErr)
+	mockAI.On("ResolveConflictHunk", ctx, mock.Anything, mock.Anything).Return(nil, limitErr)
+
+	resolved, err := performGitRebase(ctx, cfg, services, "ai-rebase-test")
+
+	require.NoError(t, err)
+	require.Len(t, resolved, 2)
+	for _, conflict := range resolved {
+		assert.Equal(t, "a.c", conflict.File)
+		assert.True(t, conflict.Unresolved)
+	}
+	assert.Contains(t, resolved[1].Action, "left unresolved for a human")
+
+	// Both patches are applied with the markers for a human to resolve
+	log := runGit(t, internalDir, "log", "--format=%s", "upstream/main..HEAD")
+	assert.Equal(t, "Change two again\nChange two\n", log)
+	data, err := os.ReadFile(filepath.Join(internalDir, "a.c"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "two internal again")
+	assert.Contains(t, string(data), "two upstream")
+}
+
 func TestPerformRebase_TestFailure(t *testing.T) {
 	// Setup mocks
 	mockGit := &mocks.MockGitService{}
@@ -223,7 +557,6 @@ func TestPerformRebase_TestFailure(t *testing.T) {
 
 	cfg := &config.Config{
 		Git: config.GitConfig{
-			WorkingDir:   "/tmp/test",
 			InternalRepo: "https://github.com/test/internal.git",
 			UpstreamRepo: "https://github.com/test/upstream.git",
 			Branch:       "main",
@@ -234,11 +567,12 @@ func TestPerformRebase_TestFailure(t *testing.T) {
 
 	// Mock setup expectations
 	mockGit.On("Clone", ctx, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("SetConfig", ctx, mock.AnythingOfType("string"), "merge.conflictStyle", "zdiff3").Return(nil)
 	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
 	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
 	mockGit.On("CreateBranch", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
 	mockGit.On("Rebase", ctx, mock.AnythingOfType("string"), "upstream/main").Return(nil)
-	mockGit.On("GetConflicts", ctx, mock.AnythingOfType("string")).Return([]interfaces.GitConflict{}, nil)
+	mockGit.On("RebaseInProgress", ctx, mock.AnythingOfType("string")).Return(false, nil)
 
 	// Mock test failure
 	testResult := &interfaces.TestResult{
@@ -263,66 +597,1499 @@ func TestPerformRebase_TestFailure(t *testing.T) {
 	mockNotify.AssertExpectations(t)
 }
 
-func TestSetupWorkingDirectory(t *testing.T) {
-	// Setup mocks
+func TestPerformGitRebase_MultipleStops(t *testing.T) {
 	mockGit := &mocks.MockGitService{}
-	services := &Services{Git: mockGit}
+	mockAI := &mocks.MockAIService{}
+	services := &Services{Git: mockGit, AI: mockAI}
 
 	cfg := &config.Config{
-		Git: config.GitConfig{
-			WorkingDir:   "/tmp/test-setup",
-			InternalRepo: "https://github.com/test/internal.git",
-			UpstreamRepo: "https://github.com/test/upstream.git",
-		},
+		Git:              config.GitConfig{Branch: "main"},
+		ActualWorkingDir: "/tmp/test-stops",
 	}
+	internalDir := "/tmp/test-stops/internal"
 
 	ctx := context.Background()
 
-	// Mock expectations
-	mockGit.On("Clone", ctx, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(nil)
-	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
-	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
+	first := []interfaces.GitConflict{{File: "a.c", Content: "a", Ours: "ours a", Theirs: "theirs a"}}
+	second := []interfaces.GitConflict{{File: "b.c", Content: "b", Ours: "ours b", Theirs: "theirs b"}}
 
-	// Execute
-	err := setupWorkingDirectory(ctx, cfg, services)
+	mockGit.On("CreateBranch", ctx, internalDir, "ai-rebase-test").Return(nil)
+	mockGit.On("Rebase", ctx, internalDir, "upstream/main").Return(errors.New("rebase conflicts detected"))
 
-	// Assert
-	assert.NoError(t, err)
+	// Stop 1: conflict in a.c, continuing stops on the next patch
+	mockGit.On("RebaseInProgress", ctx, internalDir).Return(true, nil).Times(3)
+	mockGit.On("GetConflicts", ctx, internalDir).Return(first, nil).Once()
+	mockAI.On("ResolveConflict", ctx, first[0]).Return(aiResolution("resolved a"), nil)
+	mockGit.On("ResolveConflict", ctx, internalDir, "a.c", "resolved a").Return(nil)
+	mockGit.On("ContinueRebase", ctx, internalDir).Return(errors.New("rebase conflicts detected")).Once()
+
+	// Stop 2: conflict in b.c
+	mockGit.On("GetConflicts", ctx, internalDir).Return(second, nil).Once()
+	mockAI.On("ResolveConflict", ctx, second[0]).Return(aiResolution("resolved b"), nil)
+	mockGit.On("ResolveConflict", ctx, internalDir, "b.c", "resolved b").Return(nil)
+	mockGit.On("ContinueRebase", ctx, internalDir).Return(nil).Once()
+
+	// Stop 3: no conflicts and nothing to commit, so the patch is skipped
+	mockGit.On("GetConflicts", ctx, internalDir).Return([]interfaces.GitConflict{}, nil).Once()
+	mockGit.On("ContinueRebase", ctx, internalDir).Return(errors.New("nothing to commit")).Once()
+	mockGit.On("SkipCommit", ctx, internalDir).Return(nil)
+
+	mockGit.On("RebaseInProgress", ctx, internalDir).Return(false, nil).Once()
+
+	conflicts, err := performGitRebase(ctx, cfg, services, "ai-rebase-test")
+
+	require.NoError(t, err)
+	require.Len(t, conflicts, 2)
+	assert.Equal(t, "a.c", conflicts[0].File)
+	assert.Equal(t, "b.c", conflicts[1].File)
+	assert.Equal(t, "merged with AI", conflicts[1].Action)
 	mockGit.AssertExpectations(t)
+	mockAI.AssertExpectations(t)
+}
 
-	// Cleanup
-	os.RemoveAll("/tmp/test-setup")
+func TestPerformGitRebase_ReplaysRerereResolutions(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	services := &Services{Git: mockGit, AI: mockAI}
+
+	cfg := &config.Config{
+		Git:              config.GitConfig{Branch: "main", Rerere: config.RerereConfig{Enabled: true}},
+		ActualWorkingDir: "/tmp/test-rerere",
+	}
+	internalDir := "/tmp/test-rerere/internal"
+
+	ctx := context.Background()
+
+	first := []interfaces.GitConflict{{File: "a.c", Content: "resolved by a human", Replayed: true}}
+	second := []interfaces.GitConflict{
+		{File: "b.c", Content: "resolved by a human", Replayed: true},
+		{File: "c.c", Content: "c", Ours: "ours c", Theirs: "theirs c"},
+	}
+
+	mockGit.On("CreateBranch", ctx, internalDir, "ai-rebase-test").Return(nil)
+	mockGit.On("Rebase", ctx, internalDir, "upstream/main").Return(errors.New("rebase conflicts detected"))
+	mockGit.On("RebaseInProgress", ctx, internalDir).Return(true, nil).Twice()
+
+	// Stop 1: rerere resolved everything, the AI is not asked
+	mockGit.On("GetConflicts", ctx, internalDir).Return(first, nil).Once()
+	mockGit.On("StageFile", ctx, internalDir, "a.c").Return(nil).Once()
+	mockGit.On("ContinueRebase", ctx, internalDir).Return(errors.New("rebase conflicts detected")).Once()
+
+	// Stop 2: the AI resolves the rest, which rerere must not record
+	mockGit.On("GetConflicts", ctx, internalDir).Return(second, nil).Once()
+	mockGit.On("StageFile", ctx, internalDir, "b.c").Return(nil).Once()
+	mockAI.On("ResolveConflict", ctx, second[1]).Return(aiResolution("resolved c"), nil).Once()
+	mockGit.On("ResolveConflict", ctx, internalDir, "c.c", "resolved c").Return(nil).Once()
+	mockGit.On("ClearRerere", ctx, internalDir).Return(nil).Once()
+	mockGit.On("ContinueRebase", ctx, internalDir).Return(nil).Once()
+
+	mockGit.On("RebaseInProgress", ctx, internalDir).Return(false, nil).Once()
+
+	conflicts, err := performGitRebase(ctx, cfg, services, "ai-rebase-test")
+
+	require.NoError(t, err)
+	require.Len(t, conflicts, 3)
+	assert.Equal(t, "replayed human resolution", conflicts[0].Action)
+	assert.False(t, conflicts[0].ResolvedByAI)
+	assert.Equal(t, "replayed human resolution", conflicts[1].Action)
+	assert.Equal(t, "merged with AI", conflicts[2].Action)
+	mockGit.AssertExpectations(t)
+	mockAI.AssertExpectations(t)
 }
 
-func TestSetupWorkingDirectory_CloneFallsBackToFetch(t *testing.T) {
-	// Setup mocks
+func TestPerformGitRebase_AbortsWhenResolutionFails(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	services := &Services{Git: mockGit, AI: mockAI}
+
+	cfg := &config.Config{
+		Git:              config.GitConfig{Branch: "main", Handoff: config.HandoffAbort},
+		ActualWorkingDir: "/tmp/test-abort",
+	}
+	internalDir := "/tmp/test-abort/internal"
+
+	ctx := context.Background()
+
+	conflicts := []interfaces.GitConflict{{File: "a.c", Content: "a", Ours: "ours", Theirs: "theirs"}}
+
+	mockGit.On("CreateBranch", ctx, internalDir, "ai-rebase-test").Return(nil)
+	mockGit.On("Rebase", ctx, internalDir, "upstream/main").Return(errors.New("rebase conflicts detected"))
+	mockGit.On("RebaseInProgress", ctx, internalDir).Return(true, nil)
+	mockGit.On("GetConflicts", ctx, internalDir).Return(conflicts, nil)
+	mockAI.On("ResolveConflict", ctx, conflicts[0]).Return(nil, errors.New("API unavailable"))
+	mockGit.On("AbortRebase", ctx, internalDir).Return(nil)
+
+	_, err := performGitRebase(ctx, cfg, services, "ai-rebase-test")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "conflict resolution failed")
+	mockGit.AssertExpectations(t)
+	mockAI.AssertExpectations(t)
+}
+
+func TestPerformGitRebase_FailsOnPatchThatCannotContinue(t *testing.T) {
 	mockGit := &mocks.MockGitService{}
 	services := &Services{Git: mockGit}
 
 	cfg := &config.Config{
-		Git: config.GitConfig{
-			WorkingDir:   "/tmp/test-setup-fallback",
-			InternalRepo: "https://github.com/test/internal.git",
-			UpstreamRepo: "https://github.com/test/upstream.git",
-		},
+		Git:              config.GitConfig{Branch: "main"},
+		ActualWorkingDir: "/tmp/test-stuck",
 	}
+	internalDir := "/tmp/test-stuck/internal"
 
 	ctx := context.Background()
 
-	// Mock expectations - clone fails, fetch succeeds
-	mockGit.On("Clone", ctx, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(errors.New("clone failed"))
-	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
-	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("CreateBranch", ctx, internalDir, "ai-rebase-test").Return(nil)
+	mockGit.On("Rebase", ctx, internalDir, "upstream/main").Return(errors.New("rebase conflicts detected"))
+	mockGit.On("RebaseInProgress", ctx, internalDir).Return(true, nil)
+	mockGit.On("GetConflicts", ctx, internalDir).Return([]interfaces.GitConflict{}, nil)
+	mockGit.On("ContinueRebase", ctx, internalDir).Return(errors.New("pre-commit hook failed"))
+	mockGit.On("AbortRebase", ctx, internalDir).Return(nil)
 
-	// Execute
-	err := setupWorkingDirectory(ctx, cfg, services)
+	_, err := performGitRebase(ctx, cfg, services, "ai-rebase-test")
 
-	// Assert
-	assert.NoError(t, err)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre-commit hook failed")
 	mockGit.AssertExpectations(t)
+	// The patch is not dropped from the rebased branch
+	mockGit.AssertNotCalled(t, "SkipCommit", mock.Anything, mock.Anything)
+}
 
-	// Cleanup
-	os.RemoveAll("/tmp/test-setup-fallback")
+func TestResolveConflictContent_HunkMode(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	services := &Services{AI: mockAI}
+	cfg := &config.Config{AI: config.AIConfig{ResolutionMode: config.ResolutionModeHunk}}
+
+	ctx := context.Background()
+
+	content := "keep 1\n<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\nkeep 2\n<<<<<<< HEAD\nc\n=======\nd\n>>>>>>> x\nkeep 3\n"
+	hunks, err := markers.Parse(content, markers.DefaultSize, 1)
+	require.NoError(t, err)
+	conflict := interfaces.GitConflict{File: "a.c", Content: content, Hunks: hunks}
+
+	mockAI.On("ResolveConflictHunk", ctx, conflict, hunks[0]).Return(aiResolution("ab"), nil)
+	mockAI.On("ResolveConflictHunk", ctx, conflict, hunks[1]).Return(aiResolution("cd"), nil)
+
+	resolved, err := resolveConflictContent(ctx, cfg, services, conflict)
+
+	require.NoError(t, err)
+	assert.Equal(t, "keep 1\nab\nkeep 2\ncd\nkeep 3\n", resolved.Resolution)
+	mockAI.AssertExpectations(t)
+}
+
+func TestResolveConflictContent_FileMode(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	services := &Services{AI: mockAI}
+	cfg := &config.Config{AI: config.AIConfig{ResolutionMode: config.ResolutionModeFile}}
+
+	ctx := context.Background()
+
+	conflict := interfaces.GitConflict{
+		File:    "a.c",
+		Content: "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n",
+		Hunks:   []interfaces.ConflictHunk{{StartLine: 1, EndLine: 5, Ours: "a", Theirs: "b"}},
+	}
+
+	mockAI.On("ResolveConflict", ctx, conflict).Return(aiResolution("ab\n"), nil)
+
+	resolved, err := resolveConflictContent(ctx, cfg, services, conflict)
+
+	require.NoError(t, err)
+	assert.Equal(t, "ab\n", resolved.Resolution)
+	mockAI.AssertExpectations(t)
+}
+
+func TestResolveConflictContent_FileTooLargeFallsBackToHunks(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	services := &Services{AI: mockAI}
+	cfg := &config.Config{AI: config.AIConfig{ResolutionMode: config.ResolutionModeFile}}
+
+	ctx := context.Background()
+
+	content := "keep\n<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\nkeep\n"
+	hunks, err := markers.Parse(content, markers.DefaultSize, 1)
+	require.NoError(t, err)
+	conflict := interfaces.GitConflict{File: "a.c", Content: content, Hunks: hunks}
+
+	mockAI.On("ResolveConflict", ctx, conflict).Return(nil, ai.ErrPromptTooLarge)
+	mockAI.On("ResolveConflictHunk", ctx, conflict, hunks[0]).Return(aiResolution("ab"), nil)
+
+	resolved, err := resolveConflictContent(ctx, cfg, services, conflict)
+
+	require.NoError(t, err)
+	assert.Equal(t, "keep\nab\nkeep\n", resolved.Resolution)
+	mockAI.AssertExpectations(t)
+}
+
+func TestResolveConflictContent_PromptTooLargeNeedsHuman(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	services := &Services{AI: mockAI}
+	cfg := &config.Config{AI: config.AIConfig{
+		ResolutionMode: config.ResolutionModeHunk,
+		Validation:     config.ValidationConfig{MaxRetries: 2},
+	}}
+
+	ctx := context.Background()
+
+	content := "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n"
+	hunks, err := markers.Parse(content, markers.DefaultSize, 0)
+	require.NoError(t, err)
+	conflict := interfaces.GitConflict{File: "a.c", Content: content, Hunks: hunks}
+
+	mockAI.On("ResolveConflictHunk", ctx, conflict, hunks[0]).Return(nil, ai.ErrPromptTooLarge).Once()
+
+	_, err = resolveConflictContent(ctx, cfg, services, conflict)
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errNeedsHuman))
+	mockAI.AssertExpectations(t)
+}
+
+func TestResolveConflictContent_NoConsensusNeedsHuman(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	services := &Services{AI: mockAI}
+	cfg := &config.Config{AI: config.AIConfig{
+		ResolutionMode: config.ResolutionModeFile,
+		Validation:     config.ValidationConfig{MaxRetries: 2},
+	}}
+
+	ctx := context.Background()
+	conflict := interfaces.GitConflict{File: "src/Kconfig", Content: "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n"}
+
+	mockAI.On("ResolveConflict", ctx, conflict).Return(nil, fmt.Errorf("resolution of src/Kconfig: %w", ai.ErrNoConsensus)).Once()
+
+	_, err := resolveConflictContent(ctx, cfg, services, conflict)
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errNeedsHuman))
+	mockAI.AssertExpectations(t)
+}
+
+func TestResolveConflictContent_RetriesWithFeedback(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	services := &Services{AI: mockAI}
+	cfg := &config.Config{AI: config.AIConfig{
+		ResolutionMode: config.ResolutionModeHunk,
+		Validation:     config.ValidationConfig{MaxRetries: 2},
+	}}
+
+	ctx := context.Background()
+
+	content := "keep\n<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\nkeep\n"
+	hunks, err := markers.Parse(content, markers.DefaultSize, 1)
+	require.NoError(t, err)
+	conflict := interfaces.GitConflict{File: "a.c", Content: content, Hunks: hunks}
+
+	// First attempt is cut off, second keeps a marker, third is fenced but valid
+	mockAI.On("ResolveConflictHunk", ctx, conflict, hunks[0]).Return(nil, ai.ErrTruncated).Once()
+	mockAI.On("ResolveConflictHunk", ctx, mock.MatchedBy(func(c interfaces.GitConflict) bool {
+		return len(c.Feedback) == 1
+	}), hunks[0]).Return(aiResolution("<<<<<<< HEAD\na"), nil).Once()
+	mockAI.On("ResolveConflictHunk", ctx, mock.MatchedBy(func(c interfaces.GitConflict) bool {
+		return len(c.Feedback) == 2 && strings.Contains(c.Feedback[1], "conflict marker")
+	}), hunks[0]).Return(aiResolution("```c\nab\n```"), nil).Once()
+
+	resolved, err := resolveConflictContent(ctx, cfg, services, conflict)
+
+	require.NoError(t, err)
+	assert.Equal(t, "keep\nab\nkeep\n", resolved.Resolution)
+	mockAI.AssertExpectations(t)
+}
+
+func TestResolveConflictContent_GivesUpAfterRetries(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	services := &Services{AI: mockAI}
+	cfg := &config.Config{AI: config.AIConfig{
+		ResolutionMode: config.ResolutionModeFile,
+		Validation:     config.ValidationConfig{MaxRetries: 1},
+	}}
+
+	ctx := context.Background()
+
+	conflict := interfaces.GitConflict{File: "a.c", Content: "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n"}
+
+	mockAI.On("ResolveConflict", ctx, mock.AnythingOfType("interfaces.GitConflict")).Return(aiResolution(">>>>>>> x"), nil).Times(2)
+
+	_, err := resolveConflictContent(ctx, cfg, services, conflict)
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errUnresolved))
+	assert.Contains(t, err.Error(), "after 2 attempts")
+	mockAI.AssertExpectations(t)
+}
+
+func TestResolveConflictContent_DoesNotRetryAPIErrors(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	services := &Services{AI: mockAI}
+	cfg := &config.Config{AI: config.AIConfig{Validation: config.ValidationConfig{MaxRetries: 3}}}
+
+	ctx := context.Background()
+	conflict := interfaces.GitConflict{File: "a.c", Content: "x"}
+
+	mockAI.On("ResolveConflict", ctx, conflict).Return(nil, errors.New("API unavailable")).Once()
+
+	_, err := resolveConflictContent(ctx, cfg, services, conflict)
+
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, errUnresolved))
+	mockAI.AssertExpectations(t)
+}
+
+func TestValidateResolution_SyntaxChecks(t *testing.T) {
+	if !validate.HasSyntaxCheck("main.go") {
+		t.Skip("gofmt is not installed")
+	}
+	cfg := &config.Config{AI: config.AIConfig{Validation: config.ValidationConfig{SyntaxChecks: true}}}
+	ctx := context.Background()
+
+	content := "package main\n\n<<<<<<< HEAD\nfunc a() {}\n=======\nfunc b() {}\n>>>>>>> x\n"
+	hunks, err := markers.Parse(content, markers.DefaultSize, 0)
+	require.NoError(t, err)
+	conflict := interfaces.GitConflict{File: "main.go", Content: content, Hunks: hunks}
+
+	assert.NoError(t, validateResolution(ctx, cfg, conflict, "package main\n\nfunc a() {}\nfunc b() {}\n"))
+
+	err = validateResolution(ctx, cfg, conflict, "package main\n\nfunc a() {\nfunc b() {}\n")
+	assert.True(t, errors.Is(err, errInvalidResolution))
+}
+
+func TestResolveConflictsWithAI_ConflictTypes(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	services := &Services{Git: mockGit, AI: mockAI}
+
+	cfg := &config.Config{ActualWorkingDir: "/tmp/test-types"}
+	internalDir := "/tmp/test-types/internal"
+
+	ctx := context.Background()
+
+	conflicts := []interfaces.GitConflict{
+		{File: "board/gpio.c", Type: interfaces.ConflictDeletedByUs, Content: "internal", Theirs: "internal"},
+		{File: "board/old.c", Type: interfaces.ConflictDeletedByThem, Content: "upstream", Ours: "upstream"},
+		{File: "soc/new.c", Type: interfaces.ConflictRenamed, RenamedFrom: "soc/old.c", RenamedTo: "soc/int.c", Content: "merged"},
+		{File: "soc/added.c", Type: interfaces.ConflictAddedByBoth, Content: "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n"},
+	}
+
+	mockGit.On("CheckoutSide", ctx, internalDir, "board/gpio.c", interfaces.SideInternal).Return(nil)
+	mockGit.On("RemoveFile", ctx, internalDir, "board/old.c").Return(nil)
+
+	// The renamed file merged cleanly, so no AI is involved
+	mockGit.On("ResolveConflict", ctx, internalDir, "soc/new.c", "merged").Return(nil)
+	mockGit.On("RemoveFile", ctx, internalDir, "soc/old.c").Return(nil)
+	mockGit.On("RemoveFile", ctx, internalDir, "soc/int.c").Return(nil)
+
+	mockAI.On("ResolveConflict", ctx, conflicts[3]).Return(aiResolution("ab\n"), nil)
+	mockGit.On("ResolveConflict", ctx, internalDir, "soc/added.c", "ab\n").Return(nil)
+
+	resolved, err := resolveConflictsWithAI(ctx, cfg, services, conflicts)
+
+	require.NoError(t, err)
+	require.Len(t, resolved, 4)
+	assert.Equal(t, "kept internal version, the file was deleted upstream", resolved[0].Action)
+	assert.Equal(t, "deleted, the internal patch removes the file", resolved[1].Action)
+	assert.Equal(t, "merged into the upstream path, internal patch renamed it to soc/int.c", resolved[2].Action)
+	assert.Equal(t, "merged with AI", resolved[3].Action)
+	mockGit.AssertExpectations(t)
+	mockAI.AssertExpectations(t)
+}
+
+func TestResolveConflictsWithAI_ConfidenceThresholds(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	services := &Services{Git: mockGit, AI: mockAI}
+
+	cfg := &config.Config{
+		ActualWorkingDir: "/tmp/test-confidence",
+		AI: config.AIConfig{
+			ResolutionMode: config.ResolutionModeFile,
+			Confidence:     config.ConfidenceConfig{AutoApply: 0.8, Review: 0.5},
+		},
+	}
+	internalDir := "/tmp/test-confidence/internal"
+
+	ctx := context.Background()
+
+	content := "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n"
+	conflicts := []interfaces.GitConflict{
+		{File: "sure.c", Content: content},
+		{File: "unsure.c", Content: content},
+		{File: "guess.c", Content: content},
+	}
+
+	unsure := aiResolution("ab\n")
+	unsure.Confidence = 0.6
+	guess := aiResolution("ba\n")
+	guess.Confidence = 0.2
+
+	mockAI.On("ResolveConflict", ctx, conflicts[0]).Return(aiResolution("ab\n"), nil)
+	mockAI.On("ResolveConflict", ctx, conflicts[1]).Return(unsure, nil)
+	mockAI.On("ResolveConflict", ctx, conflicts[2]).Return(guess, nil).Once()
+	mockGit.On("ResolveConflict", ctx, internalDir, "sure.c", "ab\n").Return(nil)
+	mockGit.On("ResolveConflict", ctx, internalDir, "unsure.c", "ab\n").Return(nil)
+	// The guess is not applied, the file is staged with its conflict markers
+	mockGit.On("ResolveConflict", ctx, internalDir, "guess.c", content).Return(nil)
+
+	resolved, err := resolveConflictsWithAI(ctx, cfg, services, conflicts)
+
+	require.NoError(t, err)
+	require.Len(t, resolved, 3)
+	assert.Equal(t, "merged with AI", resolved[0].Action)
+	assert.Equal(t, 0.9, resolved[0].Resolution.Confidence)
+	assert.Equal(t, "merged with AI, flagged for review (confidence 0.60)", resolved[1].Action)
+	assert.True(t, resolved[1].ResolvedByAI)
+	assert.Equal(t, "left unresolved for a human: AI confidence 0.20 is below the review threshold of 0.50", resolved[2].Action)
+	assert.True(t, resolved[2].Unresolved)
+	assert.Nil(t, resolved[2].Resolution)
+	mockGit.AssertExpectations(t)
+	mockAI.AssertExpectations(t)
+}
+
+func TestCombineResolutions(t *testing.T) {
+	hunks := []interfaces.ConflictHunk{{StartLine: 1, EndLine: 5}, {StartLine: 10, EndLine: 14}}
+	combined := combineResolutions("merged", hunks, []*interfaces.ConflictResolution{
+		{Resolution: "a", Confidence: 0.9, Strategy: interfaces.StrategyOurs, Rationale: "Upstream only reformatted", Risks: []string{"whitespace"}},
+		{Resolution: "b", Confidence: 0.7, Strategy: interfaces.StrategyTheirs, Rationale: "Upstream fixed the bug"},
+	})
+
+	assert.Equal(t, &interfaces.ConflictResolution{
+		Resolution: "merged",
+		Confidence: 0.7,
+		Strategy:   interfaces.StrategyCombined,
+		Rationale:  "lines 1-5: Upstream only reformatted; lines 10-14: Upstream fixed the bug",
+		Risks:      []string{"whitespace"},
+	}, combined)
+}
+
+func TestResolveConflictsWithAI_ConflictPolicies(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockTest := &mocks.MockTestService{}
+	services := &Services{Git: mockGit, AI: mockAI, Test: mockTest}
+
+	cfg := &config.Config{
+		ActualWorkingDir: t.TempDir(),
+		Git: config.GitConfig{
+			ConflictPolicies: []config.ConflictPolicy{
+				{Name: "blobs", Binary: true, Patterns: []string{"3rdparty/blobs/**"}, Action: config.PolicyTakeUpstream},
+				{Name: "generated", Patterns: []string{"build/generated/*.h"}, Action: config.PolicyRegenerate, Command: "make", Args: []string{"headers"}},
+				{Name: "lockfiles", Patterns: []string{"*.lock"}, Action: config.PolicyTakeInternal},
+			},
+		},
+	}
+	internalDir := filepath.Join(cfg.ActualWorkingDir, "internal")
+	require.NoError(t, os.MkdirAll(filepath.Join(internalDir, "build/generated"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(internalDir, "build/generated/config.h"), []byte("#define CONFIG 1\n"), 0644))
+	// gpio.h was deleted by the generator
+
+	ctx := context.Background()
+
+	conflicts := []interfaces.GitConflict{
+		{File: "src/mainboard/acme/data.vbt", Type: interfaces.ConflictBothModified, Binary: true},
+		{File: "3rdparty/blobs/fsp.fd", Type: interfaces.ConflictDeletedByUs, Binary: true},
+		{File: "build/generated/config.h", Type: interfaces.ConflictBothModified},
+		{File: "build/generated/gpio.h", Type: interfaces.ConflictBothModified},
+		{File: "util/deps.lock", Type: interfaces.ConflictDeletedByThem},
+	}
+
+	mockGit.On("CheckoutSide", ctx, internalDir, "src/mainboard/acme/data.vbt", interfaces.SideUpstream).Return(nil)
+	// Taking upstream for a file upstream deleted means deleting it
+	mockGit.On("RemoveFile", ctx, internalDir, "3rdparty/blobs/fsp.fd").Return(nil)
+
+	// The generator runs only once for both generated files
+	mockTest.On("RunCommand", ctx, mock.MatchedBy(func(cmd interfaces.TestCommand) bool {
+		return cmd.Command == "make" && cmd.WorkingDir == internalDir
+	})).Return(&interfaces.CommandResult{Success: true}, nil).Once()
+	mockGit.On("StageFile", ctx, internalDir, "build/generated/config.h").Return(nil)
+	mockGit.On("StageFile", ctx, internalDir, "build/generated/gpio.h").Return(nil)
+
+	mockGit.On("RemoveFile", ctx, internalDir, "util/deps.lock").Return(nil)
+
+	resolved, err := resolveConflictsWithAI(ctx, cfg, services, conflicts)
+
+	require.NoError(t, err)
+	require.Len(t, resolved, 5)
+	assert.Equal(t, "policy blobs: took upstream version", resolved[0].Action)
+	assert.Equal(t, "policy blobs: took upstream version", resolved[1].Action)
+	assert.Equal(t, "policy generated: regenerated with `make headers`", resolved[2].Action)
+	assert.Equal(t, "policy generated: regenerated with `make headers`", resolved[3].Action)
+	assert.Equal(t, "policy lockfiles: took internal version", resolved[4].Action)
+	mockGit.AssertExpectations(t)
+	mockTest.AssertExpectations(t)
+	mockAI.AssertNotCalled(t, "ResolveConflict", mock.Anything, mock.Anything)
+}
+
+func TestResolveConflictsWithAI_RegenerateLeavesMarkers(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockTest := &mocks.MockTestService{}
+	services := &Services{Git: mockGit, Test: mockTest}
+
+	cfg := &config.Config{
+		ActualWorkingDir: t.TempDir(),
+		Git: config.GitConfig{
+			ConflictPolicies: []config.ConflictPolicy{
+				{Name: "generated", Patterns: []string{"build/generated/*.h"}, Action: config.PolicyRegenerate, Command: "make", Args: []string{"headers"}},
+			},
+			Handoff: config.HandoffMarkers,
+		},
+	}
+	internalDir := filepath.Join(cfg.ActualWorkingDir, "internal")
+
+	// The generator rewrites config.h but leaves gpio.h alone
+	gpio := "<<<<<<< HEAD\n#define GPIO 1\n=======\n#define GPIO 2\n>>>>>>> abc123\n"
+	require.NoError(t, os.MkdirAll(filepath.Join(internalDir, "build/generated"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(internalDir, "build/generated/config.h"), []byte("#define CONFIG 1\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(internalDir, "build/generated/gpio.h"), []byte(gpio), 0644))
+
+	ctx := context.Background()
+	conflicts := []interfaces.GitConflict{
+		{File: "build/generated/config.h", Type: interfaces.ConflictBothModified},
+		{File: "build/generated/gpio.h", Type: interfaces.ConflictBothModified, Content: gpio},
+	}
+
+	mockTest.On("RunCommand", ctx, mock.AnythingOfType("interfaces.TestCommand")).Return(&interfaces.CommandResult{Success: true}, nil)
+	mockGit.On("StageFile", ctx, internalDir, "build/generated/config.h").Return(nil)
+	mockGit.On("ResolveConflict", ctx, internalDir, "build/generated/gpio.h", gpio).Return(nil)
+
+	resolved, err := resolveConflictsWithAI(ctx, cfg, services, conflicts)
+
+	require.NoError(t, err)
+	require.Len(t, resolved, 2)
+	assert.False(t, resolved[0].Unresolved)
+	assert.True(t, resolved[1].Unresolved)
+	assert.Contains(t, resolved[1].Action, "`make headers` did not regenerate build/generated/gpio.h")
+	mockGit.AssertExpectations(t)
+	mockTest.AssertNumberOfCalls(t, "RunCommand", 1)
+	mockGit.AssertNotCalled(t, "StageFile", ctx, internalDir, "build/generated/gpio.h")
+
+	// Without a handoff the run fails instead
+	cfg.Git.Handoff = config.HandoffAbort
+	_, err = resolveConflictsWithAI(ctx, cfg, services, conflicts[1:])
+	assert.ErrorContains(t, err, "did not regenerate build/generated/gpio.h")
+}
+
+func TestResolveConflictsWithAI_BinaryWithoutPolicy(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	services := &Services{AI: mockAI}
+	cfg := &config.Config{ActualWorkingDir: "/tmp/test-binary"}
+
+	conflicts := []interfaces.GitConflict{{File: "blob.bin", Type: interfaces.ConflictBothModified, Binary: true}}
+
+	_, err := resolveConflictsWithAI(context.Background(), cfg, services, conflicts)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no matching conflict policy")
+	mockAI.AssertNotCalled(t, "ResolveConflict", mock.Anything, mock.Anything)
+}
+
+func TestFormatResolutionSummary(t *testing.T) {
+	assert.Empty(t, formatResolutionSummary(nil))
+
+	summary := formatResolutionSummary([]interfaces.GitConflict{
+		{File: "a.c", Action: "merged with AI"},
+		{File: "b.c", Type: interfaces.ConflictDeletedByThem, Action: "deleted, the internal patch removes the file"},
+	})
+
+	assert.Contains(t, summary, "## Conflict Resolutions")
+	assert.Contains(t, summary, "| `a.c` | both-modified | merged with AI |")
+	assert.Contains(t, summary, "| `b.c` | deleted-by-them | deleted, the internal patch removes the file |")
+	assert.NotContains(t, summary, "### ")
+
+	resolution := aiResolution("ab")
+	resolution.Risks = []string{"Check the new timeout"}
+	summary = formatResolutionSummary([]interfaces.GitConflict{
+		{File: "a.c", Action: "merged with AI", ResolvedByAI: true, Resolution: resolution},
+	})
+
+	assert.Contains(t, summary, "| `a.c` | both-modified | merged with AI |")
+	assert.Contains(t, summary, "### `a.c`\n\n- **Strategy:** combined\n- **Confidence:** 0.90\n- **Rationale:** Kept the changes of both sides\n- **Risks:**\n  - Check the new timeout\n")
+}
+
+func TestFormatUsageSummary(t *testing.T) {
+	ledger := usage.NewLedger(map[string]usage.Price{"gpt-4": {Input: 30, Output: 60}}, usage.Limits{})
+	assert.Empty(t, formatUsageSummary(ledger))
+
+	ledger.Record(usage.Record{Operation: "resolve_conflict", File: "a.c", Model: "gpt-4", InputTokens: 10000, OutputTokens: 1000})
+	ledger.Record(usage.Record{Operation: "pr_description", Model: "gpt-4", InputTokens: 2000, OutputTokens: 500})
+
+	summary := formatUsageSummary(ledger)
+	assert.Contains(t, summary, "## AI Usage")
+	assert.Contains(t, summary, "| resolve_conflict | 1 | 10000 | 1000 | $0.36 |")
+	assert.Contains(t, summary, "| **Total** | 2 | 12000 | 1500 | $0.45 |")
+	assert.Equal(t, "2 calls, 13500 tokens, $0.45", formatUsageTotals(ledger.Totals()))
+}
+
+func TestFormatReviewFindings(t *testing.T) {
+	assert.Empty(t, formatReviewFindings(nil))
+
+	summary := formatReviewFindings([]interfaces.ReviewFinding{
+		{File: "src/gpio.c", Line: 12, Severity: interfaces.SeverityError, Category: interfaces.CategoryDuplicateDefinition, Message: "gpio_init is defined twice"},
+		{File: "src/Kconfig", Severity: interfaces.SeverityInfo, Category: interfaces.CategoryOther, Message: "Help text was reworded"},
+	})
+
+	assert.Equal(t, "\n\n## AI Review\n\n"+
+		"- **error** `src/gpio.c:12` (duplicate definition): gpio_init is defined twice\n"+
+		"- **info** `src/Kconfig` (other): Help text was reworded\n", summary)
+}
+
+func TestReviewRebase(t *testing.T) {
+	conflicts := []interfaces.GitConflict{
+		{File: "src/gpio.c", Action: "merged with AI", ResolvedByAI: true},
+		{File: "src/gpio.c", Action: "merged with AI", ResolvedByAI: true},
+		{File: "src/soc.c", Action: "left unresolved for a human", Unresolved: true},
+	}
+	findings := []interfaces.ReviewFinding{
+		{File: "src/gpio.c", Line: 12, Severity: interfaces.SeverityWarning, Category: interfaces.CategoryLostChange, Message: "The internal pull-up is gone"},
+	}
+
+	tests := map[string]struct {
+		review  config.ReviewConfig
+		aiErr   error
+		want    []interfaces.ReviewFinding
+		wantErr string
+	}{
+		"disabled":           {review: config.ReviewConfig{}},
+		"findings":           {review: config.ReviewConfig{Enabled: true, BlockOn: config.SeverityError}, want: findings},
+		"blocking":           {review: config.ReviewConfig{Enabled: true, BlockOn: config.SeverityWarning}, want: findings, wantErr: "warning src/gpio.c:12 (lost change): The internal pull-up is gone"},
+		"AI failure ignored": {review: config.ReviewConfig{Enabled: true, BlockOn: config.SeverityInfo}, aiErr: errors.New("connection refused")},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockGit := &mocks.MockGitService{}
+			mockAI := &mocks.MockAIService{}
+			services := &Services{Git: mockGit, AI: mockAI}
+			cfg := &config.Config{
+				ActualWorkingDir: "/tmp/work",
+				Git:              config.GitConfig{Branch: "main"},
+				AI:               config.AIConfig{Review: tt.review},
+			}
+
+			ctx := context.Background()
+			if tt.review.Enabled {
+				mockGit.On("Diff", ctx, "/tmp/work/internal", "upstream/main", "HEAD", []string{"src/gpio.c"}).Return("diff --git a/src/gpio.c b/src/gpio.c\n", nil).Once()
+				mockAI.On("ReviewRebase", ctx, interfaces.ReviewRequest{Diff: "diff --git a/src/gpio.c b/src/gpio.c\n", Conflicts: conflicts}).Return(tt.want, tt.aiErr).Once()
+			}
+
+			got, err := reviewRebase(ctx, cfg, services, conflicts)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, got)
+
+			mockGit.AssertExpectations(t)
+			mockAI.AssertExpectations(t)
+		})
+	}
+}
+
+func TestMergeRebasePRs(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockGitHub := &mocks.MockGitHubService{}
+	mockNotify := &mocks.MockNotifyService{}
+	services := &Services{Git: mockGit, GitHub: mockGitHub, Notify: mockNotify}
+
+	cfg := &config.Config{
+		Git: config.GitConfig{
+			UpstreamRepo: "https://github.com/test/upstream.git",
+			Branch:       "main",
+		},
+		GitHub: config.GitHubConfig{
+			AutoMerge:      true,
+			AutoMergeDelay: 24 * time.Hour,
+			MergeMethod:    config.MergeMethodSquash,
+		},
+	}
+
+	ctx := context.Background()
+	quiet := time.Now().Add(-25 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	created := quiet.Add(-time.Hour).UTC().Format(time.RFC3339)
+	// Labels and status updates keep bumping UpdatedAt, they do not count
+	updated := recent.UTC().Format(time.RFC3339)
+
+	prs := []*interfaces.PullRequest{
+		{Number: 1, Head: "feature", Base: "main", CreatedAt: created, UpdatedAt: updated},
+		{Number: 2, Head: "ai-rebase-2", Base: "main", CreatedAt: created, UpdatedAt: updated, Draft: true},
+		{Number: 3, Head: "ai-rebase-3", HeadSHA: "sha3", Base: "main", CreatedAt: created, UpdatedAt: updated},
+		{Number: 4, Head: "ai-rebase-4", HeadSHA: "sha4", Base: "main", CreatedAt: created, UpdatedAt: updated, HTMLURL: "https://github.com/test/internal/pull/4"},
+		{Number: 5, Head: "ai-rebase-5", HeadSHA: "sha5", Base: "main", CreatedAt: created, UpdatedAt: updated},
+		{Number: 6, Head: "ai-rebase-6", HeadSHA: "sha6", Base: "main", CreatedAt: created, UpdatedAt: updated},
+	}
+	mockGitHub.On("ListPullRequests", ctx, "open").Return(prs, nil)
+	// #3 was commented on an hour ago
+	mockGitHub.On("LastActivity", ctx, 3, "sha3").Return(recent, nil)
+	for _, number := range []int{4, 5, 6} {
+		mockGitHub.On("LastActivity", ctx, number, fmt.Sprintf("sha%d", number)).Return(quiet, nil)
+	}
+	mockGit.On("RemoteHead", ctx, cfg.Git.UpstreamRepo, "main").Return("upstream-sha", nil).Once()
+
+	// #4 is clean and merged
+	mockGitHub.On("ChangesRequested", ctx, 4).Return(false, nil)
+	mockGitHub.On("CheckState", ctx, "sha4").Return(interfaces.CheckSuccess, nil)
+	mockGitHub.On("ContainsCommit", ctx, "sha4", "upstream-sha").Return(true, nil)
+	mockGitHub.On("MergePullRequest", ctx, 4, "squash").Return(nil)
+	mockNotify.On("SendMessage", ctx, mock.MatchedBy(func(msg interfaces.NotificationMessage) bool {
+		return msg.Title == "AI Rebaser - PR Merged" && msg.URL == prs[3].HTMLURL
+	})).Return(nil).Once()
+
+	// #5 has every problem at once
+	mockGitHub.On("ChangesRequested", ctx, 5).Return(true, nil)
+	mockGitHub.On("CheckState", ctx, "sha5").Return(interfaces.CheckFailure, nil)
+	mockGitHub.On("ContainsCommit", ctx, "sha5", "upstream-sha").Return(false, nil)
+	mockNotify.On("SendMessage", ctx, mock.MatchedBy(func(msg interfaces.NotificationMessage) bool {
+		return msg.Title == "AI Rebaser - Auto-Merge Refused" &&
+			strings.Contains(msg.Message, "#5") &&
+			strings.Contains(msg.Message, "a reviewer requested changes; checks failed; upstream has new commits")
+	})).Return(nil).Once()
+
+	// #6 is refused by GitHub
+	mockGitHub.On("ChangesRequested", ctx, 6).Return(false, nil)
+	mockGitHub.On("CheckState", ctx, "sha6").Return(interfaces.CheckSuccess, nil)
+	mockGitHub.On("ContainsCommit", ctx, "sha6", "upstream-sha").Return(true, nil)
+	mockGitHub.On("MergePullRequest", ctx, 6, "squash").Return(errors.New("pull request #6 is not mergeable"))
+	mockNotify.On("SendMessage", ctx, mock.MatchedBy(func(msg interfaces.NotificationMessage) bool {
+		return msg.Title == "AI Rebaser - Auto-Merge Refused" && strings.Contains(msg.Message, "merging failed: pull request #6 is not mergeable")
+	})).Return(nil).Once()
+
+	mergeRebasePRs(ctx, cfg, services)
+
+	mockGit.AssertExpectations(t)
+	mockGitHub.AssertExpectations(t)
+	mockNotify.AssertExpectations(t)
+	for _, number := range []int{1, 2, 3} {
+		mockGitHub.AssertNotCalled(t, "ChangesRequested", ctx, number)
+	}
+	mockGitHub.AssertNotCalled(t, "MergePullRequest", ctx, 5, mock.Anything)
+}
+
+func TestMergeRebasePRs_CountsWorkingTime(t *testing.T) {
+	mockGitHub := &mocks.MockGitHubService{}
+	workCalendar, err := calendar.New(calendar.Options{
+		Days:     []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"},
+		Start:    "09:00",
+		End:      "10:00",
+		TimeZone: "UTC",
+	})
+	require.NoError(t, err)
+	services := &Services{GitHub: mockGitHub, Calendar: workCalendar}
+
+	cfg := &config.Config{
+		Git:    config.GitConfig{Branch: "main"},
+		GitHub: config.GitHubConfig{AutoMerge: true, AutoMergeDelay: 24 * time.Hour},
+	}
+
+	// Two days without activity are only two hours of working time
+	ctx := context.Background()
+	active := time.Now().Add(-48 * time.Hour)
+	mockGitHub.On("ListPullRequests", ctx, "open").Return([]*interfaces.PullRequest{
+		{Number: 1, Head: "ai-rebase-1", HeadSHA: "sha1", Base: "main"},
+	}, nil)
+	mockGitHub.On("LastActivity", ctx, 1, "sha1").Return(active, nil)
+
+	mergeRebasePRs(ctx, cfg, services)
+
+	mockGitHub.AssertNotCalled(t, "ChangesRequested", mock.Anything, mock.Anything)
+}
+
+func TestOutsideWorkingHours(t *testing.T) {
+	workCalendar, err := calendar.New(calendar.Options{
+		Days:     []string{"mon", "tue", "wed", "thu", "fri"},
+		Start:    "09:00",
+		End:      "17:00",
+		TimeZone: "UTC",
+	})
+	require.NoError(t, err)
+	services := &Services{Calendar: workCalendar}
+	cfg := &config.Config{Calendar: config.CalendarConfig{Enabled: true, WorkingHoursOnly: true}}
+
+	saturday := time.Date(2025, 10, 11, 12, 0, 0, 0, time.UTC)
+	monday := time.Date(2025, 10, 13, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, outsideWorkingHours(cfg, services, saturday))
+	assert.False(t, outsideWorkingHours(cfg, services, monday))
+
+	cfg.Calendar.WorkingHoursOnly = false
+	assert.False(t, outsideWorkingHours(cfg, services, saturday))
+}
+
+func TestLastActivity(t *testing.T) {
+	mockGitHub := &mocks.MockGitHubService{}
+	services := &Services{GitHub: mockGitHub}
+
+	ctx := context.Background()
+	created := time.Date(2025, 10, 6, 9, 0, 0, 0, time.UTC)
+	commented := created.Add(2 * time.Hour)
+	mockGitHub.On("LastActivity", ctx, 1, "sha1").Return(commented, nil)
+	mockGitHub.On("LastActivity", ctx, 2, "sha2").Return(time.Time{}, nil)
+	mockGitHub.On("LastActivity", ctx, 3, "sha3").Return(time.Time{}, errors.New("rate limited"))
+
+	active, err := lastActivity(ctx, services, &interfaces.PullRequest{Number: 1, HeadSHA: "sha1", CreatedAt: created.Format(time.RFC3339)})
+	require.NoError(t, err)
+	assert.Equal(t, commented, active)
+
+	// Nothing happened since the PR was opened
+	active, err = lastActivity(ctx, services, &interfaces.PullRequest{Number: 2, HeadSHA: "sha2", CreatedAt: created.Format(time.RFC3339)})
+	require.NoError(t, err)
+	assert.True(t, created.Equal(active))
+
+	_, err = lastActivity(ctx, services, &interfaces.PullRequest{Number: 3, HeadSHA: "sha3"})
+	assert.Error(t, err)
+}
+
+func TestMergeRebasePRs_Disabled(t *testing.T) {
+	mockGitHub := &mocks.MockGitHubService{}
+	services := &Services{GitHub: mockGitHub}
+
+	mergeRebasePRs(context.Background(), &config.Config{}, services)
+
+	mockGitHub.AssertNotCalled(t, "ListPullRequests", mock.Anything, mock.Anything)
+}
+
+func TestCreatePullRequest_SupersedeUpdate(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockGitHub := &mocks.MockGitHubService{}
+	services := &Services{Git: mockGit, AI: mockAI, GitHub: mockGitHub}
+
+	cfg := &config.Config{
+		Git:              config.GitConfig{Branch: "main"},
+		GitHub:           config.GitHubConfig{SupersedePolicy: config.SupersedeUpdate, ReviewersTeam: "core-team"},
+		ActualWorkingDir: "/tmp/work",
+	}
+
+	ctx := context.Background()
+	mockGitHub.On("ListPullRequests", ctx, "open").Return([]*interfaces.PullRequest{
+		{Number: 3, Head: "ai-rebase-3", HeadSHA: "sha3", Base: "main"},
+		{Number: 4, Head: "feature", Base: "main"},
+		{Number: 7, Head: "ai-rebase-7", HeadSHA: "sha7", Base: "main"},
+		{Number: 8, Head: "ai-rebase-8", Base: "release"},
+	}, nil)
+	mockGit.On("CommitsByOthers", ctx, "/tmp/work/internal", "upstream/main", mock.Anything).Return(nil, nil)
+	mockGitHub.On("CommentedByOthers", ctx, mock.Anything, "").Return(false, nil)
+
+	// The newest rebase PR gets the new branch and description
+	mockGit.On("ForcePush", ctx, "/tmp/work/internal", "ai-rebase-9", "ai-rebase-7", "sha7").Return(nil)
+	mockAI.On("GeneratePRDescription", ctx, []string{}, mock.Anything).Return("Rebased onto upstream.", nil)
+	updated := &interfaces.PullRequest{Number: 7, Head: "ai-rebase-7", Base: "main"}
+	mockGitHub.On("UpdatePullRequest", ctx, 7, mock.AnythingOfType("string"), mock.MatchedBy(func(body string) bool {
+		return strings.HasPrefix(body, "Rebased onto upstream.")
+	})).Return(updated, nil)
+	mockGitHub.On("AddReviewers", ctx, 7, []string{"core-team"}).Return(nil)
+
+	// The older one is closed in favor of it
+	mockGitHub.On("ClosePullRequest", ctx, 3, mock.MatchedBy(func(comment string) bool {
+		return strings.Contains(comment, "Superseded by #7")
+	})).Return(nil)
+
+	pr, err := createPullRequest(ctx, cfg, services, nil, nil, nil, "ai-rebase-9")
+
+	require.NoError(t, err)
+	assert.Equal(t, updated, pr)
+	mockGit.AssertExpectations(t)
+	mockGitHub.AssertExpectations(t)
+	mockGit.AssertNotCalled(t, "Push", mock.Anything, mock.Anything, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "CreatePullRequest", mock.Anything, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "ClosePullRequest", ctx, 4, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "ClosePullRequest", ctx, 8, mock.Anything)
+}
+
+func TestCreatePullRequest_SupersedeClose(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockGitHub := &mocks.MockGitHubService{}
+	services := &Services{Git: mockGit, AI: mockAI, GitHub: mockGitHub}
+
+	cfg := &config.Config{
+		Git:              config.GitConfig{Branch: "main"},
+		GitHub:           config.GitHubConfig{SupersedePolicy: config.SupersedeClose},
+		ActualWorkingDir: "/tmp/work",
+	}
+
+	ctx := context.Background()
+	mockGitHub.On("ListPullRequests", ctx, "open").Return([]*interfaces.PullRequest{
+		{Number: 3, Head: "ai-rebase-3", Base: "main"},
+		{Number: 7, Head: "ai-rebase-7", Base: "main"},
+	}, nil)
+
+	mockGit.On("CommitsByOthers", ctx, "/tmp/work/internal", "upstream/main", mock.Anything).Return(nil, nil)
+	mockGitHub.On("CommentedByOthers", ctx, mock.Anything, "").Return(false, nil)
+
+	mockGit.On("Push", ctx, "/tmp/work/internal", "ai-rebase-9").Return(nil)
+	mockAI.On("GeneratePRDescription", ctx, []string{}, mock.Anything).Return("Rebased onto upstream.", nil)
+	created := &interfaces.PullRequest{Number: 9, Head: "ai-rebase-9", Base: "main"}
+	mockGitHub.On("CreatePullRequest", ctx, mock.AnythingOfType("interfaces.CreatePRRequest")).Return(created, nil)
+	for _, number := range []int{3, 7} {
+		mockGitHub.On("ClosePullRequest", ctx, number, mock.MatchedBy(func(comment string) bool {
+			return strings.Contains(comment, "Superseded by #9")
+		})).Return(nil).Once()
+	}
+
+	pr, err := createPullRequest(ctx, cfg, services, nil, nil, nil, "ai-rebase-9")
+
+	require.NoError(t, err)
+	assert.Equal(t, created, pr)
+	mockGit.AssertExpectations(t)
+	mockGitHub.AssertExpectations(t)
+	mockGit.AssertNotCalled(t, "ForcePush", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreatePullRequest_SupersedeKeepsWorkedOnPRs(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockGitHub := &mocks.MockGitHubService{}
+	services := &Services{Git: mockGit, AI: mockAI, GitHub: mockGitHub}
+
+	cfg := &config.Config{
+		Git:              config.GitConfig{Branch: "main"},
+		GitHub:           config.GitHubConfig{SupersedePolicy: config.SupersedeUpdate},
+		ActualWorkingDir: "/tmp/work",
+	}
+
+	ctx := context.Background()
+	mockGitHub.On("ListPullRequests", ctx, "open").Return([]*interfaces.PullRequest{
+		{Number: 3, Head: "ai-rebase-3", HeadSHA: "sha3", Base: "main", Author: "rebaser"},
+		{Number: 5, Head: "ai-rebase-5", HeadSHA: "sha5", Base: "main", Author: "rebaser"},
+		{Number: 7, Head: "ai-rebase-7", HeadSHA: "sha7", Base: "main", Author: "rebaser", Draft: true},
+	}, nil)
+
+	// A human pushed conflict fixes to the handoff draft #7 and reviewed #5
+	mockGit.On("CommitsByOthers", ctx, "/tmp/work/internal", "upstream/main", "sha7").Return([]string{"fix1"}, nil)
+	mockGit.On("CommitsByOthers", ctx, "/tmp/work/internal", "upstream/main", mock.Anything).Return(nil, nil)
+	mockGitHub.On("CommentedByOthers", ctx, 5, "rebaser").Return(true, nil)
+	mockGitHub.On("CommentedByOthers", ctx, 3, "rebaser").Return(false, nil)
+
+	// Only the untouched #3 is replaced, the others are mentioned
+	mockGit.On("ForcePush", ctx, "/tmp/work/internal", "ai-rebase-9", "ai-rebase-3", "sha3").Return(nil)
+	mockAI.On("GeneratePRDescription", ctx, []string{}, mock.Anything).Return("Rebased onto upstream.", nil)
+	updated := &interfaces.PullRequest{Number: 3, Head: "ai-rebase-3", Base: "main"}
+	mockGitHub.On("UpdatePullRequest", ctx, 3, mock.AnythingOfType("string"), mock.MatchedBy(func(body string) bool {
+		return strings.Contains(body, "#7, #5 were kept open, as people worked on them")
+	})).Return(updated, nil)
+
+	pr, err := createPullRequest(ctx, cfg, services, nil, nil, nil, "ai-rebase-9")
+
+	require.NoError(t, err)
+	assert.Equal(t, updated, pr)
+	mockGit.AssertExpectations(t)
+	mockGitHub.AssertExpectations(t)
+	mockGit.AssertNotCalled(t, "ForcePush", ctx, "/tmp/work/internal", "ai-rebase-9", "ai-rebase-7", "sha7")
+	mockGitHub.AssertNotCalled(t, "ClosePullRequest", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestStaleRebasePRs_KeepsUncheckablePRs(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockGitHub := &mocks.MockGitHubService{}
+	services := &Services{Git: mockGit, GitHub: mockGitHub}
+
+	cfg := &config.Config{
+		Git:              config.GitConfig{Branch: "main"},
+		GitHub:           config.GitHubConfig{SupersedePolicy: config.SupersedeClose},
+		ActualWorkingDir: "/tmp/work",
+	}
+
+	ctx := context.Background()
+	mockGitHub.On("ListPullRequests", ctx, "open").Return([]*interfaces.PullRequest{
+		{Number: 3, Head: "ai-rebase-3", HeadSHA: "sha3", Base: "main", Author: "rebaser"},
+		{Number: 4, Head: "ai-rebase-4", HeadSHA: "sha4", Base: "main", Author: "rebaser"},
+	}, nil)
+	mockGit.On("CommitsByOthers", ctx, "/tmp/work/internal", "upstream/main", "sha3").Return(nil, errors.New("bad object sha3"))
+	mockGit.On("CommitsByOthers", ctx, "/tmp/work/internal", "upstream/main", "sha4").Return(nil, nil)
+	mockGitHub.On("CommentedByOthers", ctx, 4, "rebaser").Return(false, errors.New("API unavailable"))
+
+	stale, kept := staleRebasePRs(ctx, cfg, services)
+
+	assert.Empty(t, stale)
+	require.Len(t, kept, 2)
+	assert.Equal(t, 4, kept[0].Number)
+	assert.Equal(t, 3, kept[1].Number)
+}
+
+func TestSupersedeTarget(t *testing.T) {
+	cfg := &config.Config{GitHub: config.GitHubConfig{SupersedePolicy: config.SupersedeUpdate}}
+	stale := []*interfaces.PullRequest{{Number: 7, Draft: true}, {Number: 3}}
+
+	assert.Equal(t, stale[0], supersedeTarget(cfg, stale, true))
+	assert.Nil(t, supersedeTarget(cfg, stale, false))
+
+	cfg.GitHub.SupersedePolicy = config.SupersedeClose
+	assert.Nil(t, supersedeTarget(cfg, stale, true))
+}
+
+func TestPerformRebase_SkipsWhenNothingMoved(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	services := &Services{Git: mockGit}
+
+	cfg := &config.Config{
+		Git: config.GitConfig{
+			InternalRepo:  "https://github.com/test/internal.git",
+			UpstreamRepo:  "https://github.com/test/upstream.git",
+			Branch:        "main",
+			SkipUnchanged: true,
+		},
+		StateDir: t.TempDir(),
+	}
+	require.NoError(t, state.Write(filepath.Join(cfg.StateDir, headsFile), state.Heads{Upstream: "upstream-sha", Internal: "internal-sha"}))
+
+	ctx := context.Background()
+	mockGit.On("RemoteHead", ctx, cfg.Git.UpstreamRepo, "main").Return("upstream-sha", nil)
+	mockGit.On("RemoteHead", ctx, cfg.Git.InternalRepo, "main").Return("internal-sha", nil)
+
+	err := performRebase(ctx, cfg, services)
+
+	assert.NoError(t, err)
+	mockGit.AssertExpectations(t)
+	mockGit.AssertNotCalled(t, "Clone", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestNothingToRebase(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	services := &Services{Git: mockGit}
+
+	cfg := &config.Config{
+		Git: config.GitConfig{
+			InternalRepo:  "https://github.com/test/internal.git",
+			UpstreamRepo:  "https://github.com/test/upstream.git",
+			Branch:        "main",
+			SkipUnchanged: true,
+		},
+		StateDir: t.TempDir(),
+	}
+
+	ctx := context.Background()
+	mockGit.On("RemoteHead", ctx, cfg.Git.UpstreamRepo, "main").Return("upstream-sha", nil)
+	mockGit.On("RemoteHead", ctx, cfg.Git.InternalRepo, "main").Return("internal-sha", nil)
+
+	// Nothing was rebased yet
+	heads, unchanged := nothingToRebase(ctx, cfg, services)
+	assert.False(t, unchanged)
+	require.NotNil(t, heads)
+
+	// A dry run records nothing
+	cfg.DryRun = true
+	recordRebase(cfg, heads)
+	_, unchanged = nothingToRebase(ctx, cfg, services)
+	assert.False(t, unchanged)
+
+	cfg.DryRun = false
+	recordRebase(cfg, heads)
+	_, unchanged = nothingToRebase(ctx, cfg, services)
+	assert.True(t, unchanged)
+
+	// --force rebases anyway
+	cfg.Force = true
+	heads, unchanged = nothingToRebase(ctx, cfg, services)
+	assert.False(t, unchanged)
+	assert.Equal(t, "upstream-sha", heads.Upstream)
+	assert.Equal(t, "internal-sha", heads.Internal)
+}
+
+func TestNothingToRebase_UnreadableRemote(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	services := &Services{Git: mockGit}
+
+	cfg := &config.Config{
+		Git:      config.GitConfig{UpstreamRepo: "https://github.com/test/upstream.git", Branch: "main", SkipUnchanged: true},
+		StateDir: t.TempDir(),
+	}
+
+	ctx := context.Background()
+	mockGit.On("RemoteHead", ctx, cfg.Git.UpstreamRepo, "main").Return("", errors.New("could not resolve host"))
+
+	heads, unchanged := nothingToRebase(ctx, cfg, services)
+	assert.False(t, unchanged)
+	assert.Nil(t, heads)
+}
+
+func TestLearnResolutions(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockGitHub := &mocks.MockGitHubService{}
+
+	path := filepath.Join(t.TempDir(), "resolutions.json")
+	store, err := memory.Open(path)
+	require.NoError(t, err)
+	services := &Services{Git: mockGit, GitHub: mockGitHub, Memory: store}
+	cfg := &config.Config{ActualWorkingDir: "/tmp/work"}
+
+	hunk := interfaces.ConflictHunk{Before: "static const struct pad_config gpio_table[] = {", Ours: "\tPAD_CFG_GPO(GPP_B3, 1, DEEP),", Theirs: "\tPAD_CFG_GPO(GPP_B3, 0, PLTRST),", After: "};"}
+	rememberResolutions(services, &interfaces.PullRequest{Number: 7}, []interfaces.GitConflict{
+		{File: "src/gpio.c", ResolvedByAI: true, Hunks: []interfaces.ConflictHunk{hunk}},
+		{File: "src/Kconfig", Action: "took the upstream version", Hunks: []interfaces.ConflictHunk{{Ours: "a", Theirs: "b"}}},
+	})
+	rememberResolutions(services, &interfaces.PullRequest{Number: 8}, []interfaces.GitConflict{
+		{File: "src/soc.c", ResolvedByAI: true, Hunks: []interfaces.ConflictHunk{{Ours: "a", Theirs: "b"}}},
+	})
+	rememberResolutions(services, &interfaces.PullRequest{Number: 9}, []interfaces.GitConflict{
+		{File: "src/uart.c", ResolvedByAI: true, Hunks: []interfaces.ConflictHunk{{Ours: "c", Theirs: "d"}}},
+	})
+
+	ctx := context.Background()
+	mockGitHub.On("GetPullRequest", ctx, 7).Return(&interfaces.PullRequest{Number: 7, State: "closed", Merged: true, MergeCommitSHA: "abc123"}, nil).Once()
+	mockGitHub.On("GetPullRequest", ctx, 8).Return(&interfaces.PullRequest{Number: 8, State: "closed"}, nil).Once()
+	mockGitHub.On("GetPullRequest", ctx, 9).Return(&interfaces.PullRequest{Number: 9, State: "open"}, nil).Once()
+	// A reviewer changed the AI's resolution before merging
+	mockGit.On("ShowFile", ctx, "/tmp/work/internal", "abc123", "src/gpio.c").
+		Return("static const struct pad_config gpio_table[] = {\n\tPAD_CFG_GPO(GPP_B3, 1, PLTRST),\n};\n", nil).Once()
+
+	learnResolutions(ctx, cfg, services)
+
+	mockGit.AssertExpectations(t)
+	mockGitHub.AssertExpectations(t)
+
+	// What was learned survives the run
+	store, err = memory.Open(path)
+	require.NoError(t, err)
+
+	pending := store.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, 9, pending[0].PR)
+
+	similar := store.Similar("src/gpio.c", "PAD_CFG_GPO(GPP_B4, 1, DEEP)", 3)
+	require.Len(t, similar, 1)
+	assert.Equal(t, "\tPAD_CFG_GPO(GPP_B3, 1, PLTRST),", similar[0].Resolution)
+}
+
+func TestLearnResolutions_DryRunSavesNothing(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockGitHub := &mocks.MockGitHubService{}
+
+	path := filepath.Join(t.TempDir(), "resolutions.json")
+	store, err := memory.Open(path)
+	require.NoError(t, err)
+	services := &Services{Git: mockGit, GitHub: mockGitHub, Memory: store}
+	cfg := &config.Config{ActualWorkingDir: "/tmp/work", DryRun: true}
+
+	rememberResolutions(services, &interfaces.PullRequest{Number: 7}, []interfaces.GitConflict{
+		{File: "src/gpio.c", ResolvedByAI: true, Hunks: []interfaces.ConflictHunk{{Ours: "a", Theirs: "b"}}},
+	})
+	rememberResolutions(services, &interfaces.PullRequest{Number: 8}, []interfaces.GitConflict{
+		{File: "src/soc.c", ResolvedByAI: true, Hunks: []interfaces.ConflictHunk{{Ours: "c", Theirs: "d"}}},
+	})
+
+	ctx := context.Background()
+	mockGitHub.On("GetPullRequest", ctx, 7).Return(&interfaces.PullRequest{Number: 7, State: "closed", Merged: true, MergeCommitSHA: "abc123"}, nil).Once()
+	mockGitHub.On("GetPullRequest", ctx, 8).Return(&interfaces.PullRequest{Number: 8, State: "closed"}, nil).Once()
+	mockGit.On("ShowFile", ctx, "/tmp/work/internal", "abc123", "src/gpio.c").Return("b\n", nil).Once()
+
+	learnResolutions(ctx, cfg, services)
+
+	mockGit.AssertExpectations(t)
+	mockGitHub.AssertExpectations(t)
+
+	// The next real run still finds both PRs waiting
+	store, err = memory.Open(path)
+	require.NoError(t, err)
+	assert.Len(t, store.Pending(), 2)
+}
+
+func TestRememberResolutions_UpdatedPR(t *testing.T) {
+	store, err := memory.Open(filepath.Join(t.TempDir(), "resolutions.json"))
+	require.NoError(t, err)
+	services := &Services{Memory: store}
+	pr := &interfaces.PullRequest{Number: 7}
+
+	rememberResolutions(services, pr, []interfaces.GitConflict{
+		{File: "src/gpio.c", ResolvedByAI: true, Hunks: []interfaces.ConflictHunk{{Ours: "a", Theirs: "b"}}},
+	})
+	// The next run updates the same PR, the conflict in gpio.c is gone
+	rememberResolutions(services, pr, []interfaces.GitConflict{
+		{File: "src/uart.c", ResolvedByAI: true, Hunks: []interfaces.ConflictHunk{{Ours: "c", Theirs: "d"}}},
+	})
+
+	pending := store.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, 7, pending[0].PR)
+	require.Len(t, pending[0].Cases, 1)
+	assert.Equal(t, "src/uart.c", pending[0].Cases[0].File)
+
+	// An update without AI resolutions leaves nothing to learn
+	rememberResolutions(services, pr, nil)
+	assert.Empty(t, store.Pending())
+}
+
+func TestRunTests_RepairsFailingTests(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockTest := &mocks.MockTestService{}
+	services := &Services{Git: mockGit, AI: mockAI, Test: mockTest}
+
+	workDir := t.TempDir()
+	internalDir := workDir + "/internal"
+	require.NoError(t, os.MkdirAll(internalDir+"/src", 0755))
+	require.NoError(t, os.WriteFile(internalDir+"/src/gpio.c", []byte("int pads;\n"), 0644))
+
+	cfg := &config.Config{
+		ActualWorkingDir: workDir,
+		Tests:            config.TestsConfig{MaxRepairAttempts: 3},
+	}
+
+	ctx := context.Background()
+
+	conflicts := []interfaces.GitConflict{
+		{File: "src/gpio.c", ResolvedByAI: true},
+		{File: "blob.bin", Action: "policy blobs: took upstream version"},
+	}
+
+	build := interfaces.CommandResult{Command: "make [all]", Success: false, Output: "gpio.c:1: error"}
+	failed := &interfaces.TestResult{Success: false, Results: []interfaces.CommandResult{build}, FailedTests: []string{"build"}}
+	passed := &interfaces.TestResult{Success: true}
+
+	badPatch := "--- a/src/gpio.c\n+++ b/src/gpio.c\n@@ broken\n"
+	goodPatch := "--- a/src/gpio.c\n+++ b/src/gpio.c\n@@ -1 +1 @@\n-int pads;\n+int pads = 0;\n"
+
+	mockTest.On("RunTests", ctx, internalDir).Return(failed, nil).Once()
+
+	// Attempt 1: the patch does not apply and is not committed
+	mockAI.On("RepairBuild", ctx, interfaces.RepairRequest{
+		Failures: []interfaces.CommandResult{build},
+		Files:    []interfaces.FileContent{{Path: "src/gpio.c", Content: "int pads;\n"}},
+	}).Return(badPatch, nil).Once()
+	mockGit.On("ApplyPatch", ctx, internalDir, badPatch).Return(errors.New("corrupt patch")).Once()
+
+	// Attempt 2: retried with feedback, applied, committed and the tests pass
+	mockAI.On("RepairBuild", ctx, mock.MatchedBy(func(req interfaces.RepairRequest) bool {
+		return len(req.Feedback) == 1 && strings.Contains(req.Feedback[0], "corrupt patch")
+	})).Return("```diff\n"+goodPatch+"```\n", nil).Once()
+	mockGit.On("ApplyPatch", ctx, internalDir, goodPatch).Return(nil).Once()
+	mockGit.On("Commit", ctx, internalDir, mock.MatchedBy(func(message string) bool {
+		return strings.HasPrefix(message, "Repair build after AI-assisted rebase (attempt 2)")
+	})).Return(nil).Once()
+	mockTest.On("RunTests", ctx, internalDir).Return(passed, nil).Once()
+
+	_, err := runTests(ctx, cfg, services, conflicts)
+
+	require.NoError(t, err)
+	mockGit.AssertExpectations(t)
+	mockAI.AssertExpectations(t)
+	mockTest.AssertExpectations(t)
+}
+
+func TestRunTests_GivesUpAfterRepairAttempts(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockTest := &mocks.MockTestService{}
+	services := &Services{Git: mockGit, AI: mockAI, Test: mockTest}
+
+	cfg := &config.Config{
+		ActualWorkingDir: "/tmp/test-repair",
+		Tests:            config.TestsConfig{MaxRepairAttempts: 1},
+	}
+	internalDir := "/tmp/test-repair/internal"
+
+	ctx := context.Background()
+
+	failed := &interfaces.TestResult{Success: false, FailedTests: []string{"unit"}}
+	patch := "--- a/a.c\n+++ b/a.c\n"
+
+	mockTest.On("RunTests", ctx, internalDir).Return(failed, nil).Times(2)
+	mockAI.On("RepairBuild", ctx, mock.AnythingOfType("interfaces.RepairRequest")).Return(patch, nil).Once()
+	mockGit.On("ApplyPatch", ctx, internalDir, patch).Return(nil).Once()
+	mockGit.On("Commit", ctx, internalDir, mock.AnythingOfType("string")).Return(nil).Once()
+
+	_, err := runTests(ctx, cfg, services, []interfaces.GitConflict{{File: "a.c", ResolvedByAI: true}})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "after 1 repair attempts")
+	mockGit.AssertExpectations(t)
+	mockAI.AssertExpectations(t)
+	mockTest.AssertExpectations(t)
+}
+
+func TestRunTests_UsageLimitLeavesFailingTests(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockTest := &mocks.MockTestService{}
+	services := &Services{Git: mockGit, AI: mockAI, Test: mockTest}
+
+	cfg := &config.Config{
+		ActualWorkingDir: "/tmp/test-repair",
+		Tests:            config.TestsConfig{MaxRepairAttempts: 3},
+	}
+
+	ctx := context.Background()
+
+	failed := &interfaces.TestResult{Success: false, FailedTests: []string{"build", "unit"}}
+	limitErr := fmt.Errorf("%w: 1000 of 1000 tokens used", usage.ErrLimitExceeded)
+
+	mockTest.On("RunTests", ctx, "/tmp/test-repair/internal").Return(failed, nil).Once()
+	mockAI.On("RepairBuild", ctx, mock.AnythingOfType("interfaces.RepairRequest")).Return("", limitErr).Once()
+
+	failedTests, err := runTests(ctx, cfg, services, []interfaces.GitConflict{{File: "a.c", ResolvedByAI: true}})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"build", "unit"}, failedTests)
+	mockAI.AssertExpectations(t)
+	mockTest.AssertExpectations(t)
+	mockGit.AssertNotCalled(t, "ApplyPatch", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreatePullRequest_FailingTestsOpenDraft(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockAI := &mocks.MockAIService{}
+	mockGitHub := &mocks.MockGitHubService{}
+	services := &Services{Git: mockGit, AI: mockAI, GitHub: mockGitHub}
+
+	cfg := &config.Config{
+		Git:              config.GitConfig{Branch: "main"},
+		ActualWorkingDir: "/tmp/work",
+	}
+
+	ctx := context.Background()
+
+	mockGit.On("Push", ctx, "/tmp/work/internal", "ai-rebase-9").Return(nil)
+	mockAI.On("GeneratePRDescription", ctx, []string{}, mock.Anything).Return("Rebased onto upstream.", nil)
+	created := &interfaces.PullRequest{Number: 9, Head: "ai-rebase-9", Base: "main", Draft: true}
+	mockGitHub.On("CreatePullRequest", ctx, mock.MatchedBy(func(req interfaces.CreatePRRequest) bool {
+		return req.Draft &&
+			strings.Contains(req.Body, "The AI usage limit stopped the repair of failing tests") &&
+			strings.Contains(req.Body, "## Failing Tests\n\n- [ ] `build`\n- [ ] `unit`\n")
+	})).Return(created, nil)
+
+	pr, err := createPullRequest(ctx, cfg, services, nil, nil, []string{"build", "unit"}, "ai-rebase-9")
+
+	require.NoError(t, err)
+	assert.Equal(t, created, pr)
+	mockGit.AssertExpectations(t)
+	mockGitHub.AssertExpectations(t)
+}
+
+func TestRunTests_NoRepairWithoutAIResolutions(t *testing.T) {
+	mockAI := &mocks.MockAIService{}
+	mockTest := &mocks.MockTestService{}
+	services := &Services{AI: mockAI, Test: mockTest}
+
+	cfg := &config.Config{
+		ActualWorkingDir: "/tmp/test-repair",
+		Tests:            config.TestsConfig{MaxRepairAttempts: 2},
+	}
+
+	ctx := context.Background()
+
+	mockTest.On("RunTests", ctx, "/tmp/test-repair/internal").Return(&interfaces.TestResult{Success: false, FailedTests: []string{"unit"}}, nil)
+
+	_, err := runTests(ctx, cfg, services, []interfaces.GitConflict{{File: "a.c", Action: "deleted, the internal patch removes the file"}})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tests failed")
+	mockAI.AssertNotCalled(t, "RepairBuild", mock.Anything, mock.Anything)
+}
+
+func TestSetupWorkingDirectory(t *testing.T) {
+	// Setup mocks
+	mockGit := &mocks.MockGitService{}
+	services := &Services{Git: mockGit}
+
+	cfg := &config.Config{
+		Git: config.GitConfig{
+			InternalRepo: "https://github.com/test/internal.git",
+			UpstreamRepo: "https://github.com/test/upstream.git",
+		},
+	}
+
+	ctx := context.Background()
+
+	// Mock expectations
+	mockGit.On("Clone", ctx, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("SetConfig", ctx, mock.AnythingOfType("string"), "merge.conflictStyle", "zdiff3").Return(nil)
+	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
+	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
+
+	// Execute
+	err := setupWorkingDirectory(ctx, cfg, services)
+
+	// Assert
+	assert.NoError(t, err)
+	mockGit.AssertExpectations(t)
+
+	// Cleanup
+	os.RemoveAll(cfg.ActualWorkingDir)
+}
+
+func TestSetupWorkingDirectory_CloneFallsBackToFetch(t *testing.T) {
+	// Setup mocks
+	mockGit := &mocks.MockGitService{}
+	services := &Services{Git: mockGit}
+
+	cfg := &config.Config{
+		Git: config.GitConfig{
+			InternalRepo: "https://github.com/test/internal.git",
+			UpstreamRepo: "https://github.com/test/upstream.git",
+		},
+	}
+
+	ctx := context.Background()
+
+	// Mock expectations - clone fails, fetch succeeds
+	mockGit.On("Clone", ctx, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(errors.New("clone failed"))
+	mockGit.On("SetConfig", ctx, mock.AnythingOfType("string"), "merge.conflictStyle", "zdiff3").Return(nil)
+	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
+	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
+
+	// Execute
+	err := setupWorkingDirectory(ctx, cfg, services)
+
+	// Assert
+	assert.NoError(t, err)
+	mockGit.AssertExpectations(t)
+
+	// Cleanup
+	os.RemoveAll(cfg.ActualWorkingDir)
+}
+
+func TestSetupWorkingDirectory_ClonesFromMirror(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	services := &Services{Git: mockGit}
+
+	cfg := &config.Config{
+		Git: config.GitConfig{
+			WorkingDir:   "/var/cache/rebaiser",
+			InternalRepo: "https://github.com/test/internal.git",
+			UpstreamRepo: "https://github.com/test/upstream.git",
+		},
+	}
+
+	ctx := context.Background()
+	mirrorDir := "/var/cache/rebaiser/mirror.git"
+	remotes := map[string]string{"upstream": cfg.Git.UpstreamRepo}
+
+	mockGit.On("UpdateMirror", ctx, mirrorDir, cfg.Git.InternalRepo, remotes).Return(nil)
+	mockGit.On("CloneShared", ctx, mirrorDir, cfg.Git.InternalRepo, mock.AnythingOfType("string")).Return(nil)
+	mockGit.On("SetConfig", ctx, mock.AnythingOfType("string"), "merge.conflictStyle", "zdiff3").Return(nil)
+	mockGit.On("AddRemote", ctx, mock.AnythingOfType("string"), "upstream", cfg.Git.UpstreamRepo).Return(nil)
+	mockGit.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil)
+
+	err := setupWorkingDirectory(ctx, cfg, services)
+	defer os.RemoveAll(cfg.ActualWorkingDir)
+
+	assert.NoError(t, err)
+	mockGit.AssertExpectations(t)
+	mockGit.AssertNotCalled(t, "Clone", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSetupWorkingDirectory_MirrorUpdateFails(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	services := &Services{Git: mockGit}
+
+	cfg := &config.Config{
+		Git: config.GitConfig{
+			WorkingDir:   "/var/cache/rebaiser",
+			InternalRepo: "https://github.com/test/internal.git",
+			UpstreamRepo: "https://github.com/test/upstream.git",
+		},
+	}
+
+	ctx := context.Background()
+
+	mockGit.On("UpdateMirror", ctx, "/var/cache/rebaiser/mirror.git", cfg.Git.InternalRepo, mock.Anything).Return(errors.New("could not read from remote repository"))
+
+	err := setupWorkingDirectory(ctx, cfg, services)
+	defer os.RemoveAll(cfg.ActualWorkingDir)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to update mirror cache")
+	mockGit.AssertNotCalled(t, "CloneShared", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestIsConflictError(t *testing.T) {
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/memory"
+)
+
+// learnResolutions checks the rebase PRs whose conflicts wait in the
+// resolution memory. The resolutions of merged PRs are read from the merge
+// commit, so changes reviewers made to the AI's resolutions are learned as
+// well. Closed PRs are forgotten, open ones are checked again next run. A dry
+// run only logs what it would learn, the memory on disk is left as it is.
+func learnResolutions(ctx context.Context, cfg *config.Config, services *Services) {
+	pending := services.Memory.Pending()
+	if len(pending) == 0 {
+		return
+	}
+
+	log := logrus.WithField("component", "memory")
+	internalDir := fmt.Sprintf("%s/internal", cfg.ActualWorkingDir)
+
+	for _, p := range pending {
+		pr, err := services.GitHub.GetPullRequest(ctx, p.PR)
+		if err != nil {
+			log.WithError(err).WithField("pr_number", p.PR).Warn("Failed to check rebase PR, trying again next run")
+			continue
+		}
+		if pr.State != "closed" {
+			continue
+		}
+		if !pr.Merged {
+			log.WithField("pr_number", p.PR).Info("Rebase PR was closed without merging, forgetting its resolutions")
+			services.Memory.Forget(p.PR)
+			continue
+		}
+
+		// Files are read once, a file often has several hunks
+		files := map[string]string{}
+		var learned []memory.Case
+		for _, c := range p.Cases {
+			content, ok := files[c.File]
+			if !ok {
+				content, err = services.Git.ShowFile(ctx, internalDir, pr.MergeCommitSHA, c.File)
+				if err != nil {
+					log.WithError(err).WithField("file", c.File).Debug("File is gone from the merged PR")
+				}
+				files[c.File] = content
+			}
+
+			if resolution, ok := memory.ExtractResolution(content, c); ok {
+				c.Resolution = resolution
+				learned = append(learned, c)
+			}
+		}
+
+		services.Memory.Learn(p.PR, learned)
+		log.WithFields(logrus.Fields{
+			"pr_number": p.PR,
+			"learned":   len(learned),
+			"conflicts": len(p.Cases),
+		}).Info("Learned resolutions from merged rebase PR")
+	}
+
+	if cfg.DryRun {
+		return
+	}
+	if err := services.Memory.Save(); err != nil {
+		log.WithError(err).Warn("Failed to save resolution memory")
+	}
+}
+
+// rememberResolutions keeps the conflict hunks the AI resolved for a new or
+// updated PR, to learn their final resolutions once it is merged
+func rememberResolutions(services *Services, pr *interfaces.PullRequest, conflicts []interfaces.GitConflict) {
+	var cases []memory.Case
+	for _, conflict := range conflicts {
+		if !conflict.ResolvedByAI {
+			continue
+		}
+		for _, hunk := range conflict.Hunks {
+			cases = append(cases, memory.Case{
+				File:   conflict.File,
+				Base:   hunk.Base,
+				Ours:   hunk.Ours,
+				Theirs: hunk.Theirs,
+				Before: hunk.Before,
+				After:  hunk.After,
+			})
+		}
+	}
+	// An updated PR forgets the cases of its earlier version
+	services.Memory.SetPending(pr.Number, cases)
+	if err := services.Memory.Save(); err != nil {
+		logrus.WithField("component", "memory").WithError(err).Warn("Failed to save resolution memory")
+	}
+}
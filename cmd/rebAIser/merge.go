@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// rebaseBranchPrefix starts the names of the branches of rebase PRs
+const rebaseBranchPrefix = "ai-rebase-"
+
+// mergeRebasePRs merges the open rebase PRs without comments, reviews or pushes
+// for the auto-merge delay, counted in working time if there is a calendar.
+// A PR is
+// only merged if nobody requested changes, its checks passed and upstream has
+// no commits it is missing. Every merge and every refused merge is posted to
+// Slack.
+func mergeRebasePRs(ctx context.Context, cfg *config.Config, services *Services) {
+	if !cfg.GitHub.AutoMerge {
+		return
+	}
+
+	log := logrus.WithField("component", "auto-merge")
+	prs, err := services.GitHub.ListPullRequests(ctx, "open")
+	if err != nil {
+		log.WithError(err).Warn("Failed to list pull requests, skipping auto-merge")
+		return
+	}
+
+	// Upstream is only asked once a PR is due
+	upstreamHead := ""
+	for _, pr := range prs {
+		if !isRebasePR(cfg, pr) {
+			continue
+		}
+		prLog := log.WithField("pr_number", pr.Number)
+
+		// Drafts have conflicts or failing tests left for a human
+		if pr.Draft {
+			prLog.Info("Rebase PR is a draft, not merging")
+			continue
+		}
+		active, err := lastActivity(ctx, services, pr)
+		if err != nil {
+			prLog.WithError(err).Warn("Failed to read rebase PR activity, trying again next run")
+			continue
+		}
+		if quiet := services.Calendar.WorkingTime(active, time.Now()); quiet < cfg.GitHub.AutoMergeDelay {
+			prLog.WithField("quiet_for", quiet.Round(time.Minute)).Info("Rebase PR is not due for auto-merge yet")
+			continue
+		}
+
+		if upstreamHead == "" {
+			upstreamHead, err = services.Git.RemoteHead(ctx, cfg.Git.UpstreamRepo, cfg.Git.Branch)
+			if err != nil {
+				log.WithError(err).Warn("Failed to read upstream branch, skipping auto-merge")
+				return
+			}
+		}
+
+		reasons, err := mergeBlockers(ctx, services, pr, upstreamHead)
+		if err != nil {
+			prLog.WithError(err).Warn("Failed to check rebase PR, trying again next run")
+			continue
+		}
+		if len(reasons) == 0 {
+			if err := services.GitHub.MergePullRequest(ctx, pr.Number, cfg.GitHub.MergeMethod); err != nil {
+				reasons = append(reasons, fmt.Sprintf("merging failed: %v", err))
+			}
+		}
+
+		if len(reasons) > 0 {
+			prLog.WithField("reasons", reasons).Warn("Refused to auto-merge rebase PR")
+			notifyAutoMerge(ctx, services, interfaces.NotificationMessage{
+				Title:   "AI Rebaser - Auto-Merge Refused",
+				Message: fmt.Sprintf("⏸️ Rebase PR #%d was not merged: %s.", pr.Number, strings.Join(reasons, "; ")),
+				URL:     pr.HTMLURL,
+				Level:   interfaces.NotificationLevelWarning,
+
+				ActionRequired: true,
+			})
+			continue
+		}
+
+		prLog.WithField("method", cfg.GitHub.MergeMethod).Info("Auto-merged rebase PR")
+		notifyAutoMerge(ctx, services, interfaces.NotificationMessage{
+			Title:   "AI Rebaser - PR Merged",
+			Message: fmt.Sprintf("✅ Rebase PR #%d was merged after %s%s without activity.", pr.Number, cfg.GitHub.AutoMergeDelay, workingHoursNote(services)),
+			URL:     pr.HTMLURL,
+			Level:   interfaces.NotificationLevelSuccess,
+		})
+	}
+}
+
+// lastActivity returns when people last commented on, reviewed or pushed to a
+// PR, its creation if nothing happened since
+func lastActivity(ctx context.Context, services *Services, pr *interfaces.PullRequest) (time.Time, error) {
+	active, err := services.GitHub.LastActivity(ctx, pr.Number, pr.HeadSHA)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if created, err := time.Parse(time.RFC3339, pr.CreatedAt); err == nil && created.After(active) {
+		active = created
+	}
+	if active.IsZero() {
+		return time.Time{}, fmt.Errorf("rebase PR has no activity and no creation time")
+	}
+	return active, nil
+}
+
+// isRebasePR reports if a PR was opened by a rebase run
+func isRebasePR(cfg *config.Config, pr *interfaces.PullRequest) bool {
+	return strings.HasPrefix(pr.Head, rebaseBranchPrefix) && pr.Base == cfg.Git.Branch
+}
+
+// mergeBlockers returns why a due rebase PR must not be merged, nothing if it
+// may be
+func mergeBlockers(ctx context.Context, services *Services, pr *interfaces.PullRequest, upstreamHead string) ([]string, error) {
+	var reasons []string
+
+	changesRequested, err := services.GitHub.ChangesRequested(ctx, pr.Number)
+	if err != nil {
+		return nil, err
+	}
+	if changesRequested {
+		reasons = append(reasons, "a reviewer requested changes")
+	}
+
+	head := pr.HeadSHA
+	if head == "" {
+		head = pr.Head
+	}
+	state, err := services.GitHub.CheckState(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+	switch state {
+	case interfaces.CheckFailure:
+		reasons = append(reasons, "checks failed")
+	case interfaces.CheckPending:
+		reasons = append(reasons, "checks are still running")
+	}
+
+	upToDate, err := services.GitHub.ContainsCommit(ctx, head, upstreamHead)
+	if err != nil {
+		return nil, err
+	}
+	if !upToDate {
+		reasons = append(reasons, "upstream has new commits, the next rebase will replace it")
+	}
+
+	return reasons, nil
+}
+
+func notifyAutoMerge(ctx context.Context, services *Services, message interfaces.NotificationMessage) {
+	if err := services.Notify.SendMessage(ctx, message); err != nil {
+		logrus.WithField("component", "auto-merge").WithError(err).Warn("Failed to send auto-merge notification")
+	}
+}
+
+// workingHoursNote qualifies a delay that only counts working hours
+func workingHoursNote(services *Services) string {
+	if services.Calendar == nil {
+		return ""
+	}
+	return " of working time"
+}
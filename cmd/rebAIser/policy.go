@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/pathglob"
+	"github.com/BlindspotSoftware/rebAIser/internal/validate"
+)
+
+// matchConflictPolicy returns the first configured policy that applies to the
+// conflict, or nil. Renamed conflicts always use their own strategy.
+func matchConflictPolicy(policies []config.ConflictPolicy, conflict interfaces.GitConflict) *config.ConflictPolicy {
+	if conflict.Type == interfaces.ConflictRenamed {
+		return nil
+	}
+
+	for i := range policies {
+		policy := &policies[i]
+		if policy.Binary && conflict.Binary {
+			return policy
+		}
+		for _, pattern := range policy.Patterns {
+			if pathglob.Match(pattern, conflict.File) {
+				return policy
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyConflictPolicy resolves a conflict as the policy says, without the AI.
+// A regenerate command runs at most once per rebase stop, regenerated keeps
+// track of the policies that already ran.
+func applyConflictPolicy(ctx context.Context, cfg *config.Config, services *Services, internalDir string, policy config.ConflictPolicy, conflict interfaces.GitConflict, regenerated map[string]bool) (string, error) {
+	name := policy.Name
+	if name == "" {
+		name = policy.Action
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"component": "conflict-resolution",
+		"file":      conflict.File,
+		"policy":    name,
+		"action":    policy.Action,
+	}).Info("Applying conflict policy")
+
+	var action string
+	switch policy.Action {
+	case config.PolicyTakeUpstream:
+		if err := takeConflictSide(ctx, services, internalDir, conflict, interfaces.SideUpstream); err != nil {
+			return "", err
+		}
+		action = "took upstream version"
+
+	case config.PolicyTakeInternal:
+		if err := takeConflictSide(ctx, services, internalDir, conflict, interfaces.SideInternal); err != nil {
+			return "", err
+		}
+		action = "took internal version"
+
+	case config.PolicyRegenerate:
+		command := strings.TrimSpace(policy.Command + " " + strings.Join(policy.Args, " "))
+		if !regenerated[name] {
+			result, err := services.Test.RunCommand(ctx, interfaces.TestCommand{
+				Name:       fmt.Sprintf("regenerate (%s)", name),
+				Command:    policy.Command,
+				Args:       policy.Args,
+				WorkingDir: internalDir,
+				Timeout:    cfg.Tests.Timeout,
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to run %s: %w", command, err)
+			}
+			if !result.Success {
+				return "", fmt.Errorf("%s failed: %s\nOutput: %s", command, result.Error, result.Output)
+			}
+			regenerated[name] = true
+		}
+
+		// The generator may not write every file the policy matches
+		if err := checkRegenerated(internalDir, conflict); err != nil {
+			return "", needsHuman("`%s` did not regenerate %s: %v", command, conflict.File, err)
+		}
+		if err := services.Git.StageFile(ctx, internalDir, conflict.File); err != nil {
+			return "", err
+		}
+		action = fmt.Sprintf("regenerated with `%s`", command)
+
+	default:
+		return "", fmt.Errorf("conflict policy %s has unknown action %q", name, policy.Action)
+	}
+
+	return fmt.Sprintf("policy %s: %s", name, action), nil
+}
+
+// checkRegenerated returns an error if a regenerated file still has conflict
+// markers. A file the generator deleted is fine, its deletion is staged.
+func checkRegenerated(internalDir string, conflict interfaces.GitConflict) error {
+	data, err := os.ReadFile(filepath.Join(internalDir, conflict.File))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return validate.Markers(string(data), conflictMarkerSize(conflict))
+}
+
+// takeConflictSide resolves a conflict with one side, which for modify/delete
+// conflicts may mean deleting the file
+func takeConflictSide(ctx context.Context, services *Services, internalDir string, conflict interfaces.GitConflict, side interfaces.ConflictSide) error {
+	deleted := (side == interfaces.SideUpstream && conflict.Type == interfaces.ConflictDeletedByUs) ||
+		(side == interfaces.SideInternal && conflict.Type == interfaces.ConflictDeletedByThem)
+
+	if deleted {
+		if err := services.Git.RemoveFile(ctx, internalDir, conflict.File); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", conflict.File, err)
+		}
+		return nil
+	}
+
+	if err := services.Git.CheckoutSide(ctx, internalDir, conflict.File, side); err != nil {
+		return fmt.Errorf("failed to take %s version of %s: %w", side, conflict.File, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/ai"
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/usage"
+	"github.com/BlindspotSoftware/rebAIser/internal/validate"
+)
+
+// repairBuild feeds failing test commands back to the AI together with the
+// files it resolved, applies the patch it proposes and runs the tests again.
+// Every applied patch is committed on its own so reviewers can follow the
+// repairs. It returns the first passing test result, or the failing one if the
+// AI usage limit stops the repair, so the tests can be left for a human.
+func repairBuild(ctx context.Context, cfg *config.Config, services *Services, files []string, result *interfaces.TestResult) (*interfaces.TestResult, error) {
+	log := logrus.WithField("component", "repair")
+	internalDir := fmt.Sprintf("%s/internal", cfg.ActualWorkingDir)
+
+	var feedback []string
+	for attempt := 1; attempt <= cfg.Tests.MaxRepairAttempts; attempt++ {
+		log.WithFields(logrus.Fields{
+			"attempt":      attempt,
+			"failed_tests": result.FailedTests,
+		}).Info("Asking AI to repair failing tests")
+
+		request := interfaces.RepairRequest{
+			Failures: failedCommands(result),
+			Files:    readWorkingFiles(internalDir, files),
+			Feedback: feedback,
+		}
+
+		patch, err := services.AI.RepairBuild(ctx, request)
+		if errors.Is(err, ai.ErrTruncated) {
+			feedback = append(feedback, fmt.Sprintf("attempt %d: %v, keep the patch smaller", attempt, err))
+			continue
+		}
+		if errors.Is(err, usage.ErrLimitExceeded) {
+			log.WithError(err).Warn("AI usage limit reached, leaving the failing tests for a human")
+			return result, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("AI failed to repair tests: %w", err)
+		}
+
+		patch = validate.Clean(patch)
+		if err := services.Git.ApplyPatch(ctx, internalDir, patch); err != nil {
+			log.WithError(err).Warn("Repair patch does not apply")
+			feedback = append(feedback, fmt.Sprintf("attempt %d: %v", attempt, err))
+			continue
+		}
+
+		message := fmt.Sprintf("Repair build after AI-assisted rebase (attempt %d)\n\nFailing tests:\n- %s",
+			attempt, strings.Join(result.FailedTests, "\n- "))
+		if err := services.Git.Commit(ctx, internalDir, message); err != nil {
+			return nil, fmt.Errorf("failed to commit repair attempt %d: %w", attempt, err)
+		}
+
+		// The tree changed, earlier problems no longer apply
+		feedback = nil
+		files = appendPatchedFiles(files, patch)
+
+		result, err = services.Test.RunTests(ctx, internalDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run tests: %w", err)
+		}
+		if result.Success {
+			log.WithField("attempt", attempt).Info("Repair fixed the failing tests")
+			return result, nil
+		}
+	}
+
+	return nil, fmt.Errorf("tests failed after %d repair attempts: %v", cfg.Tests.MaxRepairAttempts, result.FailedTests)
+}
+
+// aiResolvedFiles returns the files whose content the AI wrote, in order and
+// without duplicates
+func aiResolvedFiles(conflicts []interfaces.GitConflict) []string {
+	var files []string
+	seen := map[string]bool{}
+	for _, conflict := range conflicts {
+		if conflict.ResolvedByAI && !seen[conflict.File] {
+			seen[conflict.File] = true
+			files = append(files, conflict.File)
+		}
+	}
+	return files
+}
+
+// failedCommands returns the results of the failing test commands
+func failedCommands(result *interfaces.TestResult) []interfaces.CommandResult {
+	var failures []interfaces.CommandResult
+	for _, command := range result.Results {
+		if !command.Success {
+			failures = append(failures, command)
+		}
+	}
+	return failures
+}
+
+// readWorkingFiles reads files from the working tree. Files that no longer
+// exist, for example because a later patch removed them, are left out.
+func readWorkingFiles(dir string, files []string) []interfaces.FileContent {
+	contents := make([]interfaces.FileContent, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			continue
+		}
+		contents = append(contents, interfaces.FileContent{Path: file, Content: string(data)})
+	}
+	return contents
+}
+
+// appendPatchedFiles adds the files a unified diff modifies to files
+func appendPatchedFiles(files []string, patch string) []string {
+	for _, line := range strings.Split(patch, "\n") {
+		if !strings.HasPrefix(line, "+++ b/") {
+			continue
+		}
+		file := strings.TrimSpace(strings.TrimPrefix(line, "+++ b/"))
+
+		known := false
+		for _, existing := range files {
+			known = known || existing == file
+		}
+		if !known {
+			files = append(files, file)
+		}
+	}
+	return files
+}
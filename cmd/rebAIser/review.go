@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// reviewRebase asks the AI to review the rebased files that had conflicts as
+// a whole. The review is advisory: if the AI fails the PR is created without
+// it. Findings from the configured severity on are returned with an error so
+// the PR is not created.
+func reviewRebase(ctx context.Context, cfg *config.Config, services *Services, conflicts []interfaces.GitConflict) ([]interfaces.ReviewFinding, error) {
+	if !cfg.AI.Review.Enabled {
+		return nil, nil
+	}
+
+	log := logrus.WithField("component", "review")
+	files := reviewedFiles(conflicts)
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	internalDir := fmt.Sprintf("%s/internal", cfg.ActualWorkingDir)
+	upstreamBranch := fmt.Sprintf("upstream/%s", cfg.Git.Branch)
+	diff, err := services.Git.Diff(ctx, internalDir, upstreamBranch, "HEAD", files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff rebased files: %w", err)
+	}
+	if strings.TrimSpace(diff) == "" {
+		log.Info("Rebased files match upstream, nothing to review")
+		return nil, nil
+	}
+
+	log.WithField("files", len(files)).Info("Reviewing rebased changes")
+	findings, err := services.AI.ReviewRebase(ctx, interfaces.ReviewRequest{Diff: diff, Conflicts: conflicts})
+	if err != nil {
+		log.WithError(err).Warn("AI review failed, continuing without it")
+		return nil, nil
+	}
+
+	var blocking []string
+	for _, finding := range findings {
+		log.WithFields(logrus.Fields{
+			"file":     finding.File,
+			"line":     finding.Line,
+			"severity": finding.Severity,
+			"category": finding.Category,
+		}).Warn(finding.Message)
+
+		blockOn := interfaces.ReviewSeverity(cfg.AI.Review.BlockOn)
+		if blockOn != "" && finding.Severity.AtLeast(blockOn) {
+			blocking = append(blocking, formatFinding(finding))
+		}
+	}
+
+	if len(blocking) > 0 {
+		return findings, fmt.Errorf("AI review found %d problems of severity %s or worse:\n- %s",
+			len(blocking), cfg.AI.Review.BlockOn, strings.Join(blocking, "\n- "))
+	}
+	return findings, nil
+}
+
+// reviewedFiles returns the files with conflicts that were resolved, in order
+// and without duplicates. Files left for a human still have their conflict
+// markers and are not worth reviewing.
+func reviewedFiles(conflicts []interfaces.GitConflict) []string {
+	var files []string
+	seen := map[string]bool{}
+	for _, conflict := range conflicts {
+		if !conflict.Unresolved && !seen[conflict.File] {
+			seen[conflict.File] = true
+			files = append(files, conflict.File)
+		}
+	}
+	return files
+}
+
+// formatFinding renders a finding on a single line
+func formatFinding(finding interfaces.ReviewFinding) string {
+	return fmt.Sprintf("%s %s (%s): %s", finding.Severity, findingLocation(finding), findingCategory(finding), finding.Message)
+}
+
+// findingLocation returns the file of a finding and its line if it has one
+func findingLocation(finding interfaces.ReviewFinding) string {
+	if finding.Line > 0 {
+		return fmt.Sprintf("%s:%d", finding.File, finding.Line)
+	}
+	return finding.File
+}
+
+// findingCategory returns the category of a finding in words
+func findingCategory(finding interfaces.ReviewFinding) string {
+	return strings.ReplaceAll(string(finding.Category), "_", " ")
+}
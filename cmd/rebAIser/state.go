@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/state"
+)
+
+// headsFile keeps the heads of the last successful rebase in the state
+// directory
+const headsFile = "last-rebase.json"
+
+// nothingToRebase reports if neither repository moved since the last
+// successful rebase. It returns the current heads to record once the run
+// succeeds, nil if they are not to be recorded.
+func nothingToRebase(ctx context.Context, cfg *config.Config, services *Services) (*state.Heads, bool) {
+	if !cfg.Git.SkipUnchanged {
+		return nil, false
+	}
+
+	log := logrus.WithField("component", "rebaser")
+	upstream, err := services.Git.RemoteHead(ctx, cfg.Git.UpstreamRepo, cfg.Git.Branch)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read upstream branch, rebasing anyway")
+		return nil, false
+	}
+	internal, err := services.Git.RemoteHead(ctx, cfg.Git.InternalRepo, cfg.Git.Branch)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read internal branch, rebasing anyway")
+		return nil, false
+	}
+	heads := &state.Heads{Upstream: upstream, Internal: internal}
+
+	if cfg.Force {
+		log.Info("Forced rebase, not checking for changes")
+		return heads, false
+	}
+	last, err := state.Read(filepath.Join(cfg.StateDir, headsFile))
+	if err != nil {
+		log.WithError(err).Warn("Failed to read the last rebase, rebasing anyway")
+		return heads, false
+	}
+	if last.Unchanged(upstream, internal) {
+		log.WithFields(logrus.Fields{
+			"upstream":     upstream,
+			"internal":     internal,
+			"last_rebased": last.Rebased,
+		}).Info("Nothing moved since the last rebase, skipping")
+		return heads, true
+	}
+	return heads, false
+}
+
+// recordRebase records the heads a successful rebase started from. Dry runs
+// record nothing, so the next real run is not skipped.
+func recordRebase(cfg *config.Config, heads *state.Heads) {
+	if heads == nil || cfg.DryRun {
+		return
+	}
+
+	heads.Rebased = time.Now().UTC()
+	if err := state.Write(filepath.Join(cfg.StateDir, headsFile), *heads); err != nil {
+		logrus.WithField("component", "rebaser").WithError(err).Warn("Failed to record the rebase, the next run will not be skipped")
+	}
+}
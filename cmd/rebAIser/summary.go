@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/usage"
+)
+
+// formatResolutionSummary renders how each conflict was resolved as a markdown
+// section for the PR description
+func formatResolutionSummary(conflicts []interfaces.GitConflict) string {
+	if len(conflicts) == 0 {
+		return ""
+	}
+
+	var summary strings.Builder
+	summary.WriteString("\n\n## Conflict Resolutions\n\n")
+	summary.WriteString("| File | Conflict | Action |\n")
+	summary.WriteString("|------|----------|--------|\n")
+
+	for _, conflict := range conflicts {
+		conflictType := conflict.Type
+		if conflictType == "" {
+			conflictType = interfaces.ConflictBothModified
+		}
+		summary.WriteString(fmt.Sprintf("| `%s` | %s | %s |\n", conflict.File, conflictType, conflict.Action))
+	}
+
+	for _, conflict := range conflicts {
+		summary.WriteString(formatResolutionDetails(conflict))
+	}
+
+	return summary.String()
+}
+
+// formatHandoffChecklist renders the conflicts left for a human as a markdown
+// task list, so reviewers can tick them off as they finish them
+func formatHandoffChecklist(conflicts []interfaces.GitConflict) string {
+	var checklist strings.Builder
+	checklist.WriteString("## Needs a Human\n\n")
+	for _, conflict := range conflicts {
+		if conflict.Unresolved {
+			checklist.WriteString(fmt.Sprintf("- [ ] `%s`: %s\n", conflict.File, conflict.Action))
+		}
+	}
+	return checklist.String()
+}
+
+// formatFailingTests lists the failing tests left for a human as a checklist
+func formatFailingTests(tests []string) string {
+	var checklist strings.Builder
+	checklist.WriteString("## Failing Tests\n\n")
+	for _, test := range tests {
+		checklist.WriteString(fmt.Sprintf("- [ ] `%s`\n", test))
+	}
+	return checklist.String()
+}
+
+// formatResolutionDetails renders the AI's reasoning about a resolution, so
+// reviewers know where to look
+func formatResolutionDetails(conflict interfaces.GitConflict) string {
+	resolution := conflict.Resolution
+	if resolution == nil {
+		return ""
+	}
+
+	var details strings.Builder
+	details.WriteString(fmt.Sprintf("\n### `%s`\n\n", conflict.File))
+	details.WriteString(fmt.Sprintf("- **Strategy:** %s\n", resolution.Strategy))
+	details.WriteString(fmt.Sprintf("- **Confidence:** %.2f\n", resolution.Confidence))
+	if resolution.Rationale != "" {
+		details.WriteString(fmt.Sprintf("- **Rationale:** %s\n", resolution.Rationale))
+	}
+	if len(resolution.Risks) > 0 {
+		details.WriteString("- **Risks:**\n")
+		for _, risk := range resolution.Risks {
+			details.WriteString(fmt.Sprintf("  - %s\n", risk))
+		}
+	}
+
+	return details.String()
+}
+
+// formatReviewFindings renders the findings of the AI review as a markdown
+// section for the PR description
+func formatReviewFindings(findings []interfaces.ReviewFinding) string {
+	if len(findings) == 0 {
+		return ""
+	}
+
+	var summary strings.Builder
+	summary.WriteString("\n\n## AI Review\n\n")
+	for _, finding := range findings {
+		summary.WriteString(fmt.Sprintf("- **%s** `%s` (%s): %s\n",
+			finding.Severity, findingLocation(finding), findingCategory(finding), finding.Message))
+	}
+
+	return summary.String()
+}
+
+// formatUsageSummary renders the AI usage of the run per operation as a
+// markdown section for the PR description
+func formatUsageSummary(ledger *usage.Ledger) string {
+	totals := ledger.Totals()
+	if totals.Calls == 0 {
+		return ""
+	}
+
+	var summary strings.Builder
+	summary.WriteString("\n\n## AI Usage\n\n")
+	summary.WriteString("| Operation | Calls | Input tokens | Output tokens | Cost |\n")
+	summary.WriteString("|-----------|-------|--------------|---------------|------|\n")
+
+	byOperation := ledger.ByOperation()
+	for _, operation := range usage.SortedKeys(byOperation) {
+		t := byOperation[operation]
+		summary.WriteString(fmt.Sprintf("| %s | %d | %d | %d | $%.2f |\n", operation, t.Calls, t.InputTokens, t.OutputTokens, t.Cost))
+	}
+	summary.WriteString(fmt.Sprintf("| **Total** | %d | %d | %d | $%.2f |\n", totals.Calls, totals.InputTokens, totals.OutputTokens, totals.Cost))
+
+	return summary.String()
+}
+
+// formatUsageTotals renders usage totals on a single line
+func formatUsageTotals(totals usage.Totals) string {
+	return fmt.Sprintf("%d calls, %d tokens, $%.2f", totals.Calls, totals.Tokens(), totals.Cost)
+}
+
+// logUsageSummary logs the AI usage of the run per operation and per file
+func logUsageSummary(ledger *usage.Ledger) {
+	totals := ledger.Totals()
+	if totals.Calls == 0 {
+		return
+	}
+
+	log := logrus.WithField("component", "usage")
+
+	byOperation := ledger.ByOperation()
+	for _, operation := range usage.SortedKeys(byOperation) {
+		log.WithFields(usageFields(byOperation[operation])).WithField("operation", operation).Info("AI usage by operation")
+	}
+
+	byFile := ledger.ByFile()
+	for _, file := range usage.SortedKeys(byFile) {
+		log.WithFields(usageFields(byFile[file])).WithField("file", file).Debug("AI usage by file")
+	}
+
+	log.WithFields(usageFields(totals)).Info("AI usage of the run")
+}
+
+func usageFields(totals usage.Totals) logrus.Fields {
+	return logrus.Fields{
+		"calls":              totals.Calls,
+		"input_tokens":       totals.InputTokens,
+		"output_tokens":      totals.OutputTokens,
+		"cache_read_tokens":  totals.CacheReadTokens,
+		"cache_write_tokens": totals.CacheWriteTokens,
+		"cost_usd":           fmt.Sprintf("%.4f", totals.Cost),
+	}
+}
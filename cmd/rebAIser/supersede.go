@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// staleRebasePRs returns the open rebase PRs of earlier runs, newest first,
+// if the supersede policy replaces them. PRs people worked on are returned
+// apart, they are kept open.
+func staleRebasePRs(ctx context.Context, cfg *config.Config, services *Services) (stale, kept []*interfaces.PullRequest) {
+	if cfg.GitHub.SupersedePolicy != config.SupersedeUpdate && cfg.GitHub.SupersedePolicy != config.SupersedeClose {
+		return nil, nil
+	}
+
+	log := logrus.WithField("component", "supersede")
+	prs, err := services.GitHub.ListPullRequests(ctx, "open")
+	if err != nil {
+		log.WithError(err).Warn("Failed to list pull requests, opening a new PR next to the old ones")
+		return nil, nil
+	}
+
+	for _, pr := range prs {
+		if !isRebasePR(cfg, pr) {
+			continue
+		}
+		if reason := humanWork(ctx, cfg, services, pr); reason != "" {
+			log.WithField("pr_number", pr.Number).Infof("Keeping rebase PR open, %s", reason)
+			kept = append(kept, pr)
+			continue
+		}
+		stale = append(stale, pr)
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].Number > stale[j].Number
+	})
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].Number > kept[j].Number
+	})
+	return stale, kept
+}
+
+// humanWork returns why people worked on a rebase PR, empty if they did not:
+// commits the rebaser did not make, or comments and reviews by someone else
+// than the PR's author. A PR that cannot be checked counts as worked on.
+func humanWork(ctx context.Context, cfg *config.Config, services *Services, pr *interfaces.PullRequest) string {
+	internalDir := fmt.Sprintf("%s/internal", cfg.ActualWorkingDir)
+	upstreamBranch := fmt.Sprintf("upstream/%s", cfg.Git.Branch)
+	commits, err := services.Git.CommitsByOthers(ctx, internalDir, upstreamBranch, pr.HeadSHA)
+	if err != nil {
+		return fmt.Sprintf("failed to check its commits: %v", err)
+	}
+	if len(commits) > 0 {
+		return fmt.Sprintf("it has %d commits by others", len(commits))
+	}
+
+	commented, err := services.GitHub.CommentedByOthers(ctx, pr.Number, pr.Author)
+	if err != nil {
+		return fmt.Sprintf("failed to check its comments: %v", err)
+	}
+	if commented {
+		return "others commented on or reviewed it"
+	}
+	return ""
+}
+
+// supersedeTarget returns the stale PR to update instead of opening a new one.
+// Only the newest one is updated, and only if it has the draft state the new
+// PR needs, as the REST API cannot turn a PR into a draft.
+func supersedeTarget(cfg *config.Config, stale []*interfaces.PullRequest, draft bool) *interfaces.PullRequest {
+	if cfg.GitHub.SupersedePolicy != config.SupersedeUpdate || len(stale) == 0 {
+		return nil
+	}
+	if stale[0].Draft != draft {
+		return nil
+	}
+	return stale[0]
+}
+
+// closeStalePRs closes the stale PRs other than pr with a comment linking it.
+// A PR that cannot be closed is left open for the next run.
+func closeStalePRs(ctx context.Context, services *Services, stale []*interfaces.PullRequest, pr *interfaces.PullRequest) {
+	log := logrus.WithField("component", "supersede")
+
+	comment := fmt.Sprintf("Superseded by #%d, which is rebased onto the current upstream.", pr.Number)
+	for _, old := range stale {
+		if old.Number == pr.Number {
+			continue
+		}
+		if err := services.GitHub.ClosePullRequest(ctx, old.Number, comment); err != nil {
+			log.WithError(err).WithField("pr_number", old.Number).Warn("Failed to close superseded pull request")
+			continue
+		}
+		log.WithFields(logrus.Fields{
+			"pr_number":     old.Number,
+			"superseded_by": pr.Number,
+		}).Info("Closed superseded pull request")
+	}
+}
+
+// formatKeptPRs mentions the earlier rebase PRs that were kept open because
+// people worked on them
+func formatKeptPRs(kept []*interfaces.PullRequest) string {
+	if len(kept) == 0 {
+		return ""
+	}
+
+	numbers := make([]string, len(kept))
+	for i, pr := range kept {
+		numbers[i] = fmt.Sprintf("#%d", pr.Number)
+	}
+	return fmt.Sprintf("\n\n## Earlier Rebase PRs\n\n%s were kept open, as people worked on them. Carry their changes over before closing them.\n",
+		strings.Join(numbers, ", "))
+}
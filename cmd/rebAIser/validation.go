@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/markers"
+	"github.com/BlindspotSoftware/rebAIser/internal/validate"
+)
+
+var (
+	// errInvalidResolution marks AI resolutions rejected by validation
+	errInvalidResolution = errors.New("invalid resolution")
+	// errUnresolved is returned for conflicts without a valid AI resolution
+	errUnresolved = errors.New("no valid resolution")
+	// errNeedsHuman marks conflicts the AI cannot be asked to resolve
+	errNeedsHuman = errors.New("conflict needs a human")
+)
+
+// needsHumanError is an errNeedsHuman with the reason the conflict is left
+// for a human
+type needsHumanError struct {
+	reason string
+}
+
+func needsHuman(format string, args ...any) error {
+	return &needsHumanError{reason: fmt.Sprintf(format, args...)}
+}
+
+func (e *needsHumanError) Error() string {
+	return fmt.Sprintf("%s: %s", errNeedsHuman, e.reason)
+}
+
+func (e *needsHumanError) Is(target error) bool {
+	return target == errNeedsHuman
+}
+
+// aiFailureError is returned for conflicts the AI failed to resolve
+type aiFailureError struct {
+	file string
+	err  error
+}
+
+func (e *aiFailureError) Error() string {
+	return fmt.Sprintf("AI failed to resolve conflict in %s: %v", e.file, e.err)
+}
+
+func (e *aiFailureError) Unwrap() error {
+	return e.err
+}
+
+// validateHunk checks the resolution of a single conflict hunk
+func validateHunk(conflict interfaces.GitConflict, hunk interfaces.ConflictHunk, resolution string) error {
+	if err := validate.Markers(resolution, conflictMarkerSize(conflict)); err != nil {
+		return fmt.Errorf("%w: hunk at lines %d-%d: %v", errInvalidResolution, hunk.StartLine, hunk.EndLine, err)
+	}
+	if err := validate.Size(resolution, hunk.Ours, hunk.Theirs); err != nil {
+		return fmt.Errorf("%w: hunk at lines %d-%d: %v", errInvalidResolution, hunk.StartLine, hunk.EndLine, err)
+	}
+	return nil
+}
+
+// validateResolution checks the resolved content of a whole file
+func validateResolution(ctx context.Context, cfg *config.Config, conflict interfaces.GitConflict, resolution string) error {
+	if err := validate.Markers(resolution, conflictMarkerSize(conflict)); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidResolution, err)
+	}
+
+	ours, theirs := conflictVersions(conflict)
+	if err := validate.Size(resolution, ours, theirs); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidResolution, err)
+	}
+
+	// Only hold the resolution to a syntax check the upstream version
+	// passes, some files cannot be checked on their own
+	if cfg.AI.Validation.SyntaxChecks && validate.HasSyntaxCheck(conflict.File) &&
+		validate.Syntax(ctx, conflict.File, ours) == nil {
+		if err := validate.Syntax(ctx, conflict.File, resolution); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidResolution, err)
+		}
+	}
+
+	return nil
+}
+
+// conflictVersions rebuilds the complete upstream and internal versions of a
+// conflicted file by replacing every hunk with the respective side
+func conflictVersions(conflict interfaces.GitConflict) (string, string) {
+	if len(conflict.Hunks) == 0 {
+		return conflict.Content, conflict.Content
+	}
+
+	ours := make([]string, len(conflict.Hunks))
+	theirs := make([]string, len(conflict.Hunks))
+	for i, hunk := range conflict.Hunks {
+		ours[i] = hunk.Ours
+		theirs[i] = hunk.Theirs
+	}
+
+	oursFile, err := markers.Splice(conflict.Content, conflict.Hunks, ours)
+	if err != nil {
+		return conflict.Content, conflict.Content
+	}
+	theirsFile, err := markers.Splice(conflict.Content, conflict.Hunks, theirs)
+	if err != nil {
+		return conflict.Content, conflict.Content
+	}
+	return oursFile, theirsFile
+}
+
+func conflictMarkerSize(conflict interfaces.GitConflict) int {
+	if conflict.MarkerSize > 0 {
+		return conflict.MarkerSize
+	}
+	return markers.DefaultSize
+}
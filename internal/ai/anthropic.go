@@ -0,0 +1,189 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicBaseURL = "https://api.anthropic.com"
+	anthropicVersion = "2023-06-01"
+)
+
+// anthropicProvider talks to the Anthropic Messages API
+type anthropicProvider struct {
+	httpClient *http.Client
+	apiKey     string
+	baseURL    string
+	model      string
+}
+
+func newAnthropicProvider(apiKey, baseURL, model string, timeout time.Duration) *anthropicProvider {
+	if baseURL == "" {
+		baseURL = anthropicBaseURL
+	}
+
+	return &anthropicProvider{
+		httpClient: &http.Client{Timeout: timeout},
+		apiKey:     apiKey,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		model:      model,
+	}
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      []anthropicContent `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Temperature float32            `json:"temperature"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolUse  `json:"tool_choice,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolUse struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicMessage struct {
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content"`
+}
+
+type anthropicContent struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text,omitempty"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+	// Input is the input of a tool_use block in responses
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+type anthropicResponse struct {
+	Content    []anthropicContent `json:"content"`
+	StopReason string             `json:"stop_reason"`
+	Usage      struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *anthropicProvider) complete(ctx context.Context, request completionRequest) (*completionResponse, error) {
+	body := anthropicRequest{
+		Model:       p.model,
+		MaxTokens:   request.MaxTokens,
+		Temperature: request.Temperature,
+	}
+	if request.System != "" {
+		body.System = []anthropicContent{{Type: "text", Text: request.System}}
+	}
+
+	// The context goes first and ends with a cache breakpoint, so retries
+	// and the other hunks of a conflict reuse it
+	var content []anthropicContent
+	if request.Context != "" {
+		content = append(content, anthropicContent{
+			Type:         "text",
+			Text:         request.Context,
+			CacheControl: &anthropicCacheControl{Type: "ephemeral"},
+		})
+	}
+	content = append(content, anthropicContent{Type: "text", Text: request.Prompt})
+	body.Messages = []anthropicMessage{{Role: "user", Content: content}}
+
+	// Structured responses are the input of a tool the model must call
+	if request.Schema != nil {
+		body.Tools = []anthropicTool{{
+			Name:        request.Schema.Name,
+			Description: request.Schema.Description,
+			InputSchema: request.Schema.Schema,
+		}}
+		body.ToolChoice = &anthropicToolUse{Type: "tool", Name: request.Schema.Name}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/v1/messages", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr anthropicError
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			err := fmt.Errorf("status %d: %s: %s", resp.StatusCode, apiErr.Error.Type, apiErr.Error.Message)
+			if strings.HasPrefix(apiErr.Error.Message, "prompt is too long") {
+				return nil, fmt.Errorf("%w: %v", ErrPromptTooLarge, err)
+			}
+			return nil, err
+		}
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var result anthropicResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range result.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			text.Write(block.Input)
+		}
+	}
+
+	return &completionResponse{
+		Content:   text.String(),
+		Truncated: result.StopReason == "max_tokens",
+		// Cached tokens are billed separately and not part of input_tokens
+		InputTokens:      result.Usage.InputTokens + result.Usage.CacheCreationInputTokens + result.Usage.CacheReadInputTokens,
+		OutputTokens:     result.Usage.OutputTokens,
+		CacheReadTokens:  result.Usage.CacheReadInputTokens,
+		CacheWriteTokens: result.Usage.CacheCreationInputTokens,
+	}, nil
+}
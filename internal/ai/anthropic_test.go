@@ -0,0 +1,142 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+func TestAnthropicProvider_Complete(t *testing.T) {
+	var received anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		w.Write([]byte(`{
+			"content": [{"type": "text", "text": "resolved code"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 10, "output_tokens": 5, "cache_creation_input_tokens": 100, "cache_read_input_tokens": 0}
+		}`))
+	}))
+	defer server.Close()
+
+	p := newAnthropicProvider("test-key", server.URL, "claude-sonnet-4-5", 0)
+	resp, err := p.complete(context.Background(), completionRequest{
+		System:      "system prompt",
+		Context:     "large file context",
+		Prompt:      "instructions",
+		MaxTokens:   1000,
+		Temperature: 0.1,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "claude-sonnet-4-5", received.Model)
+	assert.Equal(t, 1000, received.MaxTokens)
+	require.Len(t, received.System, 1)
+	assert.Equal(t, "system prompt", received.System[0].Text)
+
+	require.Len(t, received.Messages, 1)
+	assert.Equal(t, "user", received.Messages[0].Role)
+	require.Len(t, received.Messages[0].Content, 2)
+	assert.Equal(t, "large file context", received.Messages[0].Content[0].Text)
+	require.NotNil(t, received.Messages[0].Content[0].CacheControl)
+	assert.Equal(t, "ephemeral", received.Messages[0].Content[0].CacheControl.Type)
+	assert.Equal(t, "instructions", received.Messages[0].Content[1].Text)
+	assert.Nil(t, received.Messages[0].Content[1].CacheControl)
+
+	assert.Equal(t, "resolved code", resp.Content)
+	assert.False(t, resp.Truncated)
+	assert.Equal(t, 110, resp.InputTokens)
+	assert.Equal(t, 5, resp.OutputTokens)
+	assert.Equal(t, 100, resp.CacheWriteTokens)
+	assert.Equal(t, 115, resp.totalTokens())
+}
+
+func TestAnthropicProvider_NoContextNoCacheBreakpoint(t *testing.T) {
+	var received anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Write([]byte(`{"content": [{"type": "text", "text": "feat: x"}], "stop_reason": "end_turn"}`))
+	}))
+	defer server.Close()
+
+	p := newAnthropicProvider("test-key", server.URL, "claude-sonnet-4-5", 0)
+	_, err := p.complete(context.Background(), completionRequest{Prompt: "message", MaxTokens: 100})
+	require.NoError(t, err)
+
+	assert.Empty(t, received.System)
+	require.Len(t, received.Messages[0].Content, 1)
+	assert.Nil(t, received.Messages[0].Content[0].CacheControl)
+}
+
+func TestAnthropicProvider_MaxTokensStopReason(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"content": [{"type": "text", "text": "partial"}], "stop_reason": "max_tokens"}`))
+	}))
+	defer server.Close()
+
+	service := NewService(config.ProviderAnthropic, "test-key", server.URL, "claude-sonnet-4-5", 10)
+	_, err := service.ResolveConflict(context.Background(), interfaces.GitConflict{
+		File:    "test.go",
+		Content: "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x",
+	})
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestAnthropicProvider_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+
+	service := NewService(config.ProviderAnthropic, "bad-key", server.URL, "claude-sonnet-4-5", 100)
+	_, err := service.GenerateCommitMessage(context.Background(), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "anthropic API call failed")
+	assert.Contains(t, err.Error(), "status 401: authentication_error: invalid x-api-key")
+}
+
+func TestAnthropicProvider_SchemaForcesTool(t *testing.T) {
+	var received anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Write([]byte(`{
+			"content": [{"type": "tool_use", "name": "conflict_resolution", "input": {"resolution": "b", "confidence": 0.7, "strategy": "theirs", "rationale": "Upstream fixed it", "risks": ["timing"]}}],
+			"stop_reason": "tool_use"
+		}`))
+	}))
+	defer server.Close()
+
+	service := NewService(config.ProviderAnthropic, "test-key", server.URL, "claude-sonnet-4-5", 100)
+	resolution, err := service.ResolveConflict(context.Background(), interfaces.GitConflict{
+		File:    "test.go",
+		Content: "<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, received.Tools, 1)
+	assert.Equal(t, "conflict_resolution", received.Tools[0].Name)
+	assert.Contains(t, string(received.Tools[0].InputSchema), `"confidence"`)
+	require.NotNil(t, received.ToolChoice)
+	assert.Equal(t, anthropicToolUse{Type: "tool", Name: "conflict_resolution"}, *received.ToolChoice)
+
+	assert.Equal(t, &interfaces.ConflictResolution{
+		Resolution: "b",
+		Confidence: 0.7,
+		Strategy:   interfaces.StrategyTheirs,
+		Rationale:  "Upstream fixed it",
+		Risks:      []string{"timing"},
+	}, resolution)
+}
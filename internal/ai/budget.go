@@ -0,0 +1,121 @@
+package ai
+
+import (
+	"strings"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// modelContextWindows lists the context window in tokens of models that are
+// only known by their exact name, as other models share their name as prefix
+var modelContextWindows = map[string]int{
+	"gpt-4":      8192,
+	"gpt-4-0314": 8192,
+	"gpt-4-0613": 8192,
+}
+
+// contextWindows lists the context window in tokens of known models by model
+// name prefix. The longest matching prefix wins.
+var contextWindows = map[string]int{
+	"gpt-4-32k":     32768,
+	"gpt-4-turbo":   128000,
+	"gpt-4-1106":    128000,
+	"gpt-4-0125":    128000,
+	"gpt-4-vision":  128000,
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-4.5":       128000,
+	"gpt-5":         400000,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"o4-mini":       200000,
+	"claude-":       200000,
+	"llama-3.1-":    131072,
+	"llama-3.3-":    131072,
+}
+
+// knownContextWindow returns the context window of a known model, or zero.
+// Provider prefixes of routed model names like "openai/gpt-4o" are ignored.
+func knownContextWindow(model string) int {
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	if window, ok := modelContextWindows[model]; ok {
+		return window
+	}
+
+	window, length := 0, 0
+	for prefix, size := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > length {
+			window, length = size, len(prefix)
+		}
+	}
+	return window
+}
+
+// estimateRequest estimates the prompt tokens of a request
+func estimateRequest(request completionRequest) int {
+	return estimateTokens(request.System + request.Context + request.Prompt)
+}
+
+// fits reports whether a request and its response fit a context window. A
+// zero window is unknown and fits everything.
+func fits(request completionRequest, contextWindow int) bool {
+	return contextWindow == 0 || estimateRequest(request)+request.MaxTokens <= contextWindow
+}
+
+// Prompt detail levels, from the most to the least context. Prompts that do
+// not fit a model's context window are rebuilt with less detail.
+const (
+	detailFull = iota
+	// detailCompact drops the sections that repeat the conflict content
+	// and the diff of the internal patch
+	detailCompact
+	// detailMinimal also drops the commit bodies and upstream history and
+	// trims the code around hunks
+	detailMinimal
+)
+
+// minimalHunkContext is the number of lines kept around a hunk at detailMinimal
+const minimalHunkContext = 3
+
+// reduceConflict removes context from a conflict for a detail level
+func reduceConflict(conflict interfaces.GitConflict, detail int) interfaces.GitConflict {
+	if detail >= detailCompact {
+		// The conflict markers in Content already show both sides
+		conflict.Ours = ""
+		conflict.Theirs = ""
+		conflict.Commit.Diff = ""
+	}
+	if detail >= detailMinimal {
+		conflict.Commit.Body = ""
+		conflict.UpstreamCommits = nil
+	}
+	return conflict
+}
+
+// reduceHunk trims the code around a hunk for a detail level
+func reduceHunk(hunk interfaces.ConflictHunk, detail int) interfaces.ConflictHunk {
+	if detail >= detailMinimal {
+		hunk.Before = lastLines(hunk.Before, minimalHunkContext)
+		hunk.After = firstLines(hunk.After, minimalHunkContext)
+	}
+	return hunk
+}
+
+func firstLines(text string, n int) string {
+	lines := strings.SplitAfter(text, "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return strings.TrimSuffix(strings.Join(lines[:n], ""), "\n")
+}
+
+func lastLines(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return strings.Join(lines[len(lines)-n:], "\n")
+}
@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// recordingProvider records the requests it receives. It answers with content,
+// or a resolution if content is empty.
+type recordingProvider struct {
+	requests []completionRequest
+	content  string
+	err      error
+}
+
+func (p *recordingProvider) complete(ctx context.Context, request completionRequest) (*completionResponse, error) {
+	p.requests = append(p.requests, request)
+	if p.err != nil {
+		return nil, p.err
+	}
+	content := p.content
+	if content == "" {
+		content = resolutionJSON("resolved")
+	}
+	return &completionResponse{Content: content, InputTokens: estimateRequest(request)}, nil
+}
+
+func TestKnownContextWindow(t *testing.T) {
+	assert.Equal(t, 8192, knownContextWindow("gpt-4"))
+	assert.Equal(t, 8192, knownContextWindow("gpt-4-0613"))
+	assert.Equal(t, 32768, knownContextWindow("gpt-4-32k-0613"))
+	assert.Equal(t, 128000, knownContextWindow("gpt-4-turbo"))
+	assert.Equal(t, 128000, knownContextWindow("gpt-4-1106-preview"))
+	assert.Equal(t, 128000, knownContextWindow("gpt-4o"))
+	assert.Equal(t, 1047576, knownContextWindow("gpt-4.1-mini"))
+	assert.Equal(t, 128000, knownContextWindow("openai/gpt-4o"))
+	assert.Equal(t, 0, knownContextWindow("gpt-4-future-model"))
+	assert.Equal(t, 128000, knownContextWindow("gpt-4o-mini"))
+	assert.Equal(t, 200000, knownContextWindow("claude-sonnet-4-5"))
+	assert.Equal(t, 200000, knownContextWindow("anthropic/claude-3.5-sonnet"))
+	assert.Equal(t, 0, knownContextWindow("llama3"))
+}
+
+func largeConflict() interfaces.GitConflict {
+	side := strings.Repeat("line of code\n", 500)
+	return interfaces.GitConflict{
+		File:    "big.c",
+		Content: "<<<<<<< HEAD\n" + side + "=======\n" + side + ">>>>>>> x\n",
+		Ours:    side,
+		Theirs:  side,
+		Commit: interfaces.CommitInfo{
+			SHA:     "1a2b3c4",
+			Subject: "Tune timings",
+			Body:    "Long explanation",
+			Diff:    strings.Repeat("+diff line\n", 200),
+		},
+	}
+}
+
+func TestResolveConflict_DropsDetailToFit(t *testing.T) {
+	recorder := &recordingProvider{}
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationResolveConflict: {{client: recorder, provider: config.ProviderOpenAI, model: "gpt-4", contextWindow: 5000}},
+	})
+
+	_, err := service.ResolveConflict(context.Background(), largeConflict())
+	require.NoError(t, err)
+
+	require.Len(t, recorder.requests, 1)
+	conflictContext := recorder.requests[0].Context
+	assert.NotContains(t, conflictContext, "The conflict markers show")
+	assert.NotContains(t, conflictContext, "+diff line")
+	assert.Contains(t, conflictContext, "Subject: Tune timings")
+	assert.Contains(t, conflictContext, "Long explanation")
+}
+
+func TestResolveConflict_RefusesWhenNothingFits(t *testing.T) {
+	recorder := &recordingProvider{}
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationResolveConflict: {{client: recorder, provider: config.ProviderOpenAI, model: "gpt-4", contextWindow: 1000}},
+	})
+
+	_, err := service.ResolveConflict(context.Background(), largeConflict())
+	assert.ErrorIs(t, err, ErrPromptTooLarge)
+	assert.Empty(t, recorder.requests)
+}
+
+func TestResolveConflictHunk_ProviderRejectsPrompt(t *testing.T) {
+	// Without a known context window the provider's error is the signal
+	recorder := &recordingProvider{err: errors.Join(ErrPromptTooLarge, errors.New("context_length_exceeded"))}
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationResolveConflict: {{client: recorder, provider: config.ProviderLocal}},
+	})
+
+	hunk := interfaces.ConflictHunk{
+		StartLine: 10,
+		EndLine:   14,
+		Ours:      "a",
+		Theirs:    "b",
+		Before:    "1\n2\n3\n4\n5",
+		After:     "6\n7\n8\n9\n10\n",
+	}
+	_, err := service.ResolveConflictHunk(context.Background(), largeConflict(), hunk)
+	assert.ErrorIs(t, err, ErrPromptTooLarge)
+
+	// Every detail level was tried, the last one trims the surrounding code
+	require.Len(t, recorder.requests, 3)
+	assert.Contains(t, recorder.requests[0].Prompt, "1\n2\n3\n4\n5")
+	assert.Contains(t, recorder.requests[2].Prompt, "before the conflicting region:\n3\n4\n5\n")
+	assert.Contains(t, recorder.requests[2].Prompt, "after the conflicting region:\n6\n7\n8\n")
+	assert.NotContains(t, recorder.requests[2].Context, "Long explanation")
+}
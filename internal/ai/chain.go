@@ -0,0 +1,156 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/usage"
+)
+
+// Model selects a model of a provider
+type Model struct {
+	Provider string
+	APIKey   string
+	// BaseURL overrides the provider's default endpoint
+	BaseURL string
+	Model   string
+}
+
+// backend is a provider client for one model
+type backend struct {
+	client   provider
+	provider string
+	model    string
+	// contextWindow is the model's context window in tokens, zero if unknown
+	contextWindow int
+}
+
+func newBackend(model Model, opts Options) backend {
+	var client provider
+	switch model.Provider {
+	case config.ProviderAnthropic:
+		client = newAnthropicProvider(model.APIKey, model.BaseURL, model.Model, opts.Timeout)
+	case config.ProviderLocal:
+		client = newLocalProvider(model.BaseURL, model.Model, opts.ContextWindow, opts.Timeout)
+	default:
+		// OpenRouter speaks the OpenAI API
+		client = newOpenAIProvider(model.APIKey, model.BaseURL, model.Model, opts.Timeout)
+	}
+
+	// The configured window only applies to local models, hosted models
+	// have a known window
+	contextWindow := knownContextWindow(model.Model)
+	if model.Provider == config.ProviderLocal && opts.ContextWindow > 0 {
+		contextWindow = opts.ContextWindow
+	}
+
+	return backend{client: client, provider: model.Provider, model: model.Model, contextWindow: contextWindow}
+}
+
+// chain returns the models to try for an operation
+func (s *Service) chain(operation string) []backend {
+	if chain := s.chains[operation]; len(chain) > 0 {
+		return chain
+	}
+	return []backend{{client: s.client, provider: s.provider, model: s.model, contextWindow: s.contextWindow}}
+}
+
+// complete sends a completion request to the models of an operation in
+// order until one succeeds. Errors such as rate limits, outages and exceeded
+// context windows fall back to the next model. attempt is the number of
+// earlier results that were rejected, each rejection also moves on to the
+// next model so a retry does not ask the model that failed again.
+//
+// requests are variants of the same request with less and less detail. Each
+// model gets the most detailed variant that fits its context window.
+func (s *Service) complete(ctx context.Context, operation string, attempt int, requests ...completionRequest) (*completionResponse, error) {
+	chain := s.chain(operation)
+	return s.completeChain(ctx, operation, chain[min(attempt, len(chain)-1):], requests)
+}
+
+// completeChain sends a completion request to the given models in order
+// until one succeeds
+func (s *Service) completeChain(ctx context.Context, operation string, chain []backend, requests []completionRequest) (*completionResponse, error) {
+	// Running out of budget is not a model failure, so don't fall back
+	if err := s.ledger.Check(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	for i, b := range chain {
+		log := s.log.WithFields(logrus.Fields{
+			"operation": operation,
+			"provider":  b.provider,
+			"model":     b.model,
+		})
+
+		var resp *completionResponse
+		resp, err = s.completeWith(ctx, log, b, requests)
+		if err == nil {
+			s.ledger.Record(usage.Record{
+				Operation:        operation,
+				File:             requests[0].File,
+				Provider:         b.provider,
+				Model:            b.model,
+				InputTokens:      resp.InputTokens,
+				OutputTokens:     resp.OutputTokens,
+				CacheReadTokens:  resp.CacheReadTokens,
+				CacheWriteTokens: resp.CacheWriteTokens,
+			})
+			return resp, nil
+		}
+
+		err = fmt.Errorf("%s API call failed: %w", b.provider, err)
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if i < len(chain)-1 {
+			log.WithError(err).Warn("Model failed, falling back to the next one")
+		}
+	}
+
+	return nil, err
+}
+
+// completeWith sends the most detailed request variant that fits the model
+func (s *Service) completeWith(ctx context.Context, log *logrus.Entry, b backend, requests []completionRequest) (*completionResponse, error) {
+	var err error
+	for detail, request := range requests {
+		estimated := estimateRequest(request)
+		if !fits(request, b.contextWindow) {
+			err = fmt.Errorf("%w: about %d tokens and %d for the response exceed the context window of %d",
+				ErrPromptTooLarge, estimated, request.MaxTokens, b.contextWindow)
+			continue
+		}
+
+		var resp *completionResponse
+		resp, err = b.client.complete(ctx, request)
+		if errors.Is(err, ErrPromptTooLarge) {
+			// The provider knows better, try with less detail
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		log.WithFields(logrus.Fields{
+			"detail":           detail,
+			"estimated_tokens": estimated,
+			"input_tokens":     resp.InputTokens,
+			"output_tokens":    resp.OutputTokens,
+		}).Debug("Token usage")
+		if resp.CacheReadTokens > 0 || resp.CacheWriteTokens > 0 {
+			log.WithFields(logrus.Fields{
+				"cache_read_tokens":  resp.CacheReadTokens,
+				"cache_write_tokens": resp.CacheWriteTokens,
+			}).Debug("Prompt cache used")
+		}
+		return resp, nil
+	}
+
+	return nil, err
+}
@@ -0,0 +1,221 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/usage"
+)
+
+// fakeProvider returns a fixed response or error and counts its calls
+type fakeProvider struct {
+	content string
+	err     error
+	calls   int
+}
+
+func (p *fakeProvider) complete(ctx context.Context, request completionRequest) (*completionResponse, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &completionResponse{Content: p.content, InputTokens: 1000, OutputTokens: 100}, nil
+}
+
+// resolutionJSON is a structured resolution response for code
+func resolutionJSON(code string) string {
+	resolution, _ := json.Marshal(code)
+	return `{"resolution": ` + string(resolution) + `, "confidence": 0.9, "strategy": "combined", "rationale": "Kept both", "risks": []}`
+}
+
+func newChainService(primary *fakeProvider, chains map[string][]backend) *Service {
+	return &Service{
+		client:    primary,
+		provider:  config.ProviderOpenAI,
+		model:     "gpt-4",
+		maxTokens: 100,
+		log:       logrus.WithField("component", "ai"),
+		chains:    chains,
+	}
+}
+
+func TestComplete_FallsBackOnError(t *testing.T) {
+	failing := &fakeProvider{err: errors.New("429 rate limit exceeded")}
+	working := &fakeProvider{content: resolutionJSON("resolved code")}
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationResolveConflict: {
+			{client: failing, provider: config.ProviderAnthropic, model: "claude-sonnet-4-5"},
+			{client: working, provider: config.ProviderOpenAI, model: "gpt-4"},
+		},
+	})
+
+	resolution, err := service.ResolveConflict(context.Background(), interfaces.GitConflict{File: "main.c"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "resolved code", resolution.Resolution)
+	assert.Equal(t, 1, failing.calls)
+	assert.Equal(t, 1, working.calls)
+}
+
+func TestComplete_RejectedAttemptUsesNextModel(t *testing.T) {
+	first := &fakeProvider{content: resolutionJSON("first")}
+	second := &fakeProvider{content: resolutionJSON("second")}
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationResolveConflict: {
+			{client: first, provider: config.ProviderAnthropic, model: "claude-sonnet-4-5"},
+			{client: second, provider: config.ProviderOpenAI, model: "gpt-4"},
+		},
+	})
+
+	conflict := interfaces.GitConflict{File: "main.c", Feedback: []string{"resolution still contains conflict markers"}}
+	resolution, err := service.ResolveConflict(context.Background(), conflict)
+	require.NoError(t, err)
+	assert.Equal(t, "second", resolution.Resolution)
+
+	// Further retries stay on the last model
+	conflict.Feedback = append(conflict.Feedback, "still broken")
+	resolution, err = service.ResolveConflict(context.Background(), conflict)
+	require.NoError(t, err)
+	assert.Equal(t, "second", resolution.Resolution)
+	assert.Equal(t, 0, first.calls)
+}
+
+func TestComplete_OperationWithoutChainUsesDefaultModel(t *testing.T) {
+	primary := &fakeProvider{content: "feat: update"}
+	cheap := &fakeProvider{content: "unused"}
+	service := newChainService(primary, map[string][]backend{
+		config.OperationPRDescription: {{client: cheap, provider: config.ProviderOpenAI, model: "gpt-4o-mini"}},
+	})
+
+	message, err := service.GenerateCommitMessage(context.Background(), []string{"main.c"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "feat: update", message)
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 0, cheap.calls)
+}
+
+func TestComplete_AllModelsFail(t *testing.T) {
+	first := &fakeProvider{err: errors.New("connection refused")}
+	second := &fakeProvider{err: errors.New("context_length_exceeded")}
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationRepair: {
+			{client: first, provider: config.ProviderLocal},
+			{client: second, provider: config.ProviderOpenAI, model: "gpt-4"},
+		},
+	})
+
+	_, err := service.RepairBuild(context.Background(), interfaces.RepairRequest{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "openai API call failed: context_length_exceeded")
+	assert.Equal(t, 1, first.calls)
+}
+
+func TestComplete_CanceledContextDoesNotFallBack(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	first := &fakeProvider{err: context.Canceled}
+	second := &fakeProvider{content: "unused"}
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationCommitMessage: {
+			{client: first, provider: config.ProviderOpenAI, model: "gpt-4o-mini"},
+			{client: second, provider: config.ProviderOpenAI, model: "gpt-4"},
+		},
+	})
+
+	_, err := service.GenerateCommitMessage(ctx, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, second.calls)
+}
+
+func TestComplete_RecordsUsageAndStopsAtLimit(t *testing.T) {
+	primary := &fakeProvider{content: resolutionJSON("resolved code")}
+	service := newChainService(primary, nil)
+	service.ledger = usage.NewLedger(map[string]usage.Price{"gpt-4": {Input: 30, Output: 60}}, usage.Limits{MaxCost: 0.01})
+
+	_, err := service.ResolveConflict(context.Background(), interfaces.GitConflict{File: "main.c"})
+	require.NoError(t, err)
+
+	records := service.ledger.Records()
+	require.Len(t, records, 1)
+	assert.Equal(t, usage.Record{
+		Operation:    config.OperationResolveConflict,
+		File:         "main.c",
+		Provider:     config.ProviderOpenAI,
+		Model:        "gpt-4",
+		InputTokens:  1000,
+		OutputTokens: 100,
+		Cost:         0.036,
+	}, records[0])
+
+	// The first call used up the budget, the next one is refused without a call
+	_, err = service.GeneratePRDescription(context.Background(), nil, nil)
+	assert.ErrorIs(t, err, usage.ErrLimitExceeded)
+	assert.Equal(t, 1, primary.calls)
+}
+
+func TestComplete_RecordsCacheTokens(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"content": [{"type": "text", "text": "feat: update pads"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 1000, "output_tokens": 100, "cache_creation_input_tokens": 1000, "cache_read_input_tokens": 8000}
+		}`))
+	}))
+	defer server.Close()
+
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationCommitMessage: {{
+			client:   newAnthropicProvider("test-key", server.URL, "claude-sonnet-4-5", 0),
+			provider: config.ProviderAnthropic,
+			model:    "claude-sonnet-4-5",
+		}},
+	})
+	service.ledger = usage.NewLedger(map[string]usage.Price{"claude-sonnet-4-5": {Input: 3, Output: 15}}, usage.Limits{})
+
+	_, err := service.GenerateCommitMessage(context.Background(), nil)
+	require.NoError(t, err)
+
+	records := service.ledger.Records()
+	require.Len(t, records, 1)
+	assert.Equal(t, 10000, records[0].InputTokens)
+	assert.Equal(t, 8000, records[0].CacheReadTokens)
+	assert.Equal(t, 1000, records[0].CacheWriteTokens)
+	// Cache reads cost a tenth of the input price, not all of it
+	assert.InDelta(t, 0.01065, records[0].Cost, 1e-9)
+}
+
+func TestNewBackend_ContextWindowOnlyForLocalModels(t *testing.T) {
+	service := New(Options{
+		Provider:      config.ProviderAnthropic,
+		APIKey:        "test-key",
+		Model:         "claude-sonnet-4-5",
+		MaxTokens:     100,
+		ContextWindow: 32768,
+		Operations: map[string][]Model{
+			config.OperationResolveConflict: {
+				{Provider: config.ProviderOpenAI, APIKey: "test-key", Model: "gpt-4"},
+				{Provider: config.ProviderOpenAI, APIKey: "test-key", Model: "gpt-4o"},
+				{Provider: config.ProviderLocal, Model: "llama3"},
+			},
+		},
+	}).(*Service)
+
+	assert.Equal(t, 200000, service.contextWindow)
+	chain := service.chain(config.OperationResolveConflict)
+	require.Len(t, chain, 3)
+	assert.Equal(t, 8192, chain[0].contextWindow)
+	assert.Equal(t, 128000, chain[1].contextWindow)
+	assert.Equal(t, 32768, chain[2].contextWindow)
+}
@@ -0,0 +1,193 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+)
+
+const (
+	localBaseURL = "http://localhost:11434/v1"
+	localTimeout = 10 * time.Minute
+)
+
+// localProvider talks to a self-hosted OpenAI compatible server such as
+// Ollama, llama.cpp or vLLM. It needs no API key, discovers the served models
+// through /v1/models and keeps requests within the model's context window.
+type localProvider struct {
+	client     *openai.Client
+	httpClient *http.Client
+	baseURL    string
+	log        *logrus.Entry
+
+	mu            sync.Mutex
+	chat          *openAIProvider
+	model         string
+	contextWindow int
+}
+
+func newLocalProvider(baseURL, model string, contextWindow int, timeout time.Duration) *localProvider {
+	if baseURL == "" {
+		baseURL = localBaseURL
+	}
+	if timeout == 0 {
+		timeout = localTimeout
+	}
+
+	httpClient := &http.Client{Timeout: timeout}
+	clientConfig := openai.DefaultConfig("")
+	clientConfig.BaseURL = strings.TrimSuffix(baseURL, "/")
+	clientConfig.HTTPClient = httpClient
+
+	return &localProvider{
+		client:        openai.NewClientWithConfig(clientConfig),
+		httpClient:    httpClient,
+		baseURL:       clientConfig.BaseURL,
+		log:           logrus.WithField("component", "ai").WithField("provider", config.ProviderLocal),
+		model:         model,
+		contextWindow: contextWindow,
+	}
+}
+
+type localModelList struct {
+	Data []localModel `json:"data"`
+}
+
+type localModel struct {
+	ID string `json:"id"`
+	// MaxModelLen is reported by vLLM
+	MaxModelLen int `json:"max_model_len"`
+	// Meta is reported by llama.cpp
+	Meta struct {
+		ContextLength int `json:"n_ctx_train"`
+	} `json:"meta"`
+}
+
+func (m localModel) contextWindow() int {
+	if m.MaxModelLen > 0 {
+		return m.MaxModelLen
+	}
+	return m.Meta.ContextLength
+}
+
+// matches reports whether the model is served under the given name. Ollama
+// lists models with their tag, but also accepts them without ":latest".
+func (m localModel) matches(name string) bool {
+	return m.ID == name || m.ID == name+":latest"
+}
+
+// listModels returns the models served by the local server
+func (p *localProvider) listModels(ctx context.Context) ([]localModel, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var list localModelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode model list: %w", err)
+	}
+
+	return list.Data, nil
+}
+
+// prepare discovers the model on first use. Without a configured model the
+// first served model is used.
+func (p *localProvider) prepare(ctx context.Context) (*openAIProvider, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.chat != nil {
+		return p.chat, p.contextWindow, nil
+	}
+
+	models, err := p.listModels(ctx)
+	if err != nil {
+		if p.model == "" {
+			return nil, 0, fmt.Errorf("model discovery at %s failed: %w", p.baseURL, err)
+		}
+		p.log.WithError(err).Warn("Model discovery failed, using the configured model")
+		models = nil
+	}
+
+	if models != nil {
+		if len(models) == 0 {
+			return nil, 0, fmt.Errorf("no models served at %s", p.baseURL)
+		}
+
+		var found *localModel
+		if p.model == "" {
+			found = &models[0]
+		} else {
+			for i := range models {
+				if models[i].matches(p.model) {
+					found = &models[i]
+					break
+				}
+			}
+		}
+
+		if found == nil {
+			ids := make([]string, len(models))
+			for i, m := range models {
+				ids[i] = m.ID
+			}
+			return nil, 0, fmt.Errorf("model %q is not served at %s (available: %s)", p.model, p.baseURL, strings.Join(ids, ", "))
+		}
+
+		if p.model == "" {
+			p.model = found.ID
+		}
+		if p.contextWindow == 0 {
+			p.contextWindow = found.contextWindow()
+		}
+	}
+
+	p.log.WithFields(logrus.Fields{
+		"model":          p.model,
+		"context_window": p.contextWindow,
+	}).Info("Using local model")
+
+	p.chat = &openAIProvider{client: p.client, model: p.model}
+	return p.chat, p.contextWindow, nil
+}
+
+func (p *localProvider) complete(ctx context.Context, request completionRequest) (*completionResponse, error) {
+	chat, contextWindow, err := p.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Local servers silently cut off prompts that exceed the context window,
+	// so refuse them and leave room for the response
+	if contextWindow > 0 {
+		promptTokens := estimateTokens(request.System + request.Context + request.Prompt)
+		if promptTokens >= contextWindow {
+			return nil, fmt.Errorf("%w: about %d tokens for a context window of %d", ErrPromptTooLarge, promptTokens, contextWindow)
+		}
+		if available := contextWindow - promptTokens; request.MaxTokens > available {
+			request.MaxTokens = available
+		}
+	}
+
+	return chat.complete(ctx, request)
+}
@@ -0,0 +1,111 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+)
+
+// fakeLocalServer is an in-process stand-in for an OpenAI compatible server
+type fakeLocalServer struct {
+	*httptest.Server
+	models   string
+	requests []openai.ChatCompletionRequest
+}
+
+func newFakeLocalServer(t *testing.T, models string) *fakeLocalServer {
+	f := &fakeLocalServer{models: models}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(f.models))
+	})
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var request openai.ChatCompletionRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		f.requests = append(f.requests, request)
+
+		w.Write([]byte(`{
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "resolved code"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 20, "completion_tokens": 3, "total_tokens": 23}
+		}`))
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestLocalProvider_DiscoversModel(t *testing.T) {
+	server := newFakeLocalServer(t, `{"object": "list", "data": [{"id": "qwen2.5-coder:14b", "max_model_len": 32768}, {"id": "llama3:latest"}]}`)
+
+	p := newLocalProvider(server.URL+"/v1", "", 0, 0)
+	resp, err := p.complete(context.Background(), completionRequest{Prompt: "resolve", MaxTokens: 100})
+	require.NoError(t, err)
+
+	assert.Equal(t, "resolved code", resp.Content)
+	assert.Equal(t, 23, resp.totalTokens())
+	require.Len(t, server.requests, 1)
+	assert.Equal(t, "qwen2.5-coder:14b", server.requests[0].Model)
+	assert.Equal(t, 32768, p.contextWindow)
+}
+
+func TestLocalProvider_ConfiguredModel(t *testing.T) {
+	server := newFakeLocalServer(t, `{"data": [{"id": "qwen2.5-coder:14b"}, {"id": "llama3:latest", "meta": {"n_ctx_train": 8192}}]}`)
+
+	p := newLocalProvider(server.URL+"/v1", "llama3", 0, 0)
+	_, err := p.complete(context.Background(), completionRequest{Prompt: "resolve", MaxTokens: 100})
+	require.NoError(t, err)
+
+	require.Len(t, server.requests, 1)
+	assert.Equal(t, "llama3", server.requests[0].Model)
+	assert.Equal(t, 8192, p.contextWindow)
+}
+
+func TestLocalProvider_ModelNotServed(t *testing.T) {
+	server := newFakeLocalServer(t, `{"data": [{"id": "qwen2.5-coder:14b"}]}`)
+
+	p := newLocalProvider(server.URL+"/v1", "llama3", 0, 0)
+	_, err := p.complete(context.Background(), completionRequest{Prompt: "resolve", MaxTokens: 100})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `model "llama3" is not served`)
+	assert.Contains(t, err.Error(), "available: qwen2.5-coder:14b")
+	assert.Empty(t, server.requests)
+}
+
+func TestLocalProvider_ContextWindow(t *testing.T) {
+	server := newFakeLocalServer(t, `{"data": [{"id": "llama3", "max_model_len": 4096}]}`)
+
+	// The configured context window takes precedence over the reported one
+	p := newLocalProvider(server.URL+"/v1", "llama3", 1000, 0)
+
+	_, err := p.complete(context.Background(), completionRequest{Prompt: strings.Repeat("x", 3000), MaxTokens: 500})
+	require.NoError(t, err)
+	require.Len(t, server.requests, 1)
+	assert.Equal(t, 250, server.requests[0].MaxTokens)
+
+	_, err = p.complete(context.Background(), completionRequest{Context: strings.Repeat("x", 4000), Prompt: "resolve", MaxTokens: 500})
+	assert.ErrorIs(t, err, ErrPromptTooLarge)
+	assert.Len(t, server.requests, 1)
+}
+
+func TestNew_LocalProvider(t *testing.T) {
+	server := newFakeLocalServer(t, `{"data": [{"id": "llama3"}]}`)
+
+	service := New(Options{Provider: config.ProviderLocal, BaseURL: server.URL + "/v1", MaxTokens: 100})
+	message, err := service.GenerateCommitMessage(context.Background(), []string{"src/main.c"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "resolved code", message)
+	require.Len(t, server.requests, 1)
+	assert.Equal(t, "llama3", server.requests[0].Model)
+}
@@ -0,0 +1,130 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// openAIProvider talks to OpenAI and OpenAI compatible APIs such as OpenRouter
+type openAIProvider struct {
+	client *openai.Client
+	model  string
+}
+
+func newOpenAIProvider(apiKey, baseURL, model string, timeout time.Duration) *openAIProvider {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	config.HTTPClient = &http.Client{Timeout: timeout}
+
+	return &openAIProvider{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+	}
+}
+
+func (p *openAIProvider) complete(ctx context.Context, request completionRequest) (*completionResponse, error) {
+	// Models without structured outputs are told the schema instead, the
+	// response is validated when it is parsed
+	format := openAIResponseFormat(p.model, request.Schema)
+	system := request.System
+	if request.Schema != nil && (format == nil || format.Type != openai.ChatCompletionResponseFormatTypeJSONSchema) {
+		system += fmt.Sprintf("\n\nAnswer with only a JSON object matching this JSON schema:\n%s", request.Schema.Schema)
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     p.model,
+		MaxTokens: request.MaxTokens,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: system,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: request.Context + request.Prompt,
+			},
+		},
+		Temperature:    request.Temperature,
+		ResponseFormat: format,
+	})
+	if err != nil {
+		var apiErr *openai.APIError
+		if errors.As(err, &apiErr) && apiErr.Code == "context_length_exceeded" {
+			return nil, fmt.Errorf("%w: %v", ErrPromptTooLarge, err)
+		}
+		return nil, err
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("response has no choices")
+	}
+
+	return &completionResponse{
+		Content:      resp.Choices[0].Message.Content,
+		Truncated:    resp.Choices[0].FinishReason == openai.FinishReasonLength,
+		InputTokens:  resp.Usage.PromptTokens,
+		OutputTokens: resp.Usage.CompletionTokens,
+	}, nil
+}
+
+// structuredOutputModels are the model name prefixes of the OpenAI models that
+// accept json_schema response formats
+var structuredOutputModels = []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4"}
+
+// plainTextModels are the model name prefixes of the OpenAI models that accept
+// no response format at all. gpt-4 is only matched by its exact names.
+var plainTextModels = []string{"gpt-4-32k", "gpt-3.5-turbo-0613", "gpt-3.5-turbo-16k", "o1-mini", "o1-preview"}
+
+// openAIResponseFormat asks for a strict JSON schema response from models that
+// support it and for a JSON object from all others. Models that do not support
+// either, and requests without a schema, get nil for plain text.
+func openAIResponseFormat(model string, schema *responseSchema) *openai.ChatCompletionResponseFormat {
+	if schema == nil {
+		return nil
+	}
+
+	// Routed model names like "openai/gpt-4o" start with the provider
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	switch model {
+	case "gpt-4", "gpt-4-0314", "gpt-4-0613":
+		return nil
+	case "gpt-4o-2024-05-13":
+		return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+	if hasAnyPrefix(model, plainTextModels) {
+		return nil
+	}
+	if !hasAnyPrefix(model, structuredOutputModels) {
+		return &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:        schema.Name,
+			Description: schema.Description,
+			Schema:      schema.Schema,
+			Strict:      true,
+		},
+	}
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
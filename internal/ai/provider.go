@@ -0,0 +1,47 @@
+package ai
+
+import "context"
+
+// provider sends a single completion request to an AI backend
+type provider interface {
+	complete(ctx context.Context, request completionRequest) (*completionResponse, error)
+}
+
+// completionRequest is a provider independent completion request. Context is
+// the large part of the prompt that stays the same across retries and hunks of
+// a conflict. It is sent before Prompt, and providers that support prompt
+// caching cache it.
+type completionRequest struct {
+	// File is the file the request is about, for usage accounting
+	File        string
+	System      string
+	Context     string
+	Prompt      string
+	MaxTokens   int
+	Temperature float32
+	// Schema asks for a JSON response matching the schema in Content
+	Schema *responseSchema
+}
+
+// completionResponse is a provider independent completion response
+type completionResponse struct {
+	Content string
+	// Truncated is set if the response stopped at the token limit
+	Truncated bool
+
+	InputTokens  int
+	OutputTokens int
+	// Cache tokens are part of InputTokens for providers with prompt caching
+	CacheReadTokens  int
+	CacheWriteTokens int
+}
+
+func (r *completionResponse) totalTokens() int {
+	return r.InputTokens + r.OutputTokens
+}
+
+// estimateTokens roughly estimates the number of tokens of a text. Source code
+// averages about four characters per token.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -0,0 +1,140 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// responseSchema asks a provider for a JSON response that matches a schema.
+// OpenAI compatible providers use a json_schema response format, Anthropic a
+// forced tool call.
+type responseSchema struct {
+	Name        string
+	Description string
+	Schema      json.RawMessage
+}
+
+// resolutionSchema describes a structured conflict resolution
+var resolutionSchema = &responseSchema{
+	Name:        "conflict_resolution",
+	Description: "Submit the resolution of the merge conflict",
+	Schema: json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"resolution": {
+				"type": "string",
+				"description": "The resolved code without conflict markers or markdown formatting"
+			},
+			"confidence": {
+				"type": "number",
+				"description": "How sure you are that the resolution is correct, from 0 to 1"
+			},
+			"strategy": {
+				"type": "string",
+				"enum": ["ours", "theirs", "combined", "rewritten"],
+				"description": "ours keeps HEAD, theirs keeps the incoming changes, combined merges both, rewritten replaces both with new code"
+			},
+			"rationale": {
+				"type": "string",
+				"description": "Why this resolution was chosen, in one or two sentences"
+			},
+			"risks": {
+				"type": "array",
+				"items": {"type": "string"},
+				"description": "What a reviewer should double check, empty if nothing"
+			}
+		},
+		"required": ["resolution", "confidence", "strategy", "rationale", "risks"],
+		"additionalProperties": false
+	}`),
+}
+
+type resolutionResponse struct {
+	Resolution *string  `json:"resolution"`
+	Confidence *float64 `json:"confidence"`
+	Strategy   string   `json:"strategy"`
+	Rationale  string   `json:"rationale"`
+	Risks      []string `json:"risks"`
+}
+
+// parseResolution parses a structured conflict resolution. Models without
+// schema support sometimes wrap the JSON in a code fence, which is ignored.
+func parseResolution(content string) (*interfaces.ConflictResolution, error) {
+	var response resolutionResponse
+	if err := json.Unmarshal([]byte(stripCodeFence(content)), &response); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedResponse, err)
+	}
+
+	if response.Resolution == nil {
+		return nil, fmt.Errorf("%w: resolution is missing", ErrMalformedResponse)
+	}
+	if response.Confidence == nil || *response.Confidence < 0 || *response.Confidence > 1 {
+		return nil, fmt.Errorf("%w: confidence must be between 0 and 1", ErrMalformedResponse)
+	}
+
+	strategy := interfaces.ResolutionStrategy(response.Strategy)
+	switch strategy {
+	case interfaces.StrategyOurs, interfaces.StrategyTheirs, interfaces.StrategyCombined, interfaces.StrategyRewritten:
+	default:
+		return nil, fmt.Errorf("%w: unknown strategy %q", ErrMalformedResponse, response.Strategy)
+	}
+
+	return &interfaces.ConflictResolution{
+		Resolution: *response.Resolution,
+		Confidence: *response.Confidence,
+		Strategy:   strategy,
+		Rationale:  response.Rationale,
+		Risks:      response.Risks,
+	}, nil
+}
+
+// stripCodeFence removes a code fence around a JSON response
+func stripCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(strings.TrimSpace(content), "```")
+	}
+	return content
+}
+
+// resolve asks for the resolution of a conflict, or draws several to vote on
+// for conflicts that are configured for voting. label names the resolution in
+// errors. It returns the resolution and the tokens used for it.
+func (s *Service) resolve(ctx context.Context, conflict interfaces.GitConflict, label string, requests []completionRequest) (*interfaces.ConflictResolution, int, error) {
+	if s.voting.appliesTo(conflict) {
+		return s.vote(ctx, conflict, label, requests)
+	}
+
+	chain := s.chain(config.OperationResolveConflict)
+	start := min(len(conflict.Feedback), len(chain)-1)
+	resolution, resp, err := s.sample(ctx, config.OperationResolveConflict, chain[start:], label, requests)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resolution, resp.totalTokens(), nil
+}
+
+// sample asks a chain of models for a single resolution
+func (s *Service) sample(ctx context.Context, operation string, chain []backend, label string, requests []completionRequest) (*interfaces.ConflictResolution, *completionResponse, error) {
+	resp, err := s.completeChain(ctx, operation, chain, requests)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.Truncated {
+		return nil, nil, fmt.Errorf("%s: %w", label, ErrTruncated)
+	}
+
+	resolution, err := parseResolution(resp.Content)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", label, err)
+	}
+	return resolution, resp, nil
+}
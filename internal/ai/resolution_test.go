@@ -0,0 +1,105 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+func TestResolutionSchema_IsValidJSON(t *testing.T) {
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(resolutionSchema.Schema, &schema))
+	assert.ElementsMatch(t, []any{"resolution", "confidence", "strategy", "rationale", "risks"}, schema["required"])
+}
+
+func TestParseResolution(t *testing.T) {
+	resolution, err := parseResolution("```json\n" + resolutionJSON("a\nb") + "\n```")
+	require.NoError(t, err)
+	assert.Equal(t, &interfaces.ConflictResolution{
+		Resolution: "a\nb",
+		Confidence: 0.9,
+		Strategy:   interfaces.StrategyCombined,
+		Rationale:  "Kept both",
+		Risks:      []string{},
+	}, resolution)
+}
+
+func TestParseResolution_Malformed(t *testing.T) {
+	tests := map[string]string{
+		"not json":           "a\nb",
+		"missing resolution": `{"confidence": 0.5, "strategy": "ours"}`,
+		"missing confidence": `{"resolution": "a", "strategy": "ours"}`,
+		"confidence range":   `{"resolution": "a", "confidence": 80, "strategy": "ours"}`,
+		"unknown strategy":   `{"resolution": "a", "confidence": 0.5, "strategy": "both"}`,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseResolution(content)
+			assert.ErrorIs(t, err, ErrMalformedResponse)
+		})
+	}
+}
+
+func TestResolveConflict_RequestsSchema(t *testing.T) {
+	recorder := &recordingProvider{}
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationResolveConflict: {{client: recorder, provider: config.ProviderOpenAI, model: "gpt-4o"}},
+	})
+
+	_, err := service.ResolveConflict(context.Background(), interfaces.GitConflict{File: "main.c"})
+	require.NoError(t, err)
+	require.Len(t, recorder.requests, 1)
+	assert.Equal(t, resolutionSchema, recorder.requests[0].Schema)
+
+	format := openAIResponseFormat("gpt-4o", resolutionSchema)
+	require.NotNil(t, format)
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONSchema, format.Type)
+	assert.True(t, format.JSONSchema.Strict)
+	assert.Nil(t, openAIResponseFormat("gpt-4o", nil))
+}
+
+func TestOpenAIResponseFormat_Fallback(t *testing.T) {
+	for model, want := range map[string]openai.ChatCompletionResponseFormatType{
+		"gpt-4o-mini":       openai.ChatCompletionResponseFormatTypeJSONSchema,
+		"gpt-4.1":           openai.ChatCompletionResponseFormatTypeJSONSchema,
+		"openai/gpt-4o":     openai.ChatCompletionResponseFormatTypeJSONSchema,
+		"gpt-4-turbo":       openai.ChatCompletionResponseFormatTypeJSONObject,
+		"gpt-3.5-turbo":     openai.ChatCompletionResponseFormatTypeJSONObject,
+		"gpt-4o-2024-05-13": openai.ChatCompletionResponseFormatTypeJSONObject,
+		"llama3":            openai.ChatCompletionResponseFormatTypeJSONObject,
+	} {
+		format := openAIResponseFormat(model, resolutionSchema)
+		require.NotNil(t, format, model)
+		assert.Equal(t, want, format.Type, model)
+	}
+
+	assert.Nil(t, openAIResponseFormat("gpt-4", resolutionSchema))
+	assert.Nil(t, openAIResponseFormat("gpt-4-32k", resolutionSchema))
+}
+
+func TestOpenAIProvider_SchemaInPromptWithoutStructuredOutputs(t *testing.T) {
+	server := newFakeLocalServer(t, `{"data": []}`)
+	request := completionRequest{System: "Resolve conflicts.", Prompt: "resolve", MaxTokens: 100, Schema: resolutionSchema}
+
+	for _, model := range []string{"gpt-4", "gpt-4-turbo", "gpt-4o"} {
+		p := newOpenAIProvider("test-key", server.URL+"/v1", model, 0)
+		_, err := p.complete(context.Background(), request)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, server.requests, 3)
+	assert.Nil(t, server.requests[0].ResponseFormat)
+	assert.Contains(t, server.requests[0].Messages[0].Content, "Answer with only a JSON object matching this JSON schema:\n{")
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONObject, server.requests[1].ResponseFormat.Type)
+	assert.Contains(t, server.requests[1].Messages[0].Content, "JSON schema")
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONSchema, server.requests[2].ResponseFormat.Type)
+	assert.Equal(t, "Resolve conflicts.", server.requests[2].Messages[0].Content)
+}
@@ -0,0 +1,163 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// reviewSchema describes the findings of a review
+var reviewSchema = &responseSchema{
+	Name:        "rebase_review",
+	Description: "Submit the problems found in the rebased changes",
+	Schema: json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"findings": {
+				"type": "array",
+				"description": "The problems found, empty if there are none",
+				"items": {
+					"type": "object",
+					"properties": {
+						"file": {
+							"type": "string",
+							"description": "The path of the file from the diff"
+						},
+						"line": {
+							"type": "integer",
+							"description": "The line in the rebased file, 0 if the problem is not about a single line"
+						},
+						"severity": {
+							"type": "string",
+							"enum": ["info", "warning", "error"],
+							"description": "error breaks the build or loses an internal change, warning may change behavior, info is most likely harmless"
+						},
+						"category": {
+							"type": "string",
+							"enum": ["duplicate_definition", "lost_change", "syntax", "semantic_drift", "other"]
+						},
+						"message": {
+							"type": "string",
+							"description": "What is wrong and how to fix it, in one or two sentences"
+						}
+					},
+					"required": ["file", "line", "severity", "category", "message"],
+					"additionalProperties": false
+				}
+			}
+		},
+		"required": ["findings"],
+		"additionalProperties": false
+	}`),
+}
+
+type reviewResponse struct {
+	Findings *[]reviewFinding `json:"findings"`
+}
+
+type reviewFinding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// ReviewRebase asks for a review of the rebased changes as a whole. Problems
+// that only show once all conflicts are resolved, such as definitions added
+// by both sides, are returned as findings.
+func (s *Service) ReviewRebase(ctx context.Context, request interfaces.ReviewRequest) ([]interfaces.ReviewFinding, error) {
+	s.log.WithField("conflicts", len(request.Conflicts)).Info("Requesting review of the rebase from AI")
+
+	resp, err := s.complete(ctx, config.OperationReview, 0, completionRequest{
+		System:      "You are an expert software engineer reviewing the result of a Git rebase whose merge conflicts were resolved automatically. Look for problems that are easy to miss when resolving conflicts one at a time. Only report real problems and never invent findings.",
+		Context:     s.buildReviewContext(request),
+		Prompt:      "Review the diff for duplicated definitions, internal changes that were lost, mismatched braces or other broken syntax, and code whose meaning drifted from what either side intended. Report every problem as a finding.",
+		MaxTokens:   s.maxTokens,
+		Temperature: 0.1,
+		Schema:      reviewSchema,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Truncated {
+		return nil, fmt.Errorf("review: %w", ErrTruncated)
+	}
+
+	findings, err := parseReview(resp.Content)
+	if err != nil {
+		return nil, fmt.Errorf("review: %w", err)
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"findings":    len(findings),
+		"tokens_used": resp.totalTokens(),
+	}).Info("AI review completed")
+
+	return findings, nil
+}
+
+// buildReviewContext describes the rebased changes and how their conflicts
+// were resolved
+func (s *Service) buildReviewContext(request interfaces.ReviewRequest) string {
+	var prompt strings.Builder
+
+	prompt.WriteString("Internal patches were rebased onto a new upstream version. These conflicts were resolved along the way:\n")
+	for _, conflict := range request.Conflicts {
+		prompt.WriteString(fmt.Sprintf("- %s: %s\n", conflict.File, conflict.Action))
+		if conflict.Resolution != nil && conflict.Resolution.Rationale != "" {
+			prompt.WriteString(fmt.Sprintf("  Rationale: %s\n", conflict.Resolution.Rationale))
+		}
+	}
+
+	prompt.WriteString("\nThis is the diff from upstream to the rebased branch for these files. It shows what the internal patches change on top of upstream after the rebase:\n\n")
+	prompt.WriteString(request.Diff)
+
+	return prompt.String()
+}
+
+// parseReview parses the findings of a review. Models without schema support
+// sometimes wrap the JSON in a code fence, which is ignored.
+func parseReview(content string) ([]interfaces.ReviewFinding, error) {
+	var response reviewResponse
+	if err := json.Unmarshal([]byte(stripCodeFence(content)), &response); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedResponse, err)
+	}
+	if response.Findings == nil {
+		return nil, fmt.Errorf("%w: findings are missing", ErrMalformedResponse)
+	}
+
+	findings := make([]interfaces.ReviewFinding, 0, len(*response.Findings))
+	for _, finding := range *response.Findings {
+		severity := interfaces.ReviewSeverity(finding.Severity)
+		switch severity {
+		case interfaces.SeverityInfo, interfaces.SeverityWarning, interfaces.SeverityError:
+		default:
+			return nil, fmt.Errorf("%w: unknown severity %q", ErrMalformedResponse, finding.Severity)
+		}
+
+		// An unexpected category is still a finding worth reporting
+		category := interfaces.ReviewCategory(finding.Category)
+		switch category {
+		case interfaces.CategoryDuplicateDefinition, interfaces.CategoryLostChange, interfaces.CategorySyntax, interfaces.CategorySemanticDrift:
+		default:
+			category = interfaces.CategoryOther
+		}
+
+		findings = append(findings, interfaces.ReviewFinding{
+			File:     finding.File,
+			Line:     max(finding.Line, 0),
+			Severity: severity,
+			Category: category,
+			Message:  finding.Message,
+		})
+	}
+	return findings, nil
+}
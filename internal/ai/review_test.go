@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+func TestParseReview(t *testing.T) {
+	findings, err := parseReview("```json\n" + `{"findings": [
+		{"file": "gpio.c", "line": 12, "severity": "error", "category": "duplicate_definition", "message": "gpio_init is defined twice"},
+		{"file": "Kconfig", "line": 0, "severity": "info", "category": "style", "message": "Help text was reworded"}
+	]}` + "\n```")
+	require.NoError(t, err)
+	assert.Equal(t, []interfaces.ReviewFinding{
+		{File: "gpio.c", Line: 12, Severity: interfaces.SeverityError, Category: interfaces.CategoryDuplicateDefinition, Message: "gpio_init is defined twice"},
+		{File: "Kconfig", Severity: interfaces.SeverityInfo, Category: interfaces.CategoryOther, Message: "Help text was reworded"},
+	}, findings)
+}
+
+func TestParseReview_Malformed(t *testing.T) {
+	tests := map[string]string{
+		"not json":         "looks good",
+		"missing findings": `{}`,
+		"unknown severity": `{"findings": [{"file": "a.c", "line": 1, "severity": "fatal", "category": "syntax", "message": "x"}]}`,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseReview(content)
+			assert.ErrorIs(t, err, ErrMalformedResponse)
+		})
+	}
+}
+
+func TestReviewRebase_SendsDiffAndResolutions(t *testing.T) {
+	recorder := &recordingProvider{content: `{"findings": []}`}
+	service := newChainService(&fakeProvider{}, map[string][]backend{
+		config.OperationReview: {{client: recorder, provider: config.ProviderOpenAI, model: "gpt-4o"}},
+	})
+
+	findings, err := service.ReviewRebase(context.Background(), interfaces.ReviewRequest{
+		Diff: "diff --git a/gpio.c b/gpio.c\n+int x;\n",
+		Conflicts: []interfaces.GitConflict{{
+			File:       "gpio.c",
+			Action:     "resolved by AI",
+			Resolution: &interfaces.ConflictResolution{Rationale: "Kept the internal pin mux"},
+		}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+
+	require.Len(t, recorder.requests, 1)
+	request := recorder.requests[0]
+	assert.Equal(t, reviewSchema, request.Schema)
+	assert.Contains(t, request.Context, "- gpio.c: resolved by AI\n  Rationale: Kept the internal pin mux")
+	assert.Contains(t, request.Context, "+int x;")
+}
@@ -2,78 +2,175 @@ package ai
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
-	"github.com/sashabaranov/go-openai"
 	"github.com/sirupsen/logrus"
 
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
 	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/memory"
+	"github.com/BlindspotSoftware/rebAIser/internal/usage"
 )
 
+// ErrTruncated is returned when a resolution was cut off by the token limit
+var ErrTruncated = errors.New("response was truncated by the token limit")
+
+// ErrMalformedResponse is returned when a structured response does not match its schema
+var ErrMalformedResponse = errors.New("response does not match the requested format")
+
+// ErrPromptTooLarge is returned when a prompt does not fit the model's context window
+var ErrPromptTooLarge = errors.New("prompt exceeds the context window")
+
 type Service struct {
-	client    *openai.Client
+	client    provider
 	provider  string
 	model     string
 	maxTokens int
 	log       *logrus.Entry
+
+	// contextWindow is the default model's context window, zero if unknown
+	contextWindow int
+	ledger        *usage.Ledger
+
+	// chains lists the models to try in order for an operation. Operations
+	// without a chain only use the default model.
+	chains map[string][]backend
+	voting Voting
+
+	// memory holds past resolutions, examples is the number of similar ones
+	// shown with a conflict
+	memory   *memory.Store
+	examples int
 }
 
-func NewService(provider, apiKey, baseURL, model string, maxTokens int) interfaces.AIService {
-	var client *openai.Client
-	
-	if provider == "openrouter" && baseURL != "" {
-		config := openai.DefaultConfig(apiKey)
-		config.BaseURL = baseURL
-		client = openai.NewClientWithConfig(config)
-	} else {
-		client = openai.NewClient(apiKey)
+// Options configures an AI service
+type Options struct {
+	Provider string
+	APIKey   string
+	// BaseURL overrides the provider's default endpoint
+	BaseURL   string
+	Model     string
+	MaxTokens int
+	// ContextWindow overrides the context window of local models in tokens.
+	// Zero uses the value reported by the server. Other models always use
+	// their known window.
+	ContextWindow int
+	// Timeout limits a single request. Zero uses the provider's default.
+	Timeout time.Duration
+	// Operations maps an operation to the models to try in order
+	Operations map[string][]Model
+	// Ledger records the usage of every call and enforces the run's limits
+	Ledger *usage.Ledger
+	// Voting resolves high-risk conflicts by comparing several samples
+	Voting Voting
+	// Memory holds the resolutions of past rebases. Up to Examples similar
+	// ones are shown with every conflict.
+	Memory   *memory.Store
+	Examples int
+}
+
+// NewService creates an AI service for one of the supported providers. An
+// empty baseURL selects the provider's default endpoint.
+func NewService(providerName, apiKey, baseURL, model string, maxTokens int) interfaces.AIService {
+	return New(Options{
+		Provider:  providerName,
+		APIKey:    apiKey,
+		BaseURL:   baseURL,
+		Model:     model,
+		MaxTokens: maxTokens,
+	})
+}
+
+// New creates an AI service from options
+func New(opts Options) interfaces.AIService {
+	primary := newBackend(Model{
+		Provider: opts.Provider,
+		APIKey:   opts.APIKey,
+		BaseURL:  opts.BaseURL,
+		Model:    opts.Model,
+	}, opts)
+
+	chains := make(map[string][]backend)
+	for operation, models := range opts.Operations {
+		for _, model := range models {
+			chains[operation] = append(chains[operation], newBackend(model, opts))
+		}
 	}
-	
+
 	return &Service{
-		client:    client,
-		provider:  provider,
-		model:     model,
-		maxTokens: maxTokens,
-		log:       logrus.WithField("component", "ai").WithField("provider", provider),
+		client:    primary.client,
+		provider:  primary.provider,
+		model:     primary.model,
+		maxTokens: opts.MaxTokens,
+		log:       logrus.WithField("component", "ai").WithField("provider", opts.Provider),
+
+		contextWindow: primary.contextWindow,
+		ledger:        opts.Ledger,
+		chains:        chains,
+		voting:        opts.Voting,
+		memory:        opts.Memory,
+		examples:      opts.Examples,
 	}
 }
 
-func (s *Service) ResolveConflict(ctx context.Context, conflict interfaces.GitConflict) (string, error) {
+func (s *Service) ResolveConflict(ctx context.Context, conflict interfaces.GitConflict) (*interfaces.ConflictResolution, error) {
 	s.log.WithField("file", conflict.File).Info("Resolving conflict with AI")
 
-	// Create a detailed prompt for conflict resolution
-	prompt := s.buildConflictResolutionPrompt(conflict)
-
-	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:     s.model,
-		MaxTokens: s.maxTokens,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are an expert software engineer helping resolve Git merge conflicts. Your task is to intelligently merge conflicting code changes, preserving the intent of both sides where possible. Always return only the resolved code without any markdown formatting or explanations.",
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
-		Temperature: 0.1, // Low temperature for more deterministic output
-	})
+	// Create a detailed prompt for conflict resolution. The conflict itself
+	// does not change between retries and is sent as cacheable context.
+	// Prompts that are too large for a model are retried with less detail.
+	requests := make([]completionRequest, 0, detailMinimal+1)
+	for detail := detailFull; detail <= detailMinimal; detail++ {
+		requests = append(requests, s.conflictRequest(conflict, detail))
+	}
 
+	resolution, tokens, err := s.resolve(ctx, conflict, fmt.Sprintf("resolution of %s", conflict.File), requests)
 	if err != nil {
-		return "", fmt.Errorf("%s API call failed: %w", s.provider, err)
+		return nil, err
 	}
+	resolution.Resolution = strings.TrimSpace(resolution.Resolution)
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from %s API", s.provider)
+	s.log.WithFields(logrus.Fields{
+		"file":        conflict.File,
+		"confidence":  resolution.Confidence,
+		"strategy":    resolution.Strategy,
+		"tokens_used": tokens,
+	}).Info("AI conflict resolution completed")
+
+	return resolution, nil
+}
+
+// ResolveConflictHunk resolves a single conflict hunk. Only the hunk and its
+// bounded context are sent, and only the replacement for the hunk is returned.
+func (s *Service) ResolveConflictHunk(ctx context.Context, conflict interfaces.GitConflict, hunk interfaces.ConflictHunk) (*interfaces.ConflictResolution, error) {
+	s.log.WithFields(logrus.Fields{
+		"file":  conflict.File,
+		"lines": fmt.Sprintf("%d-%d", hunk.StartLine, hunk.EndLine),
+	}).Info("Resolving conflict hunk with AI")
+
+	// The commit context is the same for every hunk of the file. Prompts that
+	// are too large for a model are retried with less detail.
+	requests := make([]completionRequest, 0, detailMinimal+1)
+	for detail := detailFull; detail <= detailMinimal; detail++ {
+		requests = append(requests, s.hunkRequest(conflict, hunk, detail))
+	}
+
+	label := fmt.Sprintf("resolution of %s lines %d-%d", conflict.File, hunk.StartLine, hunk.EndLine)
+	resolution, tokens, err := s.resolve(ctx, conflict, label, requests)
+	if err != nil {
+		return nil, err
 	}
 
-	resolution := strings.TrimSpace(resp.Choices[0].Message.Content)
+	// Only strip surrounding blank lines, indentation is part of the resolution
+	resolution.Resolution = strings.Trim(resolution.Resolution, "\r\n")
 	s.log.WithFields(logrus.Fields{
-		"file":       conflict.File,
-		"tokens_used": resp.Usage.TotalTokens,
-	}).Info("AI conflict resolution completed")
+		"file":        conflict.File,
+		"lines":       fmt.Sprintf("%d-%d", hunk.StartLine, hunk.EndLine),
+		"tokens_used": tokens,
+	}).Info("AI conflict hunk resolution completed")
 
 	return resolution, nil
 }
@@ -83,34 +180,20 @@ func (s *Service) GenerateCommitMessage(ctx context.Context, changes []string) (
 
 	prompt := s.buildCommitMessagePrompt(changes)
 
-	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:     s.model,
-		MaxTokens: 100, // Commit messages should be short
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are an expert at writing clear, concise Git commit messages following conventional commit format. Generate a single commit message that summarizes the changes. Use format: 'type: description' where type is one of: feat, fix, docs, style, refactor, test, chore. Keep it under 50 characters for the summary.",
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
+	resp, err := s.complete(ctx, config.OperationCommitMessage, 0, completionRequest{
+		System:      "You are an expert at writing clear, concise Git commit messages following conventional commit format. Generate a single commit message that summarizes the changes. Use format: 'type: description' where type is one of: feat, fix, docs, style, refactor, test, chore. Keep it under 50 characters for the summary.",
+		Prompt:      prompt,
+		MaxTokens:   100, // Commit messages should be short
 		Temperature: 0.3,
 	})
-
 	if err != nil {
-		return "", fmt.Errorf("%s API call failed: %w", s.provider, err)
-	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from %s API", s.provider)
+		return "", err
 	}
 
-	commitMessage := strings.TrimSpace(resp.Choices[0].Message.Content)
+	commitMessage := strings.TrimSpace(resp.Content)
 	s.log.WithFields(logrus.Fields{
 		"message":     commitMessage,
-		"tokens_used": resp.Usage.TotalTokens,
+		"tokens_used": resp.totalTokens(),
 	}).Info("AI commit message generated")
 
 	return commitMessage, nil
@@ -122,34 +205,20 @@ func (s *Service) GenerateCommitMessageWithConflicts(ctx context.Context, change
 
 	prompt := s.buildCommitMessageWithConflictsPrompt(changes, conflicts)
 
-	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:     s.model,
-		MaxTokens: 150, // Slightly more tokens for conflict analysis
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are an expert at writing clear, concise Git commit messages following conventional commit format. Analyze the conflicts and generate a commit message that describes the nature of the conflicts resolved (e.g., 'config: reconcile compiler toolchain defaults', 'gpio: align drive strength configurations', 'devicetree: merge panel timing settings'). Use format: 'type: description' where type is one of: feat, fix, docs, style, refactor, test, chore, config. Keep it under 50 characters for the summary.",
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
+	resp, err := s.complete(ctx, config.OperationCommitMessage, 0, completionRequest{
+		System:      "You are an expert at writing clear, concise Git commit messages following conventional commit format. Analyze the conflicts and generate a commit message that describes the nature of the conflicts resolved (e.g., 'config: reconcile compiler toolchain defaults', 'gpio: align drive strength configurations', 'devicetree: merge panel timing settings'). Use format: 'type: description' where type is one of: feat, fix, docs, style, refactor, test, chore, config. Keep it under 50 characters for the summary.",
+		Prompt:      prompt,
+		MaxTokens:   150, // Slightly more tokens for conflict analysis
 		Temperature: 0.3,
 	})
-
 	if err != nil {
-		return "", fmt.Errorf("%s API call failed: %w", s.provider, err)
-	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from %s API", s.provider)
+		return "", err
 	}
 
-	commitMessage := strings.TrimSpace(resp.Choices[0].Message.Content)
+	commitMessage := strings.TrimSpace(resp.Content)
 	s.log.WithFields(logrus.Fields{
 		"message":     commitMessage,
-		"tokens_used": resp.Usage.TotalTokens,
+		"tokens_used": resp.totalTokens(),
 		"conflicts":   len(conflicts),
 	}).Info("AI commit message with conflicts generated")
 
@@ -161,55 +230,155 @@ func (s *Service) GeneratePRDescription(ctx context.Context, commits []string, c
 
 	prompt := s.buildPRDescriptionPrompt(commits, conflicts)
 
-	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:     s.model,
-		MaxTokens: s.maxTokens,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are an expert at writing clear, professional GitHub pull request descriptions. Generate a well-structured PR description in markdown format that summarizes the changes, conflicts resolved, and any important notes for reviewers. Include sections for Summary, Changes, Conflicts Resolved (if any), and Testing.",
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
+	resp, err := s.complete(ctx, config.OperationPRDescription, 0, completionRequest{
+		System:      "You are an expert at writing clear, professional GitHub pull request descriptions. Generate a well-structured PR description in markdown format that summarizes the changes, conflicts resolved, and any important notes for reviewers. Include sections for Summary, Changes, Conflicts Resolved (if any), and Testing.",
+		Prompt:      prompt,
+		MaxTokens:   s.maxTokens,
 		Temperature: 0.4,
 	})
-
 	if err != nil {
-		return "", fmt.Errorf("%s API call failed: %w", s.provider, err)
+		return "", err
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from %s API", s.provider)
-	}
-
-	description := strings.TrimSpace(resp.Choices[0].Message.Content)
+	description := strings.TrimSpace(resp.Content)
 	s.log.WithFields(logrus.Fields{
 		"conflicts":   len(conflicts),
 		"commits":     len(commits),
-		"tokens_used": resp.Usage.TotalTokens,
+		"tokens_used": resp.totalTokens(),
 	}).Info("AI PR description generated")
 
 	return description, nil
 }
 
-// buildConflictResolutionPrompt creates a detailed prompt for AI conflict resolution
-func (s *Service) buildConflictResolutionPrompt(conflict interfaces.GitConflict) string {
-	return fmt.Sprintf(`I have a Git merge conflict in file: %s
+// RepairBuild asks for a patch that fixes build or test failures caused by the
+// AI resolutions of a rebase. The patch is a unified diff against the files
+// of the request.
+func (s *Service) RepairBuild(ctx context.Context, request interfaces.RepairRequest) (string, error) {
+	s.log.WithFields(logrus.Fields{
+		"failures": len(request.Failures),
+		"files":    len(request.Files),
+	}).Info("Requesting build repair from AI")
+
+	prompt := s.buildRepairPrompt(request)
+
+	resp, err := s.complete(ctx, config.OperationRepair, len(request.Feedback), completionRequest{
+		System:      "You are an expert software engineer fixing a build that broke after Git merge conflicts were resolved automatically. Make the smallest change that fixes the reported failures. Always return only a unified diff with a/ and b/ path prefixes that applies with git apply, without markdown formatting or explanations.",
+		Prompt:      prompt,
+		MaxTokens:   s.maxTokens,
+		Temperature: 0.1, // Low temperature for more deterministic output
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Truncated {
+		return "", fmt.Errorf("repair patch: %w", ErrTruncated)
+	}
+
+	// A patch must end with a newline to apply
+	patch := strings.TrimSpace(resp.Content) + "\n"
+	s.log.WithField("tokens_used", resp.totalTokens()).Info("AI build repair completed")
+
+	return patch, nil
+}
+
+// maxFailureOutput limits how much of a failing command's output is sent. The
+// end of the output is kept since that is where compilers and test runners
+// report the failure.
+const maxFailureOutput = 8000
+
+// buildRepairPrompt creates a prompt for repairing build and test failures
+func (s *Service) buildRepairPrompt(request interfaces.RepairRequest) string {
+	var prompt strings.Builder
+
+	prompt.WriteString("A Git rebase was completed by resolving merge conflicts automatically. Afterwards these commands failed:\n")
+	for _, failure := range request.Failures {
+		output := failure.Output
+		if len(output) > maxFailureOutput {
+			output = "[...]\n" + output[len(output)-maxFailureOutput:]
+		}
+		prompt.WriteString(fmt.Sprintf("\nCommand: %s\n", failure.Command))
+		if failure.Error != "" {
+			prompt.WriteString(fmt.Sprintf("Error: %s\n", failure.Error))
+		}
+		prompt.WriteString(fmt.Sprintf("Output:\n%s\n", output))
+	}
+
+	prompt.WriteString("\nThe conflicts were resolved in these files, which most likely cause the failures:\n")
+	for _, file := range request.Files {
+		prompt.WriteString(fmt.Sprintf("\n--- %s ---\n%s\n", file.Path, file.Content))
+	}
+
+	if len(request.Feedback) > 0 {
+		prompt.WriteString("\nPrevious repair patches were rejected:\n")
+		for _, problem := range request.Feedback {
+			prompt.WriteString(fmt.Sprintf("- %s\n", problem))
+		}
+	}
+
+	prompt.WriteString("\nReturn a unified diff that fixes the failures. Only change what is needed to fix them.")
+
+	return prompt.String()
+}
+
+// conflictRequest creates the request resolving a whole conflicted file with
+// the given detail
+func (s *Service) conflictRequest(conflict interfaces.GitConflict, detail int) completionRequest {
+	reduced := reduceConflict(conflict, detail)
+	return completionRequest{
+		File:        conflict.File,
+		System:      "You are an expert software engineer helping resolve Git merge conflicts. Your task is to intelligently merge conflicting code changes, preserving the intent of both sides where possible. Always answer with the resolved code and an honest assessment of how sure you are about it.",
+		Context:     s.buildConflictContext(reduced),
+		Prompt:      s.buildConflictInstructions(reduced),
+		MaxTokens:   s.maxTokens,
+		Temperature: 0.1, // Low temperature for more deterministic output
+		Schema:      resolutionSchema,
+	}
+}
+
+// buildConflictContext creates the part of the conflict resolution prompt that
+// describes the conflict
+func (s *Service) buildConflictContext(conflict interfaces.GitConflict) string {
+	var prompt strings.Builder
+
+	prompt.WriteString(fmt.Sprintf(`I have a Git merge conflict in file: %s
 
 Here's the conflict:
 
 %s
+`,
+		conflict.File,
+		conflict.Content,
+	))
 
+	if conflict.Ours != "" || conflict.Theirs != "" {
+		prompt.WriteString(fmt.Sprintf(`
 The conflict markers show:
 - HEAD (our changes):
 %s
 
 - Incoming changes (theirs):
 %s
+`,
+			conflict.Ours,
+			conflict.Theirs,
+		))
+	}
+
+	prompt.WriteString(s.buildCommitContext(conflict))
+	prompt.WriteString(s.buildExamples(conflict.File, conflict.Content))
+
+	return prompt.String()
+}
+
+// buildConflictInstructions creates the part of the conflict resolution prompt
+// that asks for the resolution
+func (s *Service) buildConflictInstructions(conflict interfaces.GitConflict) string {
+	var prompt strings.Builder
+
+	prompt.WriteString(s.buildFeedback(conflict))
 
+	prompt.WriteString(`
 Please resolve this conflict by:
 1. Analyzing both versions
 2. Merging the changes intelligently
@@ -217,12 +386,155 @@ Please resolve this conflict by:
 4. Ensuring the code remains functional
 5. Following the existing code style and patterns
 
-Return only the resolved code without any markdown formatting, explanations, or conflict markers.`,
-		conflict.File,
-		conflict.Content,
-		conflict.Ours,
-		conflict.Theirs,
-	)
+Return only the resolved code in the resolution field, without any markdown formatting, explanations, or conflict markers.
+Rate your confidence from 0 to 1: use a high value only when the intent of both sides is clear and the resolution keeps it, and a low value when you had to guess.
+Name the strategy you used, explain the resolution in the rationale and list anything a reviewer should double check as risks.`)
+
+	return prompt.String()
+}
+
+// hunkRequest creates the request resolving a single conflict hunk with the
+// given detail
+func (s *Service) hunkRequest(conflict interfaces.GitConflict, hunk interfaces.ConflictHunk, detail int) completionRequest {
+	reduced := reduceConflict(conflict, detail)
+	return completionRequest{
+		File:        conflict.File,
+		System:      "You are an expert software engineer helping resolve Git merge conflicts. You are given one conflicting region of a file together with the code around it. Answer with only the code that replaces the conflicting region, without the surrounding code, and an honest assessment of how sure you are about it.",
+		Context:     s.buildHunkContext(reduced),
+		Prompt:      s.buildHunkInstructions(reduced, reduceHunk(hunk, detail)),
+		MaxTokens:   s.maxTokens,
+		Temperature: 0.1, // Low temperature for more deterministic output
+		Schema:      resolutionSchema,
+	}
+}
+
+// buildHunkContext creates the part of the hunk resolution prompt that is the
+// same for all hunks of a file
+func (s *Service) buildHunkContext(conflict interfaces.GitConflict) string {
+	return fmt.Sprintf("I have a Git merge conflict in file: %s\n", conflict.File) + s.buildCommitContext(conflict)
+}
+
+// buildHunkInstructions creates the part of the hunk resolution prompt that
+// describes a single hunk and asks for its resolution
+func (s *Service) buildHunkInstructions(conflict interfaces.GitConflict, hunk interfaces.ConflictHunk) string {
+	var prompt strings.Builder
+
+	prompt.WriteString(fmt.Sprintf("\nResolve the conflicting region of %s (lines %d-%d).\n", conflict.File, hunk.StartLine, hunk.EndLine))
+
+	if hunk.Before != "" {
+		prompt.WriteString(fmt.Sprintf("\nCode before the conflicting region:\n%s\n", hunk.Before))
+	}
+
+	prompt.WriteString(fmt.Sprintf("\nConflicting region:\n- HEAD (our changes):\n%s\n", hunk.Ours))
+	if hunk.Base != "" {
+		prompt.WriteString(fmt.Sprintf("\n- Common ancestor (base):\n%s\n", hunk.Base))
+	}
+	prompt.WriteString(fmt.Sprintf("\n- Incoming changes (theirs):\n%s\n", hunk.Theirs))
+
+	if hunk.After != "" {
+		prompt.WriteString(fmt.Sprintf("\nCode after the conflicting region:\n%s\n", hunk.After))
+	}
+
+	prompt.WriteString(s.buildExamples(conflict.File, hunk.Ours+"\n"+hunk.Theirs))
+	prompt.WriteString(s.buildFeedback(conflict))
+
+	prompt.WriteString(`
+Please resolve this conflicting region by:
+1. Analyzing both versions against the common ancestor
+2. Merging the changes intelligently
+3. Preserving the intent of both sides where possible
+4. Keeping the indentation and style of the surrounding code
+
+Return only the code that replaces the conflicting region in the resolution field. Do not repeat the code before or after it, and do not add markdown formatting, explanations, or conflict markers.
+Rate your confidence from 0 to 1: use a high value only when the intent of both sides is clear and the resolution keeps it, and a low value when you had to guess.
+Name the strategy you used, explain the resolution in the rationale and list anything a reviewer should double check as risks.`)
+
+	return prompt.String()
+}
+
+// buildFeedback lists why earlier resolutions of the conflict were rejected
+func (s *Service) buildFeedback(conflict interfaces.GitConflict) string {
+	if len(conflict.Feedback) == 0 {
+		return ""
+	}
+
+	var feedback strings.Builder
+	feedback.WriteString("\nPrevious resolutions of this conflict were rejected:\n")
+	for _, problem := range conflict.Feedback {
+		feedback.WriteString(fmt.Sprintf("- %s\n", problem))
+	}
+	feedback.WriteString("Make sure your answer does not have these problems.\n")
+
+	return feedback.String()
+}
+
+// maxExampleLines skips past resolutions that would bloat the prompt more
+// than they help
+const maxExampleLines = 40
+
+// buildExamples shows how similar conflicts were resolved in past rebases.
+// code is the conflicting code of both sides.
+func (s *Service) buildExamples(file, code string) string {
+	var examples strings.Builder
+	shown := 0
+	for _, c := range s.memory.Similar(file, code, s.examples) {
+		if strings.Count(c.Ours+c.Theirs+c.Resolution, "\n") > maxExampleLines {
+			continue
+		}
+		if shown == 0 {
+			examples.WriteString("\nSimilar conflicts were resolved like this in past rebases, and the resolutions were merged after review. Follow them where they apply:\n")
+		}
+		shown++
+
+		examples.WriteString(fmt.Sprintf("\nExample %d (%s):\n- HEAD (ours):\n%s\n- Incoming changes (theirs):\n%s\n- Merged resolution:\n%s\n",
+			shown, c.File, c.Ours, c.Theirs, c.Resolution))
+	}
+
+	return examples.String()
+}
+
+// buildCommitContext describes the internal patch being replayed and the upstream
+// history of the file, so the intent of both sides does not have to be guessed
+// from the conflict markers alone
+func (s *Service) buildCommitContext(conflict interfaces.GitConflict) string {
+	if conflict.Commit.SHA == "" && len(conflict.UpstreamCommits) == 0 {
+		return ""
+	}
+
+	var details strings.Builder
+
+	details.WriteString("\nThis conflict happened while rebasing internal patches onto upstream. ")
+	details.WriteString("HEAD (ours) is the upstream code, the incoming changes (theirs) come from the internal patch being replayed.\n")
+
+	if conflict.Commit.SHA != "" {
+		details.WriteString("\nInternal patch being replayed:\n")
+		details.WriteString(fmt.Sprintf("Commit: %s\n", conflict.Commit.SHA))
+		details.WriteString(fmt.Sprintf("Author: %s\n", conflict.Commit.Author))
+		details.WriteString(fmt.Sprintf("Subject: %s\n", conflict.Commit.Subject))
+		if conflict.Commit.Body != "" {
+			details.WriteString(fmt.Sprintf("\n%s\n", conflict.Commit.Body))
+		}
+		if conflict.Commit.Diff != "" {
+			details.WriteString(fmt.Sprintf("\nChanges of this patch to %s:\n%s\n", conflict.File, conflict.Commit.Diff))
+		}
+	}
+
+	if len(conflict.UpstreamCommits) > 0 {
+		details.WriteString(fmt.Sprintf("\nUpstream commits that changed %s since the internal patch was written:\n", conflict.File))
+		for _, commit := range conflict.UpstreamCommits {
+			details.WriteString(fmt.Sprintf("- %s %s (%s)\n", shortSHA(commit.SHA), commit.Subject, commit.Author))
+		}
+	}
+
+	return details.String()
+}
+
+// shortSHA abbreviates a commit SHA for display
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
 }
 
 // buildCommitMessagePrompt creates a prompt for generating commit messages
@@ -283,32 +595,47 @@ func (s *Service) buildCommitMessageWithConflictsPrompt(changes []string, confli
 	return prompt.String()
 }
 
+var conflictTypeDescriptions = map[string]string{
+	config.ConflictTypeKconfig:    "Kconfig option definition",
+	config.ConflictTypeDeviceTree: "Device tree configuration",
+	config.ConflictTypeGPIO:       "GPIO pin configuration",
+	config.ConflictTypeRegister:   "Register definition",
+	config.ConflictTypeConfig:     "Configuration setting",
+	config.ConflictTypeTiming:     "Timing parameter",
+	config.ConflictTypeCode:       "Code change",
+}
+
 // analyzeConflictType provides a basic analysis of conflict type based on file path and content
 func (s *Service) analyzeConflictType(conflict interfaces.GitConflict) string {
+	return conflictTypeDescriptions[classifyConflict(conflict)]
+}
+
+// classifyConflict returns the type of a conflict based on file path and content
+func classifyConflict(conflict interfaces.GitConflict) string {
 	file := strings.ToLower(conflict.File)
 	content := strings.ToLower(conflict.Content)
 	
 	// Analyze based on file extension/path
 	if strings.Contains(file, "kconfig") || strings.HasSuffix(file, ".kconfig") {
-		return "Kconfig option definition"
+		return config.ConflictTypeKconfig
 	}
 	if strings.Contains(file, "devicetree") || strings.HasSuffix(file, ".cb") || strings.HasSuffix(file, ".dts") {
-		return "Device tree configuration"
+		return config.ConflictTypeDeviceTree
 	}
 	if strings.Contains(file, "gpio") && strings.Contains(content, "gpio_") {
-		return "GPIO pin configuration"
+		return config.ConflictTypeGPIO
 	}
 	if strings.Contains(content, "register") || strings.Contains(content, "#define") {
-		return "Register definition"
+		return config.ConflictTypeRegister
 	}
 	if strings.Contains(content, "config") || strings.Contains(content, "cfg") {
-		return "Configuration setting"
+		return config.ConflictTypeConfig
 	}
 	if strings.Contains(content, "delay") || strings.Contains(content, "timing") {
-		return "Timing parameter"
+		return config.ConflictTypeTiming
 	}
 	
-	return "Code change"
+	return config.ConflictTypeCode
 }
 
 // buildPRDescriptionPrompt creates a prompt for generating PR descriptions
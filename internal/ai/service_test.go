@@ -3,6 +3,7 @@ package ai
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/memory"
 )
 
 func TestNewService(t *testing.T) {
@@ -27,7 +29,20 @@ func TestNewService(t *testing.T) {
 	assert.NotNil(t, aiService.log)
 }
 
-func TestBuildConflictResolutionPrompt(t *testing.T) {
+// conflictPrompt returns the prompt of the full detail request resolving a
+// conflicted file
+func conflictPrompt(service *Service, conflict interfaces.GitConflict) string {
+	request := service.conflictRequest(conflict, detailFull)
+	return request.Context + request.Prompt
+}
+
+// hunkPrompt returns the prompt of the full detail request resolving a hunk
+func hunkPrompt(service *Service, conflict interfaces.GitConflict, hunk interfaces.ConflictHunk) string {
+	request := service.hunkRequest(conflict, hunk, detailFull)
+	return request.Context + request.Prompt
+}
+
+func TestConflictRequest(t *testing.T) {
 	service := &Service{}
 	
 	conflict := interfaces.GitConflict{
@@ -37,7 +52,7 @@ func TestBuildConflictResolutionPrompt(t *testing.T) {
 		Theirs:  "their code",
 	}
 	
-	prompt := service.buildConflictResolutionPrompt(conflict)
+	prompt := conflictPrompt(service, conflict)
 	
 	assert.Contains(t, prompt, "test.go")
 	assert.Contains(t, prompt, "our code")
@@ -46,6 +61,131 @@ func TestBuildConflictResolutionPrompt(t *testing.T) {
 	assert.Contains(t, prompt, "Return only the resolved code")
 }
 
+func TestConflictRequest_WithCommitContext(t *testing.T) {
+	service := &Service{}
+
+	conflict := interfaces.GitConflict{
+		File:    "src/mainboard/acme/board/gpio.c",
+		Content: "<<<<<<< HEAD\nupstream pad\n=======\ninternal pad\n>>>>>>> 1a2b3c4 (board: keep GPIO override)",
+		Ours:    "upstream pad",
+		Theirs:  "internal pad",
+		Commit: interfaces.CommitInfo{
+			SHA:     "1a2b3c4d5e6f7a8b9c0d",
+			Author:  "Jane Doe <jane@example.com>",
+			Subject: "board: keep GPIO override",
+			Body:    "The EC needs GPP_B3 as output during early boot.",
+			Diff:    "-upstream pad\n+internal pad",
+		},
+		UpstreamCommits: []interfaces.CommitInfo{
+			{SHA: "9f8e7d6c5b4a39281706", Author: "Upstream Dev <dev@example.org>", Subject: "mb/acme: update pad configuration"},
+		},
+	}
+
+	prompt := conflictPrompt(service, conflict)
+
+	assert.Contains(t, prompt, "HEAD (ours) is the upstream code")
+	assert.Contains(t, prompt, "Commit: 1a2b3c4d5e6f7a8b9c0d")
+	assert.Contains(t, prompt, "Author: Jane Doe <jane@example.com>")
+	assert.Contains(t, prompt, "Subject: board: keep GPIO override")
+	assert.Contains(t, prompt, "The EC needs GPP_B3 as output during early boot.")
+	assert.Contains(t, prompt, "+internal pad")
+	assert.Contains(t, prompt, "- 9f8e7d6c5b4a mb/acme: update pad configuration (Upstream Dev <dev@example.org>)")
+	assert.Contains(t, prompt, "Return only the resolved code")
+}
+
+func TestConflictRequest_WithoutCommitContext(t *testing.T) {
+	service := &Service{}
+
+	conflict := interfaces.GitConflict{File: "test.go", Ours: "a", Theirs: "b"}
+
+	prompt := conflictPrompt(service, conflict)
+
+	assert.NotContains(t, prompt, "Internal patch being replayed")
+	assert.NotContains(t, prompt, "Upstream commits")
+}
+
+func TestHunkRequest(t *testing.T) {
+	service := &Service{}
+
+	conflict := interfaces.GitConflict{File: "src/soc/gpio.c"}
+	hunk := interfaces.ConflictHunk{
+		StartLine: 10,
+		EndLine:   16,
+		Before:    "static const struct pad_config gpio_table[] = {",
+		Ours:      "\tPAD_CFG_GPO(GPP_B3, 1, DEEP),",
+		Base:      "\tPAD_CFG_GPO(GPP_B3, 0, DEEP),",
+		Theirs:    "\tPAD_CFG_GPO(GPP_B3, 0, PLTRST),",
+		After:     "};",
+	}
+
+	prompt := hunkPrompt(service, conflict, hunk)
+
+	assert.Contains(t, prompt, "src/soc/gpio.c (lines 10-16)")
+	assert.Contains(t, prompt, "Code before the conflicting region:\nstatic const struct pad_config gpio_table[] = {")
+	assert.Contains(t, prompt, "HEAD (our changes):\n\tPAD_CFG_GPO(GPP_B3, 1, DEEP),")
+	assert.Contains(t, prompt, "Common ancestor (base):\n\tPAD_CFG_GPO(GPP_B3, 0, DEEP),")
+	assert.Contains(t, prompt, "Incoming changes (theirs):\n\tPAD_CFG_GPO(GPP_B3, 0, PLTRST),")
+	assert.Contains(t, prompt, "Code after the conflicting region:\n};")
+	assert.Contains(t, prompt, "Return only the code that replaces the conflicting region")
+}
+
+func TestHunkRequest_WithoutBase(t *testing.T) {
+	service := &Service{}
+
+	prompt := hunkPrompt(service, interfaces.GitConflict{File: "a.c"}, interfaces.ConflictHunk{Ours: "a", Theirs: "b"})
+
+	assert.NotContains(t, prompt, "Common ancestor")
+	assert.NotContains(t, prompt, "Code before")
+	assert.NotContains(t, prompt, "Code after")
+}
+
+func TestResolutionRequests_WithFeedback(t *testing.T) {
+	service := &Service{}
+
+	conflict := interfaces.GitConflict{
+		File:     "src/gpio.c",
+		Feedback: []string{"line 3 still contains the conflict marker \"<<<<<<<\""},
+	}
+
+	for _, prompt := range []string{
+		conflictPrompt(service, conflict),
+		hunkPrompt(service, conflict, interfaces.ConflictHunk{Ours: "a", Theirs: "b"}),
+	} {
+		assert.Contains(t, prompt, "Previous resolutions of this conflict were rejected:\n- line 3 still contains the conflict marker")
+	}
+
+	assert.NotContains(t, conflictPrompt(service, interfaces.GitConflict{File: "a.c"}), "rejected")
+}
+
+func TestResolutionRequests_WithExamples(t *testing.T) {
+	store, err := memory.Open(filepath.Join(t.TempDir(), "resolutions.json"))
+	require.NoError(t, err)
+	store.Learn(12, []memory.Case{{
+		File:       "src/soc/gpio.c",
+		Ours:       "\tPAD_CFG_GPO(GPP_B3, 1, DEEP),",
+		Theirs:     "\tPAD_CFG_GPO(GPP_B3, 0, PLTRST),",
+		Resolution: "\tPAD_CFG_GPO(GPP_B3, 1, PLTRST),",
+	}})
+	service := &Service{memory: store, examples: 3}
+
+	conflict := interfaces.GitConflict{
+		File:    "src/soc/gpio.c",
+		Content: "<<<<<<< HEAD\n\tPAD_CFG_GPO(GPP_B4, 1, DEEP),\n=======\n\tPAD_CFG_GPO(GPP_B4, 0, PLTRST),\n>>>>>>> x\n",
+	}
+	hunk := interfaces.ConflictHunk{Ours: "\tPAD_CFG_GPO(GPP_B4, 1, DEEP),", Theirs: "\tPAD_CFG_GPO(GPP_B4, 0, PLTRST),"}
+
+	for _, prompt := range []string{
+		conflictPrompt(service, conflict),
+		hunkPrompt(service, conflict, hunk),
+	} {
+		assert.Contains(t, prompt, "Similar conflicts were resolved like this in past rebases")
+		assert.Contains(t, prompt, "Example 1 (src/soc/gpio.c):\n- HEAD (ours):\n\tPAD_CFG_GPO(GPP_B3, 1, DEEP),\n- Incoming changes (theirs):\n\tPAD_CFG_GPO(GPP_B3, 0, PLTRST),\n- Merged resolution:\n\tPAD_CFG_GPO(GPP_B3, 1, PLTRST),\n")
+	}
+
+	// Unrelated conflicts get no examples
+	assert.NotContains(t, conflictPrompt(service, interfaces.GitConflict{File: "Makefile", Content: "all: build"}), "Similar conflicts")
+}
+
 func TestBuildCommitMessagePrompt(t *testing.T) {
 	service := &Service{}
 	
@@ -68,6 +208,28 @@ func TestBuildCommitMessagePrompt(t *testing.T) {
 	})
 }
 
+func TestBuildRepairPrompt(t *testing.T) {
+	service := &Service{}
+
+	request := interfaces.RepairRequest{
+		Failures: []interfaces.CommandResult{
+			{Command: "make [all]", Error: "exit status 2", Output: strings.Repeat("x", maxFailureOutput) + "gpio.c:12: error: 'pad' undeclared"},
+		},
+		Files:    []interfaces.FileContent{{Path: "src/gpio.c", Content: "int main(void) {}"}},
+		Feedback: []string{"patch did not apply"},
+	}
+
+	prompt := service.buildRepairPrompt(request)
+
+	assert.Contains(t, prompt, "Command: make [all]")
+	assert.Contains(t, prompt, "Error: exit status 2")
+	// The end of long output is kept
+	assert.Contains(t, prompt, "[...]\n")
+	assert.Contains(t, prompt, "gpio.c:12: error: 'pad' undeclared")
+	assert.Contains(t, prompt, "--- src/gpio.c ---\nint main(void) {}")
+	assert.Contains(t, prompt, "Previous repair patches were rejected:\n- patch did not apply")
+}
+
 func TestBuildPRDescriptionPrompt(t *testing.T) {
 	service := &Service{}
 	
@@ -122,9 +284,10 @@ func TestResolveConflict_Integration(t *testing.T) {
 	}
 	
 	ctx := context.Background()
-	resolution, err := service.ResolveConflict(ctx, conflict)
+	result, err := service.ResolveConflict(ctx, conflict)
 	
-	assert.NoError(t, err)
+	require.NoError(t, err)
+	resolution := result.Resolution
 	assert.NotEmpty(t, resolution)
 	assert.NotContains(t, resolution, "<<<<<<<")
 	assert.NotContains(t, resolution, "=======")
@@ -205,9 +368,10 @@ config COMPILER_GCC
 	}
 	
 	ctx := context.Background()
-	resolution, err := service.ResolveConflict(ctx, conflict)
+	result, err := service.ResolveConflict(ctx, conflict)
 	
-	assert.NoError(t, err)
+	require.NoError(t, err)
+	resolution := result.Resolution
 	assert.NotEmpty(t, resolution)
 	assert.NotContains(t, resolution, "<<<<<<<")
 	assert.NotContains(t, resolution, "=======")
@@ -246,9 +410,10 @@ static const struct gpio_config gpio_table[] = {
 	}
 	
 	ctx := context.Background()
-	resolution, err := service.ResolveConflict(ctx, conflict)
+	result, err := service.ResolveConflict(ctx, conflict)
 	
-	assert.NoError(t, err)
+	require.NoError(t, err)
+	resolution := result.Resolution
 	assert.NotEmpty(t, resolution)
 	assert.NotContains(t, resolution, "<<<<<<<")
 	assert.NotContains(t, resolution, "=======")
@@ -294,9 +459,10 @@ end`,
 	}
 	
 	ctx := context.Background()
-	resolution, err := service.ResolveConflict(ctx, conflict)
+	result, err := service.ResolveConflict(ctx, conflict)
 	
-	assert.NoError(t, err)
+	require.NoError(t, err)
+	resolution := result.Resolution
 	assert.NotEmpty(t, resolution)
 	assert.NotContains(t, resolution, "<<<<<<<")
 	assert.NotContains(t, resolution, "=======")
@@ -0,0 +1,272 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/pathglob"
+)
+
+// ErrNoConsensus is returned when the samples of a conflict disagree and no
+// judge is configured to pick one
+var ErrNoConsensus = errors.New("sampled resolutions disagree")
+
+// Voting resolves high-risk conflicts by drawing several resolutions and
+// comparing them. Samples are drawn at increasing temperatures from the
+// models of the vote operation in turn, or from the models of conflict
+// resolution if it has none.
+type Voting struct {
+	// Samples is the number of resolutions to draw, voting is off below two
+	Samples int
+	// ConflictTypes and Patterns select the conflicts that are voted on
+	ConflictTypes []string
+	Patterns      []string
+	// Judge asks the judge operation to pick one of disagreeing samples.
+	// Without it the conflict is left for a human.
+	Judge bool
+}
+
+// appliesTo reports whether a conflict is resolved by voting
+func (v Voting) appliesTo(conflict interfaces.GitConflict) bool {
+	if v.Samples < 2 {
+		return false
+	}
+	if slices.Contains(v.ConflictTypes, classifyConflict(conflict)) {
+		return true
+	}
+	for _, pattern := range v.Patterns {
+		if pathglob.Match(pattern, conflict.File) {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleTemperature spreads the temperatures of the samples from 0.1 to 0.9
+func sampleTemperature(sample, samples int) float32 {
+	return 0.1 + 0.8*float32(sample)/float32(samples-1)
+}
+
+// voters returns the models samples are drawn from in turn
+func (s *Service) voters() []backend {
+	if chain := s.chains[config.OperationVote]; len(chain) > 0 {
+		return chain
+	}
+	return s.chain(config.OperationResolveConflict)
+}
+
+// vote draws several resolutions of a conflict. A resolution most samples
+// agree on wins with a confidence raised by the agreement. Without a majority
+// a judge picks one, or the conflict is left for a human.
+func (s *Service) vote(ctx context.Context, conflict interfaces.GitConflict, label string, requests []completionRequest) (*interfaces.ConflictResolution, int, error) {
+	voters := s.voters()
+	log := s.log.WithField("file", conflict.File)
+
+	var samples []*interfaces.ConflictResolution
+	var tokens int
+	var err error
+	for i := 0; i < s.voting.Samples; i++ {
+		variants := make([]completionRequest, len(requests))
+		for j, request := range requests {
+			request.Temperature = sampleTemperature(i, s.voting.Samples)
+			variants[j] = request
+		}
+
+		// Every sample starts at another model, the others are its fallbacks.
+		// Retries move on by one model like without voting.
+		start := (i + len(conflict.Feedback)) % len(voters)
+		chain := append(slices.Clone(voters[start:]), voters[:start]...)
+
+		var resolution *interfaces.ConflictResolution
+		var resp *completionResponse
+		resolution, resp, err = s.sample(ctx, config.OperationVote, chain, label, variants)
+		if errors.Is(err, ErrMalformedResponse) || errors.Is(err, ErrTruncated) {
+			log.WithError(err).WithField("sample", i+1).Warn("Dropping unusable sample")
+			continue
+		}
+		if err != nil {
+			return nil, tokens, err
+		}
+
+		tokens += resp.totalTokens()
+		samples = append(samples, resolution)
+	}
+	if len(samples) == 0 {
+		return nil, tokens, err
+	}
+
+	winner, agreeing := majority(samples)
+	if agreeing >= 2 && agreeing*2 > len(samples) {
+		resolution := *winner
+		resolution.Confidence += (1 - resolution.Confidence) * float64(agreeing-1) / float64(s.voting.Samples)
+		resolution.Rationale = fmt.Sprintf("%s (%d of %d samples agree)", resolution.Rationale, agreeing, s.voting.Samples)
+
+		log.WithFields(logrus.Fields{
+			"samples":    len(samples),
+			"agreeing":   agreeing,
+			"confidence": resolution.Confidence,
+		}).Info("Samples agree on a resolution")
+		return &resolution, tokens, nil
+	}
+
+	log.WithField("samples", len(samples)).Warn("Samples disagree on the resolution")
+	if !s.voting.Judge {
+		return nil, tokens, fmt.Errorf("%s: %w, %d samples without a majority", label, ErrNoConsensus, len(samples))
+	}
+
+	resolution, judgeTokens, err := s.judge(ctx, label, requests, samples)
+	return resolution, tokens + judgeTokens, err
+}
+
+// majority returns the most confident resolution of the largest group of
+// samples that agree, and the size of the group
+func majority(samples []*interfaces.ConflictResolution) (*interfaces.ConflictResolution, int) {
+	groups := make(map[string][]*interfaces.ConflictResolution)
+	var order []string
+	for _, sample := range samples {
+		key := normalizeResolution(sample.Resolution)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], sample)
+	}
+
+	var largest []*interfaces.ConflictResolution
+	for _, key := range order {
+		if len(groups[key]) > len(largest) {
+			largest = groups[key]
+		}
+	}
+
+	best := largest[0]
+	for _, sample := range largest[1:] {
+		if sample.Confidence > best.Confidence {
+			best = sample
+		}
+	}
+	return best, len(largest)
+}
+
+// normalizeResolution drops the differences between resolutions that never
+// change their meaning: trailing whitespace and line endings. Indentation is
+// kept, as it is significant in Python, Makefiles and YAML.
+func normalizeResolution(resolution string) string {
+	lines := strings.Split(strings.ReplaceAll(resolution, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// judgeSchema describes the verdict of a judge
+var judgeSchema = &responseSchema{
+	Name:        "judge_resolutions",
+	Description: "Pick the best candidate resolution of the merge conflict",
+	Schema: json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"choice": {
+				"type": "integer",
+				"description": "The number of the best candidate"
+			},
+			"confidence": {
+				"type": "number",
+				"description": "How sure you are that the chosen candidate is correct, from 0 to 1"
+			},
+			"rationale": {
+				"type": "string",
+				"description": "Why this candidate is better than the others, in one or two sentences"
+			}
+		},
+		"required": ["choice", "confidence", "rationale"],
+		"additionalProperties": false
+	}`),
+}
+
+type judgeVerdict struct {
+	Choice     int      `json:"choice"`
+	Confidence *float64 `json:"confidence"`
+	Rationale  string   `json:"rationale"`
+}
+
+// judge asks a model to pick one of disagreeing samples
+func (s *Service) judge(ctx context.Context, label string, requests []completionRequest, samples []*interfaces.ConflictResolution) (*interfaces.ConflictResolution, int, error) {
+	judgeRequests := make([]completionRequest, 0, len(requests))
+	for _, request := range requests {
+		judgeRequests = append(judgeRequests, completionRequest{
+			File:        request.File,
+			System:      "You are an expert software engineer reviewing candidate resolutions of a Git merge conflict. Pick the candidate that best preserves the intent of both sides and is most likely to be correct.",
+			Context:     request.Context,
+			Prompt:      buildJudgePrompt(request.Prompt, samples),
+			MaxTokens:   s.maxTokens,
+			Temperature: 0,
+			Schema:      judgeSchema,
+		})
+	}
+
+	resp, err := s.complete(ctx, config.OperationJudge, 0, judgeRequests...)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.Truncated {
+		return nil, resp.totalTokens(), fmt.Errorf("judging %s: %w", label, ErrTruncated)
+	}
+
+	verdict, err := parseVerdict(resp.Content, len(samples))
+	if err != nil {
+		return nil, resp.totalTokens(), fmt.Errorf("judging %s: %w", label, err)
+	}
+
+	resolution := *samples[verdict.Choice-1]
+	resolution.Confidence = *verdict.Confidence
+	resolution.Rationale = fmt.Sprintf("%s (picked by a judge from %d disagreeing samples: %s)", resolution.Rationale, len(samples), verdict.Rationale)
+
+	s.log.WithFields(logrus.Fields{
+		"file":       requests[0].File,
+		"choice":     verdict.Choice,
+		"confidence": resolution.Confidence,
+	}).Info("Judge picked a resolution")
+	return &resolution, resp.totalTokens(), nil
+}
+
+// buildJudgePrompt lists the candidates after the instructions they were
+// given
+func buildJudgePrompt(instructions string, samples []*interfaces.ConflictResolution) string {
+	var prompt strings.Builder
+
+	prompt.WriteString("Several candidates were asked to resolve the conflict with these instructions:\n")
+	prompt.WriteString(instructions)
+	prompt.WriteString("\n\nThey disagree. Their answers:\n")
+	for i, sample := range samples {
+		prompt.WriteString(fmt.Sprintf("\nCandidate %d (strategy %s, confidence %.2f):\n%s\n", i+1, sample.Strategy, sample.Confidence, sample.Resolution))
+		if sample.Rationale != "" {
+			prompt.WriteString(fmt.Sprintf("Rationale: %s\n", sample.Rationale))
+		}
+	}
+
+	prompt.WriteString("\nPick the candidate that is most likely correct. Rate your confidence from 0 to 1 and use a low value if none of them is convincing.")
+	return prompt.String()
+}
+
+// parseVerdict parses the verdict of a judge over a number of candidates
+func parseVerdict(content string, candidates int) (*judgeVerdict, error) {
+	var verdict judgeVerdict
+	if err := json.Unmarshal([]byte(stripCodeFence(content)), &verdict); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedResponse, err)
+	}
+	if verdict.Choice < 1 || verdict.Choice > candidates {
+		return nil, fmt.Errorf("%w: choice %d is not a candidate", ErrMalformedResponse, verdict.Choice)
+	}
+	if verdict.Confidence == nil || *verdict.Confidence < 0 || *verdict.Confidence > 1 {
+		return nil, fmt.Errorf("%w: confidence must be between 0 and 1", ErrMalformedResponse)
+	}
+	return &verdict, nil
+}
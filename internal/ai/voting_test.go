@@ -0,0 +1,143 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/config"
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// sequenceProvider returns its contents in turn and records the requests
+type sequenceProvider struct {
+	contents []string
+	requests []completionRequest
+}
+
+func (p *sequenceProvider) complete(ctx context.Context, request completionRequest) (*completionResponse, error) {
+	content := p.contents[len(p.requests)%len(p.contents)]
+	p.requests = append(p.requests, request)
+	return &completionResponse{Content: content, InputTokens: 100, OutputTokens: 10}, nil
+}
+
+func newVotingService(voter provider, judge provider, voting Voting) *Service {
+	chains := map[string][]backend{
+		config.OperationResolveConflict: {{client: voter, provider: config.ProviderOpenAI, model: "gpt-4o"}},
+	}
+	if judge != nil {
+		chains[config.OperationJudge] = []backend{{client: judge, provider: config.ProviderAnthropic, model: "claude-sonnet-4-5"}}
+	}
+
+	service := newChainService(&fakeProvider{}, chains)
+	service.voting = voting
+	return service
+}
+
+func kconfigConflict() interfaces.GitConflict {
+	return interfaces.GitConflict{
+		File:    "src/Kconfig",
+		Content: "<<<<<<< HEAD\n\tdefault 2\n=======\n\tdefault 4\n>>>>>>> x\n",
+	}
+}
+
+func TestVoting_AppliesTo(t *testing.T) {
+	voting := Voting{Samples: 3, ConflictTypes: []string{config.ConflictTypeKconfig}, Patterns: []string{"src/soc/**/gpio.c"}}
+
+	assert.True(t, voting.appliesTo(kconfigConflict()))
+	assert.True(t, voting.appliesTo(interfaces.GitConflict{File: "src/soc/intel/gpio.c"}))
+	assert.False(t, voting.appliesTo(interfaces.GitConflict{File: "src/main.c", Content: "int x;"}))
+
+	voting.Samples = 1
+	assert.False(t, voting.appliesTo(kconfigConflict()))
+}
+
+func TestVote_AgreementRaisesConfidence(t *testing.T) {
+	voter := &sequenceProvider{contents: []string{
+		resolutionJSON("\tdefault 4"),
+		resolutionJSON("\tdefault 2"),
+		resolutionJSON("\tdefault 4 \r\n"),
+	}}
+	service := newVotingService(voter, nil, Voting{Samples: 3, ConflictTypes: []string{config.ConflictTypeKconfig}})
+
+	resolution, err := service.ResolveConflict(context.Background(), kconfigConflict())
+	require.NoError(t, err)
+
+	assert.Equal(t, "default 4", resolution.Resolution)
+	assert.InDelta(t, 0.9+0.1/3, resolution.Confidence, 1e-9)
+	assert.Equal(t, "Kept both (2 of 3 samples agree)", resolution.Rationale)
+
+	require.Len(t, voter.requests, 3)
+	for i, temperature := range []float32{0.1, 0.5, 0.9} {
+		assert.InDelta(t, temperature, voter.requests[i].Temperature, 1e-6)
+	}
+}
+
+func TestVote_DisagreementAsksJudge(t *testing.T) {
+	voter := &sequenceProvider{contents: []string{
+		resolutionJSON("\tdefault 2"),
+		resolutionJSON("\tdefault 4"),
+		resolutionJSON("\tdefault 8"),
+	}}
+	judge := &sequenceProvider{contents: []string{`{"choice": 2, "confidence": 0.6, "rationale": "Upstream raised the default"}`}}
+	service := newVotingService(voter, judge, Voting{Samples: 3, Patterns: []string{"**/Kconfig"}, Judge: true})
+
+	resolution, err := service.ResolveConflict(context.Background(), kconfigConflict())
+	require.NoError(t, err)
+
+	assert.Equal(t, "default 4", resolution.Resolution)
+	assert.Equal(t, 0.6, resolution.Confidence)
+	assert.Contains(t, resolution.Rationale, "picked by a judge from 3 disagreeing samples: Upstream raised the default")
+
+	require.Len(t, judge.requests, 1)
+	assert.Equal(t, judgeSchema, judge.requests[0].Schema)
+	for i, candidate := range []string{"default 2", "default 4", "default 8"} {
+		assert.Contains(t, judge.requests[0].Prompt, fmt.Sprintf("Candidate %d (strategy combined, confidence 0.90):\n\t%s\n", i+1, candidate))
+	}
+}
+
+func TestVote_DisagreementWithoutJudge(t *testing.T) {
+	voter := &sequenceProvider{contents: []string{
+		resolutionJSON("\tdefault 2"),
+		resolutionJSON("\tdefault 4"),
+	}}
+	service := newVotingService(voter, nil, Voting{Samples: 2, ConflictTypes: []string{config.ConflictTypeKconfig}})
+
+	_, err := service.ResolveConflict(context.Background(), kconfigConflict())
+	assert.ErrorIs(t, err, ErrNoConsensus)
+}
+
+func TestNormalizeResolution(t *testing.T) {
+	assert.Equal(t, "if x:\n    y()", normalizeResolution("if x:  \r\n    y()\t\r\n\n"))
+	assert.NotEqual(t, normalizeResolution("if x:\n    y()\nz()"), normalizeResolution("if x:\n    y()\n    z()"))
+	assert.NotEqual(t, normalizeResolution("a\n\nb"), normalizeResolution("a\nb"))
+}
+
+func TestVote_SamplesRotateOverVoteModels(t *testing.T) {
+	first := &sequenceProvider{contents: []string{resolutionJSON("x")}}
+	second := &sequenceProvider{contents: []string{resolutionJSON("x")}}
+	service := newVotingService(&sequenceProvider{contents: []string{"unused"}}, nil, Voting{Samples: 3, ConflictTypes: []string{config.ConflictTypeKconfig}})
+	service.chains[config.OperationVote] = []backend{
+		{client: first, provider: config.ProviderOpenAI, model: "gpt-4o"},
+		{client: second, provider: config.ProviderAnthropic, model: "claude-sonnet-4-5"},
+	}
+
+	hunk := interfaces.ConflictHunk{StartLine: 1, EndLine: 5, Ours: "\tdefault 2", Theirs: "\tdefault 4"}
+	resolution, err := service.ResolveConflictHunk(context.Background(), kconfigConflict(), hunk)
+	require.NoError(t, err)
+
+	assert.Equal(t, "x", resolution.Resolution)
+	assert.Len(t, first.requests, 2)
+	assert.Len(t, second.requests, 1)
+}
+
+func TestParseVerdict_Malformed(t *testing.T) {
+	_, err := parseVerdict(`{"choice": 4, "confidence": 0.5, "rationale": ""}`, 3)
+	assert.ErrorIs(t, err, ErrMalformedResponse)
+
+	_, err = parseVerdict(`{"choice": 1, "rationale": ""}`, 3)
+	assert.ErrorIs(t, err, ErrMalformedResponse)
+}
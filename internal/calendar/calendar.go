@@ -0,0 +1,188 @@
+// Package calendar measures time in working hours, skipping nights, weekends
+// and holidays.
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// dateLayout is the layout of holidays
+const dateLayout = "2006-01-02"
+
+// Options describe a working week. Days are weekday names such as "monday" or
+// "mon", Start and End the working hours as "15:04" in TimeZone. Holidays are
+// dates as "2006-01-02".
+type Options struct {
+	Days     []string
+	Start    string
+	End      string
+	TimeZone string
+	Holidays []string
+}
+
+// Calendar knows when people work. A nil Calendar works around the clock.
+type Calendar struct {
+	location *time.Location
+	days     map[time.Weekday]bool
+	// start and end are offsets from midnight
+	start    time.Duration
+	end      time.Duration
+	holidays map[string]bool
+}
+
+// New returns the calendar of a working week
+func New(opts Options) (*Calendar, error) {
+	location, err := time.LoadLocation(opts.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: %w", opts.TimeZone, err)
+	}
+
+	c := &Calendar{
+		location: location,
+		days:     map[time.Weekday]bool{},
+		holidays: map[string]bool{},
+	}
+	if len(opts.Days) == 0 {
+		return nil, fmt.Errorf("calendar has no working days")
+	}
+	for _, name := range opts.Days {
+		day, ok := parseWeekday(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown working day %q", name)
+		}
+		c.days[day] = true
+	}
+
+	if c.start, err = parseClock(opts.Start); err != nil {
+		return nil, err
+	}
+	if c.end, err = parseClock(opts.End); err != nil {
+		return nil, err
+	}
+	if c.start >= c.end {
+		return nil, fmt.Errorf("working hours must start before they end, got %s to %s", opts.Start, opts.End)
+	}
+
+	for _, holiday := range opts.Holidays {
+		if _, err := time.Parse(dateLayout, holiday); err != nil {
+			return nil, fmt.Errorf("invalid holiday %q, want YYYY-MM-DD", holiday)
+		}
+		c.holidays[holiday] = true
+	}
+
+	return c, nil
+}
+
+// ReadHolidays reads a holiday file. Every line starts with a date as
+// YYYY-MM-DD, optionally followed by a description. Empty lines and lines
+// starting with # are ignored.
+func ReadHolidays(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holidays: %w", err)
+	}
+	defer file.Close()
+
+	var holidays []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		date := strings.Fields(text)[0]
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid date %q, want YYYY-MM-DD", path, line, date)
+		}
+		holidays = append(holidays, date)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read holidays: %w", err)
+	}
+	return holidays, nil
+}
+
+// IsWorkingTime reports if t is within the working hours of a working day
+func (c *Calendar) IsWorkingTime(t time.Time) bool {
+	if c == nil {
+		return true
+	}
+
+	t = t.In(c.location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, c.location)
+	start, end, ok := c.workingHours(midnight)
+	return ok && !t.Before(start) && t.Before(end)
+}
+
+// WorkingTime returns how much working time passed from from to to
+func (c *Calendar) WorkingTime(from, to time.Time) time.Duration {
+	if !to.After(from) {
+		return 0
+	}
+	if c == nil {
+		return to.Sub(from)
+	}
+
+	var total time.Duration
+	from = from.In(c.location)
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, c.location); day.Before(to); day = day.AddDate(0, 0, 1) {
+		start, end, ok := c.workingHours(day)
+		if !ok {
+			continue
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return total
+}
+
+// workingHours returns when work starts and ends on the day starting at
+// midnight, and false if nobody works that day
+func (c *Calendar) workingHours(midnight time.Time) (time.Time, time.Time, bool) {
+	if !c.days[midnight.Weekday()] || c.holidays[midnight.Format(dateLayout)] {
+		return time.Time{}, time.Time{}, false
+	}
+
+	return c.clockTime(midnight, c.start), c.clockTime(midnight, c.end), true
+}
+
+// clockTime returns the time of day offset from midnight. It is set by the
+// clock rather than added, so days with a DST change keep their hours.
+func (c *Calendar) clockTime(midnight time.Time, offset time.Duration) time.Time {
+	hours := int(offset / time.Hour)
+	minutes := int(offset % time.Hour / time.Minute)
+	return time.Date(midnight.Year(), midnight.Month(), midnight.Day(), hours, minutes, 0, 0, c.location)
+}
+
+// parseClock parses a time of day as "15:04" into its offset from midnight
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, want HH:MM", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseWeekday parses a weekday by its English name or its first three letters
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,132 @@
+package calendar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCalendar(t *testing.T, holidays ...string) *Calendar {
+	t.Helper()
+	c, err := New(Options{
+		Days:     []string{"mon", "tue", "wed", "thu", "friday"},
+		Start:    "09:00",
+		End:      "17:00",
+		TimeZone: "Europe/Berlin",
+		Holidays: holidays,
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func at(t *testing.T, value string) time.Time {
+	t.Helper()
+	location, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, location)
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestWorkingTime(t *testing.T) {
+	c := newCalendar(t, "2025-10-03")
+
+	tests := []struct {
+		name     string
+		from, to string
+		expected time.Duration
+	}{
+		{"within a day", "2025-10-06 10:00", "2025-10-06 12:30", 150 * time.Minute},
+		{"overnight", "2025-10-06 16:00", "2025-10-07 10:00", 2 * time.Hour},
+		{"before and after hours", "2025-10-06 06:00", "2025-10-06 20:00", 8 * time.Hour},
+		{"over the weekend", "2025-10-10 15:00", "2025-10-13 11:00", 4 * time.Hour},
+		{"holiday", "2025-10-02 17:00", "2025-10-06 09:00", 0},
+		{"three working days", "2025-10-06 09:00", "2025-10-09 09:00", 24 * time.Hour},
+		{"backwards", "2025-10-06 12:00", "2025-10-06 10:00", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, c.WorkingTime(at(t, tt.from), at(t, tt.to)))
+		})
+	}
+}
+
+func TestWorkingTime_OtherTimeZone(t *testing.T) {
+	c := newCalendar(t)
+
+	// 07:00 to 09:00 UTC is 09:00 to 11:00 in Berlin in summer
+	from := time.Date(2025, 7, 1, 7, 0, 0, 0, time.UTC)
+	assert.Equal(t, 2*time.Hour, c.WorkingTime(from, from.Add(2*time.Hour)))
+}
+
+func TestWorkingTime_DaylightSavingChange(t *testing.T) {
+	c, err := New(Options{
+		Days:     []string{"sunday", "monday"},
+		Start:    "00:00",
+		End:      "12:00",
+		TimeZone: "Europe/Berlin",
+	})
+	require.NoError(t, err)
+
+	// Clocks go forward at 02:00 on the last Sunday of March
+	assert.Equal(t, 11*time.Hour, c.WorkingTime(at(t, "2025-03-30 00:00"), at(t, "2025-03-30 18:00")))
+}
+
+func TestIsWorkingTime(t *testing.T) {
+	c := newCalendar(t, "2025-12-25")
+
+	assert.True(t, c.IsWorkingTime(at(t, "2025-10-06 09:00")))
+	assert.True(t, c.IsWorkingTime(at(t, "2025-10-06 16:59")))
+	assert.False(t, c.IsWorkingTime(at(t, "2025-10-06 17:00")))
+	assert.False(t, c.IsWorkingTime(at(t, "2025-10-06 08:59")))
+	assert.False(t, c.IsWorkingTime(at(t, "2025-10-11 12:00")), "Saturday")
+	assert.False(t, c.IsWorkingTime(at(t, "2025-12-25 12:00")), "holiday")
+}
+
+func TestNilCalendar(t *testing.T) {
+	var c *Calendar
+	from := time.Date(2025, 10, 11, 0, 0, 0, 0, time.UTC)
+
+	assert.True(t, c.IsWorkingTime(from))
+	assert.Equal(t, 48*time.Hour, c.WorkingTime(from, from.Add(48*time.Hour)))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	valid := Options{Days: []string{"mon"}, Start: "09:00", End: "17:00", TimeZone: "UTC"}
+
+	tests := map[string]func(*Options){
+		"no days":        func(o *Options) { o.Days = nil },
+		"unknown day":    func(o *Options) { o.Days = []string{"funday"} },
+		"bad start":      func(o *Options) { o.Start = "9am" },
+		"end before":     func(o *Options) { o.End = "08:00" },
+		"time zone":      func(o *Options) { o.TimeZone = "Mars/Olympus" },
+		"holiday format": func(o *Options) { o.Holidays = []string{"25.12.2025"} },
+	}
+
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := valid
+			change(&opts)
+			_, err := New(opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestReadHolidays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "holidays.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# Public holidays\n2025-10-03 Day of German Unity\n\n2025-12-25\n"), 0644))
+
+	holidays, err := ReadHolidays(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2025-10-03", "2025-12-25"}, holidays)
+
+	require.NoError(t, os.WriteFile(path, []byte("2025-10-03\nChristmas\n"), 0644))
+	_, err = ReadHolidays(path)
+	assert.ErrorContains(t, err, ":2:")
+}
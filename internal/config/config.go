@@ -1,10 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/calendar"
+	"github.com/BlindspotSoftware/rebAIser/internal/pathglob"
 )
 
 type Config struct {
@@ -16,27 +20,277 @@ type Config struct {
 	GitHub GitHubConfig `yaml:"github"`
 	Slack  SlackConfig  `yaml:"slack"`
 	Tests  TestsConfig  `yaml:"tests"`
+	// Calendar limits the auto-merge delay and optionally scheduled runs to
+	// working hours
+	Calendar CalendarConfig `yaml:"calendar"`
+
+	// StateDir keeps what is carried over from one run to the next, such as
+	// the resolution memory. It is needed by the features that use it.
+	StateDir string `yaml:"state_dir"`
+	// ReportDir is where dry runs write the report of what they would have
+	// done
+	ReportDir string `yaml:"report_dir"`
 	
 	// Runtime fields (not in YAML)
 	ActualWorkingDir string `yaml:"-"`
 	KeepArtifacts    bool   `yaml:"-"`
+	// Force rebases even if nothing moved since the last rebase
+	Force bool `yaml:"-"`
 }
 
 type GitConfig struct {
 	InternalRepo string `yaml:"internal_repo"`
 	UpstreamRepo string `yaml:"upstream_repo"`
-	WorkingDir   string `yaml:"working_dir"`
-	Branch       string `yaml:"branch"`
+	// WorkingDir keeps a bare mirror of both repositories between runs. Each
+	// run clones from it instead of from the remote. Empty clones afresh.
+	WorkingDir string `yaml:"working_dir"`
+	Branch     string `yaml:"branch"`
+
+	// ConflictPolicies resolve conflicts in matching files without the AI.
+	// The first matching policy wins.
+	ConflictPolicies []ConflictPolicy `yaml:"conflict_policies"`
+	// Handoff decides what happens to conflicts the AI cannot resolve
+	// confidently: "markers", "sidecar" or "abort"
+	Handoff string `yaml:"handoff"`
+	// Rerere replays recorded resolutions of conflicts without the AI
+	Rerere RerereConfig `yaml:"rerere"`
+	// SkipUnchanged skips runs if neither repository moved since the last
+	// successful rebase
+	SkipUnchanged bool `yaml:"skip_unchanged"`
+}
+
+// RerereConfig enables git rerere with its cache in the state directory
+type RerereConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SeedBranch is a branch of the internal repository whose tree holds
+	// rr-cache entries that are added to the cache before every run
+	SeedBranch string `yaml:"seed_branch"`
+}
+
+// Handoff modes
+const (
+	// HandoffMarkers commits unresolved files with their conflict markers
+	HandoffMarkers = "markers"
+	// HandoffSidecar commits the upstream version of unresolved files and
+	// the conflict next to them in a .rej file
+	HandoffSidecar = "sidecar"
+	// HandoffAbort aborts the run
+	HandoffAbort = "abort"
+)
+
+// ConflictPolicy resolves conflicts in files matching Patterns, or in any
+// binary file if Binary is set
+type ConflictPolicy struct {
+	Name     string   `yaml:"name"`
+	Patterns []string `yaml:"patterns"` // path globs, "**" matches any number of directories
+	Binary   bool     `yaml:"binary"`
+	Action   string   `yaml:"action"`
+	// Command and Args regenerate the files for the regenerate action. They
+	// run in the root of the internal repository.
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
 }
 
+// Conflict policy actions
+const (
+	PolicyTakeUpstream = "take-upstream"
+	PolicyTakeInternal = "take-internal"
+	PolicyRegenerate   = "regenerate"
+)
+
 type AIConfig struct {
+	// Provider is "openai", "openrouter", "anthropic" or "local". It
+	// defaults to "openai".
+	Provider        string `yaml:"provider"`
 	OpenAIAPIKey    string `yaml:"openai_api_key"`
 	OpenRouterAPIKey string `yaml:"openrouter_api_key"`
+	AnthropicAPIKey string `yaml:"anthropic_api_key"`
 	BaseURL         string `yaml:"base_url"`          // For OpenRouter or custom endpoints
 	Model           string `yaml:"model"`
 	MaxTokens       int    `yaml:"max_tokens"`
+	ResolutionMode  string `yaml:"resolution_mode"` // "hunk" or "file"
+	// ContextWindow is the context size of local models in tokens. Zero uses
+	// the value reported by the server.
+	ContextWindow int           `yaml:"context_window"`
+	Timeout       time.Duration `yaml:"timeout"`
+
+	Validation ValidationConfig `yaml:"validation"`
+	Confidence ConfidenceConfig `yaml:"confidence"`
+	Voting     VotingConfig     `yaml:"voting"`
+	Review     ReviewConfig     `yaml:"review"`
+	Memory     MemoryConfig     `yaml:"memory"`
+
+	// Operations maps an operation to the models to try in order. Operations
+	// that are not listed use Provider and Model.
+	Operations map[string][]ModelConfig `yaml:"operations"`
+
+	// Prices maps a model name to its price, for usage accounting
+	Prices map[string]PriceConfig `yaml:"prices"`
+	// MaxCostPerRun and MaxTokensPerRun stop AI calls once a run has used
+	// them up. Zero is unlimited.
+	MaxCostPerRun   float64 `yaml:"max_cost_per_run"`
+	MaxTokensPerRun int     `yaml:"max_tokens_per_run"`
+}
+
+// PriceConfig is the price of a model in US dollars per million tokens
+type PriceConfig struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+	// Prompt cache prices, 0.1 and 1.25 times the input price if unset
+	CacheRead  float64 `yaml:"cache_read"`
+	CacheWrite float64 `yaml:"cache_write"`
+}
+
+// ModelConfig selects a model of a provider. The API key is taken from the
+// provider's key in AIConfig.
+type ModelConfig struct {
+	Provider string `yaml:"provider"`
+	Model    string `yaml:"model"`
+	BaseURL  string `yaml:"base_url"`
+}
+
+// AI operations that can be given their own models
+const (
+	OperationResolveConflict = "resolve_conflict"
+	OperationCommitMessage   = "commit_message"
+	OperationPRDescription   = "pr_description"
+	OperationRepair          = "repair"
+	// OperationVote draws the samples of conflicts resolved by voting
+	OperationVote = "vote"
+	// OperationJudge picks one of the samples when they disagree
+	OperationJudge = "judge"
+	// OperationReview reviews the rebased changes as a whole
+	OperationReview = "review"
+)
+
+// ValidationConfig controls the checks AI resolutions must pass before they
+// are staged
+type ValidationConfig struct {
+	// MaxRetries is how often a rejected resolution is retried with the
+	// problems as feedback before the conflict is given up, 0 gives up
+	// right away. Defaults to 2.
+	MaxRetries int `yaml:"max_retries"`
+	// SyntaxChecks parses resolved files with language tools such as gofmt
+	SyntaxChecks bool `yaml:"syntax_checks"`
+}
+
+// ConfidenceConfig decides what happens to an AI resolution based on the
+// confidence the model reports for it
+type ConfidenceConfig struct {
+	// AutoApply is the confidence from which resolutions are applied
+	// without further notice. Defaults to 0.8.
+	AutoApply float64 `yaml:"auto_apply"`
+	// Review is the confidence from which resolutions are applied but
+	// flagged for review. Conflicts below it are left for a human, 0 leaves
+	// none. Defaults to 0.5.
+	Review float64 `yaml:"review"`
+}
+
+// VotingConfig resolves high-risk conflicts by drawing several resolutions
+// and comparing them. It applies to conflicts of the listed types or in files
+// matching the patterns.
+type VotingConfig struct {
+	// Samples is the number of resolutions to draw
+	Samples       int      `yaml:"samples"`
+	ConflictTypes []string `yaml:"conflict_types"`
+	Patterns      []string `yaml:"patterns"` // path globs, "**" matches any number of directories
+	// OnDisagreement is "judge" to let the judge operation pick one of
+	// disagreeing samples, or "human" to leave the conflict for a human
+	OnDisagreement string `yaml:"on_disagreement"`
+}
+
+// Conflict types the AI service recognizes, for selecting conflicts that are
+// resolved by voting
+const (
+	ConflictTypeKconfig    = "kconfig"
+	ConflictTypeDeviceTree = "devicetree"
+	ConflictTypeGPIO       = "gpio"
+	ConflictTypeRegister   = "register"
+	ConflictTypeConfig     = "config"
+	ConflictTypeTiming     = "timing"
+	ConflictTypeCode       = "code"
+)
+
+// What to do when voting samples disagree
+const (
+	DisagreementJudge = "judge"
+	DisagreementHuman = "human"
+)
+
+// ReviewConfig asks the AI to review the rebased changes to the files with
+// conflicts as a whole before the PR is created
+type ReviewConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// BlockOn is the severity from which findings keep the PR from being
+	// created: "info", "warning" or "error". Empty never blocks.
+	BlockOn string `yaml:"block_on"`
+}
+
+// MemoryConfig remembers the final resolutions of merged rebase PRs in the
+// state directory and shows similar ones to the AI as examples
+type MemoryConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Examples is the number of past resolutions shown with a conflict
+	Examples int `yaml:"examples"`
 }
 
+// Severities of review findings
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// AI providers
+const (
+	ProviderOpenAI     = "openai"
+	ProviderOpenRouter = "openrouter"
+	ProviderAnthropic  = "anthropic"
+	// ProviderLocal is a self-hosted OpenAI compatible server such as Ollama,
+	// llama.cpp or vLLM. It needs no API key.
+	ProviderLocal = "local"
+)
+
+// APIKey returns the API key of the configured provider
+func (c AIConfig) APIKey() string {
+	return c.ProviderAPIKey(c.Provider)
+}
+
+// ProviderAPIKeyEnv returns the environment variable with the API key of a
+// provider, empty for providers without a key
+func ProviderAPIKeyEnv(provider string) string {
+	switch provider {
+	case ProviderLocal:
+		return ""
+	case ProviderOpenRouter:
+		return "OPENROUTER_API_KEY"
+	case ProviderAnthropic:
+		return "ANTHROPIC_API_KEY"
+	default:
+		return "OPENAI_API_KEY"
+	}
+}
+
+// ProviderAPIKey returns the API key of a provider
+func (c AIConfig) ProviderAPIKey(provider string) string {
+	switch provider {
+	case ProviderLocal:
+		return ""
+	case ProviderOpenRouter:
+		return c.OpenRouterAPIKey
+	case ProviderAnthropic:
+		return c.AnthropicAPIKey
+	default:
+		return c.OpenAIAPIKey
+	}
+}
+
+// Conflict resolution modes
+const (
+	ResolutionModeHunk = "hunk"
+	ResolutionModeFile = "file"
+)
+
 type GitHubConfig struct {
 	Token            string        `yaml:"token"`
 	Owner            string        `yaml:"owner"`
@@ -44,6 +298,58 @@ type GitHubConfig struct {
 	AutoMergeDelay   time.Duration `yaml:"auto_merge_delay"`
 	PRTemplate       string        `yaml:"pr_template"`
 	ReviewersTeam    string        `yaml:"reviewers_team"`
+
+	// AutoMerge merges rebase PRs without activity for AutoMergeDelay, once
+	// their checks pass and nobody requested changes
+	AutoMerge   bool   `yaml:"auto_merge"`
+	MergeMethod string `yaml:"merge_method"`
+
+	// SupersedePolicy decides what happens to open rebase PRs when a run
+	// opens a new one
+	SupersedePolicy string `yaml:"supersede_policy"`
+}
+
+// Merge methods
+const (
+	MergeMethodMerge  = "merge"
+	MergeMethodSquash = "squash"
+	MergeMethodRebase = "rebase"
+)
+
+// Supersede policies
+const (
+	// SupersedeNone leaves open rebase PRs alone
+	SupersedeNone = "none"
+	// SupersedeUpdate force pushes to the newest open rebase PR and
+	// refreshes its description, and closes the others
+	SupersedeUpdate = "update"
+	// SupersedeClose closes open rebase PRs with a link to the new one
+	SupersedeClose = "close"
+)
+
+// CalendarConfig describes the working week. Days are weekday names, Start
+// and End the working hours as "15:04" in TimeZone.
+type CalendarConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Days     []string `yaml:"days"`
+	Start    string   `yaml:"start"`
+	End      string   `yaml:"end"`
+	TimeZone string   `yaml:"time_zone"`
+	// HolidaysFile lists the days off, one YYYY-MM-DD date per line
+	HolidaysFile string `yaml:"holidays_file"`
+	// WorkingHoursOnly skips scheduled runs outside working hours
+	WorkingHoursOnly bool `yaml:"working_hours_only"`
+}
+
+// Options returns the working week for the calendar package. Holidays are
+// read from HolidaysFile separately.
+func (c CalendarConfig) Options() calendar.Options {
+	return calendar.Options{
+		Days:     c.Days,
+		Start:    c.Start,
+		End:      c.End,
+		TimeZone: c.TimeZone,
+	}
 }
 
 type SlackConfig struct {
@@ -55,6 +361,9 @@ type SlackConfig struct {
 type TestsConfig struct {
 	Commands []TestCommand `yaml:"commands"`
 	Timeout  time.Duration `yaml:"timeout"`
+	// MaxRepairAttempts is how often failing tests are fed back to the AI
+	// for a fix. A negative value disables the repair loop.
+	MaxRepairAttempts int `yaml:"max_repair_attempts"`
 }
 
 type TestCommand struct {
@@ -71,7 +380,12 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	var config Config
+	// Defaults for which zero is a valid setting are set before decoding, so
+	// an explicit 0 in the file is kept
+	config := Config{AI: AIConfig{
+		Validation: ValidationConfig{MaxRetries: 2},
+		Confidence: ConfidenceConfig{AutoApply: 0.8, Review: 0.5},
+	}}
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
@@ -83,6 +397,9 @@ func LoadConfig(path string) (*Config, error) {
 	if apiKey := os.Getenv("OPENROUTER_API_KEY"); apiKey != "" {
 		config.AI.OpenRouterAPIKey = apiKey
 	}
+	if apiKey := os.Getenv("ANTHROPIC_API_KEY"); apiKey != "" {
+		config.AI.AnthropicAPIKey = apiKey
+	}
 	if baseURL := os.Getenv("AI_BASE_URL"); baseURL != "" {
 		config.AI.BaseURL = baseURL
 	}
@@ -97,30 +414,82 @@ func LoadConfig(path string) (*Config, error) {
 	if config.Interval == 0 {
 		config.Interval = 8 * time.Hour // Default to 3 times per day
 	}
+	if config.ReportDir == "" {
+		config.ReportDir = "."
+	}
 	
-	// Auto-detect provider based on API keys
-	usingOpenRouter := config.AI.OpenRouterAPIKey != ""
-	_ = config.AI.OpenAIAPIKey != ""
+	if config.AI.Provider == "" {
+		config.AI.Provider = ProviderOpenAI
+	}
 	
 	if config.AI.Model == "" {
-		if usingOpenRouter {
+		switch config.AI.Provider {
+		case ProviderOpenRouter:
 			config.AI.Model = "anthropic/claude-3.5-sonnet"
-		} else {
+		case ProviderAnthropic:
+			config.AI.Model = "claude-sonnet-4-5"
+		case ProviderLocal:
+			// Discovered from the server
+		default:
 			config.AI.Model = "gpt-4"
 		}
 	}
 	if config.AI.MaxTokens == 0 {
 		config.AI.MaxTokens = 2000
 	}
-	if config.AI.BaseURL == "" && usingOpenRouter {
+	if config.AI.ResolutionMode == "" {
+		config.AI.ResolutionMode = ResolutionModeHunk
+	}
+	if config.Git.Handoff == "" {
+		config.Git.Handoff = HandoffMarkers
+	}
+	if config.AI.Voting.Samples == 0 {
+		config.AI.Voting.Samples = 3
+	}
+	if config.AI.Voting.OnDisagreement == "" {
+		config.AI.Voting.OnDisagreement = DisagreementJudge
+	}
+	if config.AI.Memory.Examples == 0 {
+		config.AI.Memory.Examples = 3
+	}
+	if config.AI.Timeout == 0 {
+		if config.AI.Provider == ProviderLocal {
+			// Local models on modest hardware are a lot slower
+			config.AI.Timeout = 10 * time.Minute
+		} else {
+			config.AI.Timeout = 2 * time.Minute
+		}
+	}
+	if config.AI.BaseURL == "" && config.AI.Provider == ProviderOpenRouter {
 		config.AI.BaseURL = "https://openrouter.ai/api/v1"
 	}
 	if config.GitHub.AutoMergeDelay == 0 {
 		config.GitHub.AutoMergeDelay = 24 * time.Hour
 	}
+	if config.GitHub.MergeMethod == "" {
+		config.GitHub.MergeMethod = MergeMethodRebase
+	}
+	if config.GitHub.SupersedePolicy == "" {
+		config.GitHub.SupersedePolicy = SupersedeNone
+	}
+	if len(config.Calendar.Days) == 0 {
+		config.Calendar.Days = []string{"monday", "tuesday", "wednesday", "thursday", "friday"}
+	}
+	if config.Calendar.Start == "" {
+		config.Calendar.Start = "09:00"
+	}
+	if config.Calendar.End == "" {
+		config.Calendar.End = "17:00"
+	}
+	if config.Calendar.TimeZone == "" {
+		config.Calendar.TimeZone = "Local"
+	}
 	if config.Tests.Timeout == 0 {
 		config.Tests.Timeout = 30 * time.Minute
 	}
+	if config.Tests.MaxRepairAttempts == 0 {
+		config.Tests.MaxRepairAttempts = 2
+	}
 	if config.Slack.Username == "" {
 		config.Slack.Username = "AI Rebaser"
 	}
@@ -128,5 +497,170 @@ func LoadConfig(path string) (*Config, error) {
 		config.Slack.Channel = "#dev"
 	}
 
+	if !validProvider(config.AI.Provider) {
+		return nil, fmt.Errorf("unknown AI provider %q", config.AI.Provider)
+	}
+	if err := validateOperations(&config.AI); err != nil {
+		return nil, err
+	}
+	if config.AI.Validation.MaxRetries < 0 {
+		return nil, fmt.Errorf("validation: max_retries must not be negative")
+	}
+	if config.AI.MaxCostPerRun < 0 || config.AI.MaxTokensPerRun < 0 {
+		return nil, fmt.Errorf("AI usage limits must not be negative")
+	}
+	if confidence := config.AI.Confidence; confidence.Review < 0 || confidence.AutoApply > 1 || confidence.Review > confidence.AutoApply {
+		return nil, fmt.Errorf("AI confidence thresholds must satisfy 0 <= review <= auto_apply <= 1")
+	}
+
+	if err := validateVoting(config.AI.Voting); err != nil {
+		return nil, err
+	}
+	if config.Git.Rerere.Enabled && config.StateDir == "" {
+		return nil, fmt.Errorf("rerere needs a state_dir")
+	}
+	if config.AI.Memory.Enabled && config.StateDir == "" {
+		return nil, fmt.Errorf("the resolution memory needs a state_dir")
+	}
+	if config.Git.SkipUnchanged && config.StateDir == "" {
+		return nil, fmt.Errorf("skip_unchanged needs a state_dir")
+	}
+	if config.AI.Memory.Examples < 0 {
+		return nil, fmt.Errorf("memory: examples must not be negative")
+	}
+	switch config.AI.Review.BlockOn {
+	case "", SeverityInfo, SeverityWarning, SeverityError:
+	default:
+		return nil, fmt.Errorf("review: unknown block_on severity %q", config.AI.Review.BlockOn)
+	}
+	if err := validateConflictPolicies(config.Git.ConflictPolicies); err != nil {
+		return nil, err
+	}
+	switch config.Git.Handoff {
+	case HandoffMarkers, HandoffSidecar, HandoffAbort:
+	default:
+		return nil, fmt.Errorf("unknown handoff mode %q", config.Git.Handoff)
+	}
+	switch config.GitHub.MergeMethod {
+	case MergeMethodMerge, MergeMethodSquash, MergeMethodRebase:
+	default:
+		return nil, fmt.Errorf("unknown merge method %q", config.GitHub.MergeMethod)
+	}
+	switch config.GitHub.SupersedePolicy {
+	case SupersedeNone, SupersedeUpdate, SupersedeClose:
+	default:
+		return nil, fmt.Errorf("unknown supersede policy %q", config.GitHub.SupersedePolicy)
+	}
+	if config.Calendar.Enabled {
+		if _, err := calendar.New(config.Calendar.Options()); err != nil {
+			return nil, fmt.Errorf("calendar: %w", err)
+		}
+	}
+
 	return &config, nil
+}
+
+func validProvider(provider string) bool {
+	switch provider {
+	case ProviderOpenAI, ProviderOpenRouter, ProviderAnthropic, ProviderLocal:
+		return true
+	}
+	return false
+}
+
+// validateOperations checks the model chains of the AI operations and fills
+// in the base URLs they share with the default provider
+func validateOperations(ai *AIConfig) error {
+	for operation, models := range ai.Operations {
+		switch operation {
+		case OperationResolveConflict, OperationCommitMessage, OperationPRDescription, OperationRepair, OperationVote, OperationJudge, OperationReview:
+		default:
+			return fmt.Errorf("unknown AI operation %q", operation)
+		}
+
+		if len(models) == 0 {
+			return fmt.Errorf("AI operation %s has no models", operation)
+		}
+
+		for i := range models {
+			model := &models[i]
+			if !validProvider(model.Provider) {
+				return fmt.Errorf("AI operation %s: unknown provider %q", operation, model.Provider)
+			}
+			if model.Model == "" && model.Provider != ProviderLocal {
+				return fmt.Errorf("AI operation %s: %s needs a model", operation, model.Provider)
+			}
+
+			if model.BaseURL == "" {
+				if model.Provider == ai.Provider {
+					model.BaseURL = ai.BaseURL
+				} else if model.Provider == ProviderOpenRouter {
+					model.BaseURL = "https://openrouter.ai/api/v1"
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateVoting checks the conflicts selected for voting and what happens
+// when their samples disagree
+func validateVoting(voting VotingConfig) error {
+	if voting.Samples < 2 {
+		return fmt.Errorf("voting needs at least 2 samples")
+	}
+
+	for _, conflictType := range voting.ConflictTypes {
+		switch conflictType {
+		case ConflictTypeKconfig, ConflictTypeDeviceTree, ConflictTypeGPIO, ConflictTypeRegister,
+			ConflictTypeConfig, ConflictTypeTiming, ConflictTypeCode:
+		default:
+			return fmt.Errorf("voting: unknown conflict type %q", conflictType)
+		}
+	}
+
+	for _, pattern := range voting.Patterns {
+		if !pathglob.Valid(pattern) {
+			return fmt.Errorf("voting: invalid pattern %q", pattern)
+		}
+	}
+
+	switch voting.OnDisagreement {
+	case DisagreementJudge, DisagreementHuman:
+	default:
+		return fmt.Errorf("voting: unknown on_disagreement %q", voting.OnDisagreement)
+	}
+
+	return nil
+}
+
+func validateConflictPolicies(policies []ConflictPolicy) error {
+	for i, policy := range policies {
+		name := policy.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		switch policy.Action {
+		case PolicyTakeUpstream, PolicyTakeInternal:
+		case PolicyRegenerate:
+			if policy.Command == "" {
+				return fmt.Errorf("conflict policy %s: regenerate requires a command", name)
+			}
+		default:
+			return fmt.Errorf("conflict policy %s: unknown action %q", name, policy.Action)
+		}
+
+		if len(policy.Patterns) == 0 && !policy.Binary {
+			return fmt.Errorf("conflict policy %s: needs patterns or binary", name)
+		}
+		for _, pattern := range policy.Patterns {
+			if !pathglob.Valid(pattern) {
+				return fmt.Errorf("conflict policy %s: invalid pattern %q", name, pattern)
+			}
+		}
+	}
+
+	return nil
 }
\ No newline at end of file
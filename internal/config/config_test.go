@@ -19,7 +19,7 @@ func TestLoadConfig(t *testing.T) {
 			os.Unsetenv("OPENAI_API_KEY")
 		}
 	}()
-	
+
 	// Clear the environment variable for testing
 	os.Unsetenv("OPENAI_API_KEY")
 
@@ -145,10 +145,24 @@ slack:
 
 	// Verify defaults are applied
 	assert.Equal(t, 8*time.Hour, cfg.Interval)
+	assert.Equal(t, ".", cfg.ReportDir)
 	assert.Equal(t, "gpt-4", cfg.AI.Model)
 	assert.Equal(t, 2000, cfg.AI.MaxTokens)
+	assert.Equal(t, 2*time.Minute, cfg.AI.Timeout)
+	assert.Equal(t, ResolutionModeHunk, cfg.AI.ResolutionMode)
+	assert.Equal(t, HandoffMarkers, cfg.Git.Handoff)
+	assert.Equal(t, 2, cfg.AI.Validation.MaxRetries)
+	assert.False(t, cfg.AI.Validation.SyntaxChecks)
 	assert.Equal(t, 24*time.Hour, cfg.GitHub.AutoMergeDelay)
+	assert.False(t, cfg.GitHub.AutoMerge)
+	assert.Equal(t, MergeMethodRebase, cfg.GitHub.MergeMethod)
+	assert.Equal(t, SupersedeNone, cfg.GitHub.SupersedePolicy)
+	assert.False(t, cfg.Calendar.Enabled)
+	assert.Equal(t, []string{"monday", "tuesday", "wednesday", "thursday", "friday"}, cfg.Calendar.Days)
+	assert.Equal(t, "09:00", cfg.Calendar.Start)
+	assert.Equal(t, "17:00", cfg.Calendar.End)
 	assert.Equal(t, 30*time.Minute, cfg.Tests.Timeout)
+	assert.Equal(t, 2, cfg.Tests.MaxRepairAttempts)
 }
 
 func TestLoadConfig_FileNotFound(t *testing.T) {
@@ -176,4 +190,417 @@ invalid: yaml: content:
 	cfg, err := LoadConfig(tmpFile.Name())
 	assert.Error(t, err)
 	assert.Nil(t, cfg)
+}
+
+func TestLoadConfig_ConflictPolicies(t *testing.T) {
+	configContent := `
+git:
+  conflict_policies:
+    - name: "blobs"
+      binary: true
+      patterns: ["3rdparty/blobs/**", "*.vbt"]
+      action: "take-upstream"
+    - name: "generated"
+      patterns: ["src/**/generated/*.h"]
+      action: "regenerate"
+      command: "make"
+      args: ["generated-headers"]
+`
+
+	tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(configContent)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Git.ConflictPolicies, 2)
+	assert.Equal(t, ConflictPolicy{
+		Name:     "blobs",
+		Binary:   true,
+		Patterns: []string{"3rdparty/blobs/**", "*.vbt"},
+		Action:   PolicyTakeUpstream,
+	}, cfg.Git.ConflictPolicies[0])
+	assert.Equal(t, PolicyRegenerate, cfg.Git.ConflictPolicies[1].Action)
+	assert.Equal(t, "make", cfg.Git.ConflictPolicies[1].Command)
+	assert.Equal(t, []string{"generated-headers"}, cfg.Git.ConflictPolicies[1].Args)
+}
+
+func TestLoadConfig_InvalidConflictPolicies(t *testing.T) {
+	tests := map[string]string{
+		"unknown action":        `{name: a, patterns: ["*.bin"], action: take-ours}`,
+		"regenerate no command": `{name: a, patterns: ["*.h"], action: regenerate}`,
+		"no patterns":           `{name: a, action: take-upstream}`,
+		"invalid pattern":       `{name: a, patterns: ["[a-"], action: take-upstream}`,
+	}
+
+	for name, policy := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString("git:\n  conflict_policies:\n    - " + policy + "\n")
+			require.NoError(t, err)
+			tmpFile.Close()
+
+			cfg, err := LoadConfig(tmpFile.Name())
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+		})
+	}
+}
+func TestLoadConfig_Provider(t *testing.T) {
+	tests := []struct {
+		name     string
+		ai       string
+		provider string
+		model    string
+		apiKey   string
+	}{
+		{"explicit anthropic", "{provider: anthropic, anthropic_api_key: a, openai_api_key: o}", ProviderAnthropic, "claude-sonnet-4-5", "a"},
+		{"explicit openai", "{provider: openai, openai_api_key: o, openrouter_api_key: r}", ProviderOpenAI, "gpt-4", "o"},
+		{"explicit openrouter", "{provider: openrouter, openrouter_api_key: r}", ProviderOpenRouter, "anthropic/claude-3.5-sonnet", "r"},
+		// The provider is never guessed from the keys that are set
+		{"default with openrouter key", "{openrouter_api_key: r, openai_api_key: o}", ProviderOpenAI, "gpt-4", "o"},
+		{"default with anthropic key", "{anthropic_api_key: a}", ProviderOpenAI, "gpt-4", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OPENAI_API_KEY", "")
+			t.Setenv("OPENROUTER_API_KEY", "")
+			t.Setenv("ANTHROPIC_API_KEY", "")
+
+			tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString("ai: " + tt.ai + "\n")
+			require.NoError(t, err)
+			tmpFile.Close()
+
+			cfg, err := LoadConfig(tmpFile.Name())
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.provider, cfg.AI.Provider)
+			assert.Equal(t, tt.model, cfg.AI.Model)
+			assert.Equal(t, tt.apiKey, cfg.AI.APIKey())
+		})
+	}
+}
+
+func TestLoadConfig_UnknownProvider(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString("ai:\n  provider: gemini\n")
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	assert.ErrorContains(t, err, "unknown AI provider")
+	assert.Nil(t, cfg)
+}
+
+func TestLoadConfig_LocalProvider(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("AI_BASE_URL", "")
+
+	tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString("ai:\n  provider: local\n  base_url: http://gpu-box:8000/v1\n  context_window: 16384\n")
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	require.NoError(t, err)
+
+	assert.Equal(t, ProviderLocal, cfg.AI.Provider)
+	assert.Empty(t, cfg.AI.Model)
+	assert.Empty(t, cfg.AI.APIKey())
+	assert.Equal(t, "http://gpu-box:8000/v1", cfg.AI.BaseURL)
+	assert.Equal(t, 16384, cfg.AI.ContextWindow)
+	assert.Equal(t, 10*time.Minute, cfg.AI.Timeout)
+}
+
+func TestLoadConfig_Operations(t *testing.T) {
+	configContent := `
+ai:
+  provider: openrouter
+  base_url: "https://proxy.example.com/v1"
+  operations:
+    resolve_conflict:
+      - provider: anthropic
+        model: claude-sonnet-4-5
+      - provider: openrouter
+        model: openai/gpt-4o
+    commit_message:
+      - provider: local
+`
+
+	tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(configContent)
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	require.NoError(t, err)
+
+	require.Len(t, cfg.AI.Operations[OperationResolveConflict], 2)
+	assert.Equal(t, ModelConfig{Provider: ProviderAnthropic, Model: "claude-sonnet-4-5"}, cfg.AI.Operations[OperationResolveConflict][0])
+	// Models of the default provider share its base URL
+	assert.Equal(t, "https://proxy.example.com/v1", cfg.AI.Operations[OperationResolveConflict][1].BaseURL)
+	assert.Equal(t, ModelConfig{Provider: ProviderLocal}, cfg.AI.Operations[OperationCommitMessage][0])
+}
+
+func TestLoadConfig_InvalidOperations(t *testing.T) {
+	tests := map[string]string{
+		"unknown operation": `{summarize: [{provider: openai, model: gpt-4}]}`,
+		"no models":         `{repair: []}`,
+		"unknown provider":  `{repair: [{provider: gemini, model: pro}]}`,
+		"missing model":     `{repair: [{provider: anthropic}]}`,
+	}
+
+	for name, operations := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString("ai:\n  operations: " + operations + "\n")
+			require.NoError(t, err)
+			tmpFile.Close()
+
+			cfg, err := LoadConfig(tmpFile.Name())
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+		})
+	}
+}
+
+func TestLoadConfig_Confidence(t *testing.T) {
+	tests := map[string]struct {
+		confidence string
+		want       ConfidenceConfig
+		wantErr    bool
+	}{
+		"defaults":     {confidence: `{}`, want: ConfidenceConfig{AutoApply: 0.8, Review: 0.5}},
+		"custom":       {confidence: `{auto_apply: 0.9, review: 0.3}`, want: ConfidenceConfig{AutoApply: 0.9, Review: 0.3}},
+		"review all":   {confidence: `{review: 0}`, want: ConfidenceConfig{AutoApply: 0.8, Review: 0}},
+		"apply all":    {confidence: `{auto_apply: 0, review: 0}`, want: ConfidenceConfig{AutoApply: 0, Review: 0}},
+		"out of range": {confidence: `{auto_apply: 90}`, wantErr: true},
+		"inverted":     {confidence: `{auto_apply: 0.4, review: 0.6}`, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString("ai:\n  confidence: " + tt.confidence + "\n")
+			require.NoError(t, err)
+			tmpFile.Close()
+
+			cfg, err := LoadConfig(tmpFile.Name())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.AI.Confidence)
+		})
+	}
+}
+
+func TestLoadConfig_UnknownHandoff(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString("git:\n  handoff: skip\n")
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestLoadConfig_Voting(t *testing.T) {
+	tests := map[string]struct {
+		voting  string
+		want    VotingConfig
+		wantErr bool
+	}{
+		"defaults": {voting: `{}`, want: VotingConfig{Samples: 3, OnDisagreement: DisagreementJudge}},
+		"custom": {
+			voting: `{samples: 5, conflict_types: [kconfig, register], patterns: ["src/soc/**/gpio.c"], on_disagreement: human}`,
+			want:   VotingConfig{Samples: 5, ConflictTypes: []string{ConflictTypeKconfig, ConflictTypeRegister}, Patterns: []string{"src/soc/**/gpio.c"}, OnDisagreement: DisagreementHuman},
+		},
+		"one sample":           {voting: `{samples: 1}`, wantErr: true},
+		"unknown type":         {voting: `{conflict_types: [makefile]}`, wantErr: true},
+		"unknown disagreement": {voting: `{on_disagreement: retry}`, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString("ai:\n  voting: " + tt.voting + "\n")
+			require.NoError(t, err)
+			tmpFile.Close()
+
+			cfg, err := LoadConfig(tmpFile.Name())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.AI.Voting)
+		})
+	}
+}
+
+func TestLoadConfig_UnknownReviewSeverity(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString("ai:\n  review:\n    enabled: true\n    block_on: critical\n")
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestLoadConfig_MaxRetries(t *testing.T) {
+	tests := map[string]int{
+		"ai:\n  validation:\n    syntax_checks: true\n": 2,
+		"ai:\n  validation:\n    max_retries: 0\n":      0,
+		"ai:\n  validation:\n    max_retries: 5\n":      5,
+		"ai:\n  validation:\n    max_retries: -1\n":     -1,
+	}
+
+	for yaml, expected := range tests {
+		t.Run(yaml, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString(yaml)
+			require.NoError(t, err)
+			tmpFile.Close()
+
+			cfg, err := LoadConfig(tmpFile.Name())
+			if expected < 0 {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, expected, cfg.AI.Validation.MaxRetries)
+		})
+	}
+}
+
+func TestLoadConfig_UnknownMergeMethod(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString("github:\n  auto_merge: true\n  merge_method: fast-forward\n")
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestLoadConfig_UnknownSupersedePolicy(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString("github:\n  supersede_policy: replace\n")
+	require.NoError(t, err)
+	tmpFile.Close()
+
+	cfg, err := LoadConfig(tmpFile.Name())
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestLoadConfig_Calendar(t *testing.T) {
+	tests := map[string]bool{
+		"calendar:\n  enabled: true\n  time_zone: Europe/Berlin\n  days: [mon, wed]\n": true,
+		"calendar:\n  enabled: true\n  start: \"18:00\"\n":                             false,
+		"calendar:\n  enabled: true\n  days: [someday]\n":                              false,
+		"calendar:\n  enabled: true\n  time_zone: Nowhere/Special\n":                   false,
+		"calendar:\n  time_zone: Nowhere/Special\n":                                    true,
+	}
+
+	for yaml, valid := range tests {
+		tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpFile.Name())
+
+		_, err = tmpFile.WriteString(yaml)
+		require.NoError(t, err)
+		tmpFile.Close()
+
+		cfg, err := LoadConfig(tmpFile.Name())
+		if valid {
+			assert.NoError(t, err, yaml)
+			assert.NotNil(t, cfg)
+		} else {
+			assert.Error(t, err, yaml)
+			assert.Nil(t, cfg)
+		}
+	}
+}
+
+func TestLoadConfig_NeedsStateDir(t *testing.T) {
+	tests := map[string]string{
+		"memory":         "ai:\n  memory:\n    enabled: true\n",
+		"rerere":         "git:\n  rerere:\n    enabled: true\n",
+		"skip unchanged": "git:\n  skip_unchanged: true\n",
+	}
+
+	for name, yaml := range tests {
+		for _, stateDir := range []string{"", "/var/lib/rebaiser"} {
+			t.Run(name+" "+stateDir, func(t *testing.T) {
+				tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+				require.NoError(t, err)
+				defer os.Remove(tmpFile.Name())
+
+				_, err = tmpFile.WriteString("state_dir: \"" + stateDir + "\"\n" + yaml)
+				require.NoError(t, err)
+				tmpFile.Close()
+
+				cfg, err := LoadConfig(tmpFile.Name())
+				if stateDir == "" {
+					assert.Error(t, err)
+					assert.Nil(t, cfg)
+				} else {
+					assert.NoError(t, err)
+				}
+			})
+		}
+	}
 }
\ No newline at end of file
@@ -0,0 +1,353 @@
+// Package dryrun keeps a run from changing anything outside its working
+// directory. Pushes, pull requests and notifications are recorded in a Plan
+// instead, which is written out as a report for a human to check.
+package dryrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// Resolution is the proposed resolution of a conflict
+type Resolution struct {
+	File       string   `json:"file"`
+	Type       string   `json:"type"`
+	Action     string   `json:"action"`
+	Strategy   string   `json:"strategy,omitempty"`
+	Confidence float64  `json:"confidence,omitempty"`
+	Rationale  string   `json:"rationale,omitempty"`
+	Risks      []string `json:"risks,omitempty"`
+	Unresolved bool     `json:"unresolved,omitempty"`
+}
+
+// PullRequest is a pull request the run would have opened, or updated if
+// Updates is the number of an existing PR
+type PullRequest struct {
+	Updates   int      `json:"updates,omitempty"`
+	Title     string   `json:"title"`
+	Body      string   `json:"body"`
+	Head      string   `json:"head"`
+	Base      string   `json:"base"`
+	Draft     bool     `json:"draft"`
+	Reviewers []string `json:"reviewers,omitempty"`
+}
+
+// Close is a pull request the run would have closed
+type Close struct {
+	Number  int    `json:"number"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Notification is a message the run would have sent
+type Notification struct {
+	Title          string `json:"title"`
+	Message        string `json:"message"`
+	URL            string `json:"url,omitempty"`
+	Level          string `json:"level"`
+	ActionRequired bool   `json:"action_required,omitempty"`
+}
+
+type planData struct {
+	Branch        string         `json:"branch"`
+	Pushes        []string       `json:"pushes"`
+	PullRequests  []PullRequest  `json:"pull_requests"`
+	Merges        []int          `json:"merges"`
+	Closes        []Close        `json:"closes"`
+	Notifications []Notification `json:"notifications"`
+	Resolutions   []Resolution   `json:"resolutions"`
+	// Diffs are the unified diffs from upstream to the rebased branch of
+	// the files with conflicts, by file
+	Diffs map[string]string `json:"diffs"`
+}
+
+// Plan records what a dry run would have done. It is safe for concurrent use,
+// and a nil Plan records nothing.
+type Plan struct {
+	mu   sync.Mutex
+	data planData
+}
+
+// NewPlan returns an empty plan
+func NewPlan() *Plan {
+	return &Plan{}
+}
+
+// Reset starts the plan of a new run on branch
+func (p *Plan) Reset(branch string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data = planData{Branch: branch}
+}
+
+// SetResolutions records the proposed resolutions of the conflicts and the
+// diffs of their files
+func (p *Plan) SetResolutions(conflicts []interfaces.GitConflict, diffs map[string]string) {
+	if p == nil {
+		return
+	}
+
+	resolutions := make([]Resolution, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		resolution := Resolution{
+			File:       conflict.File,
+			Type:       string(conflict.Type),
+			Action:     conflict.Action,
+			Unresolved: conflict.Unresolved,
+		}
+		if resolution.Type == "" {
+			resolution.Type = string(interfaces.ConflictBothModified)
+		}
+		if conflict.Resolution != nil {
+			resolution.Strategy = string(conflict.Resolution.Strategy)
+			resolution.Confidence = conflict.Resolution.Confidence
+			resolution.Rationale = conflict.Resolution.Rationale
+			resolution.Risks = conflict.Resolution.Risks
+		}
+		resolutions = append(resolutions, resolution)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data.Resolutions = resolutions
+	p.data.Diffs = diffs
+}
+
+func (p *Plan) addPush(branch string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data.Pushes = append(p.data.Pushes, branch)
+}
+
+// addPullRequest records a pull request and returns its number, which is its
+// place in the plan
+func (p *Plan) addPullRequest(req interfaces.CreatePRRequest) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data.PullRequests = append(p.data.PullRequests, PullRequest{
+		Title: req.Title,
+		Body:  req.Body,
+		Head:  req.Head,
+		Base:  req.Base,
+		Draft: req.Draft,
+	})
+	return len(p.data.PullRequests)
+}
+
+// addUpdate records the update of an existing pull request
+func (p *Plan) addUpdate(pr int, title, body string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data.PullRequests = append(p.data.PullRequests, PullRequest{
+		Updates: pr,
+		Title:   title,
+		Body:    body,
+	})
+}
+
+// addReviewers adds reviewers to an updated PR, or to a new one by its place
+func (p *Plan) addReviewers(pr int, reviewers []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.data.PullRequests {
+		if p.data.PullRequests[i].Updates == pr {
+			p.data.PullRequests[i].Reviewers = append(p.data.PullRequests[i].Reviewers, reviewers...)
+			return
+		}
+	}
+	if pr < 1 || pr > len(p.data.PullRequests) {
+		return
+	}
+	p.data.PullRequests[pr-1].Reviewers = append(p.data.PullRequests[pr-1].Reviewers, reviewers...)
+}
+
+func (p *Plan) addMerge(pr int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data.Merges = append(p.data.Merges, pr)
+}
+
+func (p *Plan) addClose(pr int, comment string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data.Closes = append(p.data.Closes, Close{Number: pr, Comment: comment})
+}
+
+func (p *Plan) addNotification(message interfaces.NotificationMessage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data.Notifications = append(p.data.Notifications, Notification{
+		Title:          message.Title,
+		Message:        message.Message,
+		URL:            message.URL,
+		Level:          string(message.Level),
+		ActionRequired: message.ActionRequired,
+	})
+}
+
+// Write writes the plan to dir as <branch>.md and <branch>.json and returns
+// the path of the Markdown report
+func (p *Plan) Write(dir string) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+
+	p.mu.Lock()
+	data := p.data
+	p.mu.Unlock()
+
+	encoded, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode dry run plan: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+	name := data.Branch
+	if name == "" {
+		name = "plan"
+	}
+	base := filepath.Join(dir, name)
+	if err := os.WriteFile(base+".json", encoded, 0644); err != nil {
+		return "", fmt.Errorf("failed to write dry run plan: %w", err)
+	}
+	if err := os.WriteFile(base+".md", []byte(renderMarkdown(data)), 0644); err != nil {
+		return "", fmt.Errorf("failed to write dry run plan: %w", err)
+	}
+	return base + ".md", nil
+}
+
+func renderMarkdown(data planData) string {
+	var report strings.Builder
+	report.WriteString(fmt.Sprintf("# Dry Run Plan for `%s`\n\n", data.Branch))
+	report.WriteString("Nothing was pushed, no pull request was changed and no notification was sent. This is what the run would have done.\n")
+
+	report.WriteString("\n## Pushes\n\n")
+	if len(data.Pushes) == 0 {
+		report.WriteString("None.\n")
+	}
+	for _, branch := range data.Pushes {
+		report.WriteString(fmt.Sprintf("- `%s`\n", branch))
+	}
+
+	for _, pr := range data.PullRequests {
+		report.WriteString(fmt.Sprintf("\n## Pull Request: %s\n\n", pr.Title))
+		if pr.Updates > 0 {
+			report.WriteString(fmt.Sprintf("Update of PR #%d", pr.Updates))
+		} else {
+			kind := "PR"
+			if pr.Draft {
+				kind = "Draft PR"
+			}
+			report.WriteString(fmt.Sprintf("%s from `%s` into `%s`", kind, pr.Head, pr.Base))
+		}
+		if len(pr.Reviewers) > 0 {
+			report.WriteString(fmt.Sprintf(", reviewers: %s", strings.Join(pr.Reviewers, ", ")))
+		}
+		report.WriteString("\n\n")
+		report.WriteString(fence("markdown", pr.Body))
+	}
+
+	if len(data.Merges) > 0 {
+		report.WriteString("\n## Merges\n\n")
+		for _, pr := range data.Merges {
+			report.WriteString(fmt.Sprintf("- PR #%d\n", pr))
+		}
+	}
+
+	if len(data.Closes) > 0 {
+		report.WriteString("\n## Closed Pull Requests\n\n")
+		for _, pr := range data.Closes {
+			report.WriteString(fmt.Sprintf("- PR #%d", pr.Number))
+			if pr.Comment != "" {
+				report.WriteString(fmt.Sprintf(": %s", pr.Comment))
+			}
+			report.WriteString("\n")
+		}
+	}
+
+	if len(data.Resolutions) > 0 {
+		report.WriteString("\n## Proposed Resolutions\n\n")
+		report.WriteString("| File | Conflict | Action |\n")
+		report.WriteString("|------|----------|--------|\n")
+		for _, resolution := range data.Resolutions {
+			report.WriteString(fmt.Sprintf("| `%s` | %s | %s |\n", resolution.File, resolution.Type, resolution.Action))
+		}
+	}
+	for _, resolution := range data.Resolutions {
+		if resolution.Strategy == "" {
+			continue
+		}
+		report.WriteString(fmt.Sprintf("\n### `%s`\n\n", resolution.File))
+		report.WriteString(fmt.Sprintf("- **Strategy:** %s\n", resolution.Strategy))
+		report.WriteString(fmt.Sprintf("- **Confidence:** %.2f\n", resolution.Confidence))
+		if resolution.Rationale != "" {
+			report.WriteString(fmt.Sprintf("- **Rationale:** %s\n", resolution.Rationale))
+		}
+		for _, risk := range resolution.Risks {
+			report.WriteString(fmt.Sprintf("- **Risk:** %s\n", risk))
+		}
+	}
+
+	if len(data.Diffs) > 0 {
+		report.WriteString("\n## Diffs\n\nFrom upstream to the rebased branch, for the files with conflicts.\n")
+		for _, file := range diffOrder(data) {
+			report.WriteString(fmt.Sprintf("\n### `%s`\n\n", file))
+			report.WriteString(fence("diff", data.Diffs[file]))
+		}
+	}
+
+	report.WriteString("\n## Notifications\n\n")
+	if len(data.Notifications) == 0 {
+		report.WriteString("None.\n")
+	}
+	for _, notification := range data.Notifications {
+		report.WriteString(fmt.Sprintf("### %s (%s)\n\n", notification.Title, notification.Level))
+		report.WriteString(fence("", notification.Message))
+		if notification.URL != "" {
+			report.WriteString(fmt.Sprintf("Link: %s\n", notification.URL))
+		}
+		report.WriteString("\n")
+	}
+
+	return report.String()
+}
+
+// diffOrder returns the files with a diff in the order of their conflicts
+func diffOrder(data planData) []string {
+	var files []string
+	seen := map[string]bool{}
+	for _, resolution := range data.Resolutions {
+		if _, ok := data.Diffs[resolution.File]; ok && !seen[resolution.File] {
+			seen[resolution.File] = true
+			files = append(files, resolution.File)
+		}
+	}
+	return files
+}
+
+// fence wraps content in a code fence longer than any backtick run in it, so
+// PR bodies and diffs with fences of their own render as they are
+func fence(lang, content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	marker := strings.Repeat("`", max(3, longest+1))
+	return fmt.Sprintf("%s%s\n%s\n%s\n", marker, lang, strings.TrimSuffix(content, "\n"), marker)
+}
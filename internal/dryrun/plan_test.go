@@ -0,0 +1,135 @@
+package dryrun
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+	"github.com/BlindspotSoftware/rebAIser/internal/mocks"
+)
+
+func TestServices_RecordInsteadOfActing(t *testing.T) {
+	mockGit := &mocks.MockGitService{}
+	mockGitHub := &mocks.MockGitHubService{}
+	plan := NewPlan()
+	plan.Reset("ai-rebase-1")
+
+	git := NewGitService(mockGit, plan)
+	github := NewGitHubService(mockGitHub, plan)
+	notify := NewNotifyService(plan)
+	ctx := context.Background()
+
+	// Reading is passed through
+	mockGitHub.On("GetPullRequest", ctx, 7).Return(&interfaces.PullRequest{Number: 7, State: "open"}, nil)
+	existing, err := github.GetPullRequest(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, 7, existing.Number)
+
+	require.NoError(t, git.Push(ctx, "/tmp/internal", "ai-rebase-1"))
+	pr, err := github.CreatePullRequest(ctx, interfaces.CreatePRRequest{Title: "Rebase", Body: "Body", Head: "ai-rebase-1", Base: "main", Draft: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, pr.Number)
+	assert.True(t, pr.Draft)
+	require.NoError(t, github.AddReviewers(ctx, pr.Number, []string{"core-team"}))
+	require.NoError(t, github.MergePullRequest(ctx, 7, "rebase"))
+	require.NoError(t, git.ForcePush(ctx, "/tmp/internal", "ai-rebase-1", "ai-rebase-0", "sha0"))
+	updated, err := github.UpdatePullRequest(ctx, 7, "Rebase again", "New body")
+	require.NoError(t, err)
+	assert.Equal(t, 7, updated.Number)
+	assert.Equal(t, "New body", updated.Body)
+	require.NoError(t, github.AddReviewers(ctx, 7, []string{"owners"}))
+	require.NoError(t, github.ClosePullRequest(ctx, 6, "Superseded by #7"))
+	require.NoError(t, notify.SendMessage(ctx, interfaces.NotificationMessage{Title: "Done", Message: "PR #1", Level: interfaces.NotificationLevelSuccess}))
+
+	mockGit.AssertNotCalled(t, "Push", mock.Anything, mock.Anything, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "CreatePullRequest", mock.Anything, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "AddReviewers", mock.Anything, mock.Anything, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "MergePullRequest", mock.Anything, mock.Anything, mock.Anything)
+	mockGit.AssertNotCalled(t, "ForcePush", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "UpdatePullRequest", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockGitHub.AssertNotCalled(t, "ClosePullRequest", mock.Anything, mock.Anything, mock.Anything)
+
+	assert.Equal(t, []string{"ai-rebase-1", "ai-rebase-1 to ai-rebase-0 (force)"}, plan.data.Pushes)
+	require.Len(t, plan.data.PullRequests, 2)
+	assert.Equal(t, []string{"core-team"}, plan.data.PullRequests[0].Reviewers)
+	assert.Equal(t, 7, plan.data.PullRequests[1].Updates)
+	assert.Equal(t, []string{"owners"}, plan.data.PullRequests[1].Reviewers)
+	assert.Equal(t, []int{7}, plan.data.Merges)
+	assert.Equal(t, []Close{{Number: 6, Comment: "Superseded by #7"}}, plan.data.Closes)
+	require.Len(t, plan.data.Notifications, 1)
+	assert.Equal(t, "success", plan.data.Notifications[0].Level)
+}
+
+func TestPlan_Write(t *testing.T) {
+	plan := NewPlan()
+	plan.Reset("ai-rebase-1")
+	plan.addPush("ai-rebase-1")
+	plan.addPullRequest(interfaces.CreatePRRequest{
+		Title: "AI-assisted rebase",
+		Body:  "## Conflict Resolutions\n\n```go\nfunc a() {}\n```\n",
+		Head:  "ai-rebase-1",
+		Base:  "main",
+	})
+	plan.addClose(6, "Superseded by #1")
+	plan.SetResolutions([]interfaces.GitConflict{
+		{
+			File:   "src/a.c",
+			Action: "merged with AI",
+			Resolution: &interfaces.ConflictResolution{
+				Confidence: 0.8,
+				Strategy:   interfaces.StrategyCombined,
+				Rationale:  "Kept both",
+			},
+		},
+		{File: "src/b.c", Type: interfaces.ConflictDeletedByUs, Action: "kept the internal version"},
+		{File: "src/c.c", Action: "left conflict markers for a human", Unresolved: true},
+	}, map[string]string{
+		"src/a.c": "--- a/src/a.c\n+++ b/src/a.c\n-old\n+new\n",
+	})
+
+	dir := filepath.Join(t.TempDir(), "reports")
+	path, err := plan.Write(dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "ai-rebase-1.md"), path)
+
+	report, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "# Dry Run Plan for `ai-rebase-1`")
+	assert.Contains(t, string(report), "- `ai-rebase-1`")
+	assert.Contains(t, string(report), "PR from `ai-rebase-1` into `main`")
+	// The PR body has a fence of its own, so it is wrapped in a longer one
+	assert.Contains(t, string(report), "````markdown\n## Conflict Resolutions")
+	assert.Contains(t, string(report), "| `src/b.c` | deleted-by-us | kept the internal version |")
+	assert.Contains(t, string(report), "- **Strategy:** combined")
+	assert.Contains(t, string(report), "```diff\n--- a/src/a.c\n+++ b/src/a.c\n-old\n+new\n```")
+	assert.Contains(t, string(report), "## Notifications\n\nNone.")
+	assert.Contains(t, string(report), "## Closed Pull Requests\n\n- PR #6: Superseded by #1")
+
+	encoded, err := os.ReadFile(filepath.Join(dir, "ai-rebase-1.json"))
+	require.NoError(t, err)
+	var data planData
+	require.NoError(t, json.Unmarshal(encoded, &data))
+	assert.Equal(t, "ai-rebase-1", data.Branch)
+	require.Len(t, data.Resolutions, 3)
+	assert.Equal(t, "both-modified", data.Resolutions[0].Type)
+	assert.Equal(t, 0.8, data.Resolutions[0].Confidence)
+	assert.True(t, data.Resolutions[2].Unresolved)
+	assert.Equal(t, plan.data.Diffs, data.Diffs)
+}
+
+func TestPlan_Nil(t *testing.T) {
+	var plan *Plan
+	plan.Reset("ai-rebase-1")
+	plan.SetResolutions([]interfaces.GitConflict{{File: "a.c"}}, nil)
+
+	path, err := plan.Write(t.TempDir())
+	require.NoError(t, err)
+	assert.Empty(t, path)
+}
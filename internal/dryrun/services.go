@@ -0,0 +1,113 @@
+package dryrun
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+var log = logrus.WithField("component", "dry-run")
+
+type gitService struct {
+	interfaces.GitService
+	plan *Plan
+}
+
+// NewGitService returns git that records pushes and force pushes in the plan
+// instead of pushing. Everything else only touches the working directory and is passed
+// through.
+func NewGitService(git interfaces.GitService, plan *Plan) interfaces.GitService {
+	return &gitService{GitService: git, plan: plan}
+}
+
+func (s *gitService) Push(ctx context.Context, dir, branch string) error {
+	log.WithField("branch", branch).Info("Dry run, not pushing branch")
+	s.plan.addPush(branch)
+	return nil
+}
+
+func (s *gitService) ForcePush(ctx context.Context, dir, localBranch, remoteBranch, expectedSHA string) error {
+	log.WithField("branch", remoteBranch).Info("Dry run, not force pushing branch")
+	s.plan.addPush(fmt.Sprintf("%s to %s (force)", localBranch, remoteBranch))
+	return nil
+}
+
+type gitHubService struct {
+	interfaces.GitHubService
+	plan *Plan
+}
+
+// NewGitHubService returns github that records pull requests, reviewers,
+// merges and closes in the plan instead of sending them. Pull requests are read from
+// GitHub as usual.
+func NewGitHubService(github interfaces.GitHubService, plan *Plan) interfaces.GitHubService {
+	return &gitHubService{GitHubService: github, plan: plan}
+}
+
+// CreatePullRequest returns the PR that would have been created. Its number
+// is its place in the plan, not a number on GitHub.
+func (s *gitHubService) CreatePullRequest(ctx context.Context, req interfaces.CreatePRRequest) (*interfaces.PullRequest, error) {
+	log.WithField("title", req.Title).Info("Dry run, not creating pull request")
+	number := s.plan.addPullRequest(req)
+	return &interfaces.PullRequest{
+		Number: number,
+		Title:  req.Title,
+		Body:   req.Body,
+		State:  "open",
+		Head:   req.Head,
+		Base:   req.Base,
+		Draft:  req.Draft,
+	}, nil
+}
+
+func (s *gitHubService) AddReviewers(ctx context.Context, prNumber int, reviewers []string) error {
+	log.WithField("reviewers", reviewers).Info("Dry run, not adding reviewers")
+	s.plan.addReviewers(prNumber, reviewers)
+	return nil
+}
+
+// UpdatePullRequest returns the PR as it would have been updated
+func (s *gitHubService) UpdatePullRequest(ctx context.Context, prNumber int, title, body string) (*interfaces.PullRequest, error) {
+	log.WithField("pr_number", prNumber).Info("Dry run, not updating pull request")
+	existing, err := s.GitHubService.GetPullRequest(ctx, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	s.plan.addUpdate(prNumber, title, body)
+
+	updated := *existing
+	updated.Title = title
+	updated.Body = body
+	return &updated, nil
+}
+
+func (s *gitHubService) ClosePullRequest(ctx context.Context, prNumber int, comment string) error {
+	log.WithField("pr_number", prNumber).Info("Dry run, not closing pull request")
+	s.plan.addClose(prNumber, comment)
+	return nil
+}
+
+func (s *gitHubService) MergePullRequest(ctx context.Context, prNumber int, method string) error {
+	log.WithField("pr_number", prNumber).Info("Dry run, not merging pull request")
+	s.plan.addMerge(prNumber)
+	return nil
+}
+
+type notifyService struct {
+	plan *Plan
+}
+
+// NewNotifyService returns a notifier that records messages in the plan
+// instead of sending them
+func NewNotifyService(plan *Plan) interfaces.NotifyService {
+	return &notifyService{plan: plan}
+}
+
+func (s *notifyService) SendMessage(ctx context.Context, message interfaces.NotificationMessage) error {
+	log.WithField("title", message.Title).Info("Dry run, not sending notification")
+	s.plan.addNotification(message)
+	return nil
+}
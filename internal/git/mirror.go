@@ -0,0 +1,192 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// lockPollInterval is how often a run waiting for the mirror lock retries
+const lockPollInterval = time.Second
+
+// UpdateMirror creates the bare mirror of repo at dir or fetches what changed
+// since the last run. The branches of repo are mirrored as they are, those of
+// the other remotes under refs/remotes/<name>. Runs sharing the mirror update
+// it one at a time. A mirror that git can no longer read is cloned again.
+func (s *Service) UpdateMirror(ctx context.Context, dir, repo string, remotes map[string]string) error {
+	log := s.log.WithField("mirror", dir)
+
+	unlock, err := s.lockMirror(ctx, dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if s.isBareRepository(ctx, dir) {
+		log.Info("Updating mirror cache")
+		err := s.fetchMirror(ctx, dir, repo, remotes)
+		if err == nil {
+			return nil
+		}
+		// A failed fetch is most likely the network, only a mirror that is
+		// broken itself is worth the full clone
+		if s.isConnected(ctx, dir) {
+			return err
+		}
+		log.WithError(err).Warn("Mirror cache is corrupt, cloning it again")
+	} else if _, err := os.Stat(dir); err == nil {
+		log.Warn("Mirror cache is not a git repository, cloning it again")
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove mirror cache: %w", err)
+	}
+	return s.createMirror(ctx, dir, repo, remotes)
+}
+
+// createMirror clones a new mirror next to dir and moves it in place once it
+// is complete, so an interrupted clone never leaves a partial mirror behind
+func (s *Service) createMirror(ctx context.Context, dir, repo string, remotes map[string]string) error {
+	s.log.WithFields(logrus.Fields{
+		"repo":   repo,
+		"mirror": dir,
+	}).Info("Creating mirror cache")
+
+	tmp := dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return fmt.Errorf("failed to remove partial mirror cache: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "clone", "--bare", repo, tmp)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("failed to clone mirror cache: %w\nOutput: %s", err, string(output))
+	}
+	if err := s.fetchMirror(ctx, tmp, repo, remotes); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, dir); err != nil {
+		return fmt.Errorf("failed to move mirror cache in place: %w", err)
+	}
+	return nil
+}
+
+// fetchMirror points the remotes of the mirror at their current URLs and
+// fetches all of them. Branches deleted in a remote are deleted in the mirror.
+func (s *Service) fetchMirror(ctx context.Context, dir, repo string, remotes map[string]string) error {
+	if err := s.SetConfig(ctx, dir, "remote.origin.url", repo); err != nil {
+		return err
+	}
+	if err := s.SetConfig(ctx, dir, "remote.origin.fetch", "+refs/heads/*:refs/heads/*"); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.SetConfig(ctx, dir, fmt.Sprintf("remote.%s.url", name), remotes[name]); err != nil {
+			return err
+		}
+		refspec := fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", name)
+		if err := s.SetConfig(ctx, dir, fmt.Sprintf("remote.%s.fetch", name), refspec); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "fetch", "--all", "--prune")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to update mirror cache: %w\nOutput: %s", err, string(output))
+	}
+	return nil
+}
+
+// isBareRepository reports if dir is a bare repository git can open
+func (s *Service) isBareRepository(ctx context.Context, dir string) bool {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--is-bare-repository")
+	output, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// isConnected reports if all objects reachable from the refs of dir exist
+func (s *Service) isConnected(ctx context.Context, dir string) bool {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "fsck", "--connectivity-only", "--no-progress")
+	return cmd.Run() == nil
+}
+
+// lockMirror takes the lock of the mirror at dir, waiting for other runs that
+// hold it. The lock is released by the kernel if a run dies, so it never goes
+// stale.
+func (s *Service) lockMirror(ctx context.Context, dir string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	file, err := os.OpenFile(dir+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mirror lock: %w", err)
+	}
+
+	waiting := false
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock mirror cache: %w", err)
+		}
+
+		if !waiting {
+			s.log.WithField("mirror", dir).Info("Waiting for another run to update the mirror cache")
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// CloneShared clones the mirror at mirror into dir, borrowing its objects
+// instead of copying them. origin is pointed at repo so pushes go to the real
+// repository, and the remote branches of the mirror are copied so later
+// fetches only transfer what is new.
+func (s *Service) CloneShared(ctx context.Context, mirror, repo, dir string) error {
+	s.log.WithFields(logrus.Fields{
+		"mirror": mirror,
+		"dir":    dir,
+	}).Info("Cloning from mirror cache")
+
+	cmd := exec.CommandContext(ctx, "git", "clone", "--shared", mirror, dir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clone mirror cache: %w\nOutput: %s", err, string(output))
+	}
+
+	cmd = exec.CommandContext(ctx, "git", "-C", dir, "fetch", "--no-tags", mirror, "+refs/remotes/*:refs/remotes/*")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy remote branches from mirror cache: %w\nOutput: %s", err, string(output))
+	}
+
+	return s.SetConfig(ctx, dir, "remote.origin.url", repo)
+}
@@ -0,0 +1,104 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRemote creates a bare repository and a working repository whose origin
+// it is. The working repository has one commit, pushed to main.
+func newRemote(t *testing.T) (remote, work string) {
+	t.Helper()
+	work = newRepo(t)
+	remote = filepath.Join(t.TempDir(), "remote.git")
+	runGit(t, work, "init", "-q", "--bare", "-b", "main", remote)
+	runGit(t, work, "remote", "add", "origin", remote)
+	commitFiles(t, work, "Base", map[string]string{"a.c": "one\n"})
+	runGit(t, work, "push", "-q", "origin", "main")
+	return remote, work
+}
+
+func TestUpdateMirror(t *testing.T) {
+	origin, originWork := newRemote(t)
+	upstream, upstreamWork := newRemote(t)
+	runGit(t, originWork, "push", "-q", "origin", "main:stale")
+	mirror := filepath.Join(t.TempDir(), "mirror.git")
+	remotes := map[string]string{"upstream": upstream}
+	service := NewService()
+	ctx := context.Background()
+
+	require.NoError(t, service.UpdateMirror(ctx, mirror, origin, remotes))
+	assert.Equal(t, runGit(t, originWork, "rev-parse", "HEAD"), runGit(t, mirror, "rev-parse", "refs/heads/main"))
+	assert.Equal(t, runGit(t, upstreamWork, "rev-parse", "HEAD"), runGit(t, mirror, "rev-parse", "refs/remotes/upstream/main"))
+	assert.NoDirExists(t, mirror+".tmp")
+
+	// A refresh fetches new commits and drops deleted branches
+	originHead := commitFiles(t, originWork, "Internal", map[string]string{"a.c": "two\n"})
+	runGit(t, originWork, "push", "-q", "origin", "main", ":stale")
+	upstreamHead := commitFiles(t, upstreamWork, "Upstream", map[string]string{"b.c": "two\n"})
+	runGit(t, upstreamWork, "push", "-q", "origin", "main")
+
+	require.NoError(t, service.UpdateMirror(ctx, mirror, origin, remotes))
+	assert.Equal(t, originHead, runGit(t, mirror, "rev-parse", "refs/heads/main"))
+	assert.Equal(t, upstreamHead, runGit(t, mirror, "rev-parse", "refs/remotes/upstream/main"))
+	assert.Empty(t, runGit(t, mirror, "for-each-ref", "refs/heads/stale"))
+}
+
+func TestUpdateMirror_ReplacesBrokenMirror(t *testing.T) {
+	origin, originWork := newRemote(t)
+	mirror := filepath.Join(t.TempDir(), "mirror.git")
+	require.NoError(t, os.MkdirAll(mirror, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(mirror, "HEAD"), []byte("garbage"), 0644))
+
+	require.NoError(t, NewService().UpdateMirror(context.Background(), mirror, origin, nil))
+	assert.Equal(t, runGit(t, originWork, "rev-parse", "HEAD"), runGit(t, mirror, "rev-parse", "refs/heads/main"))
+}
+
+func TestCloneShared(t *testing.T) {
+	origin, originWork := newRemote(t)
+	upstream, upstreamWork := newRemote(t)
+	mirror := filepath.Join(t.TempDir(), "mirror.git")
+	dir := filepath.Join(t.TempDir(), "clone")
+	service := NewService()
+	ctx := context.Background()
+	require.NoError(t, service.UpdateMirror(ctx, mirror, origin, map[string]string{"upstream": upstream}))
+
+	require.NoError(t, service.CloneShared(ctx, mirror, origin, dir))
+	assert.Equal(t, origin, runGit(t, dir, "config", "remote.origin.url"))
+	assert.Equal(t, runGit(t, originWork, "rev-parse", "HEAD"), runGit(t, dir, "rev-parse", "HEAD"))
+	assert.Equal(t, runGit(t, upstreamWork, "rev-parse", "HEAD"), runGit(t, dir, "rev-parse", "refs/remotes/upstream/main"))
+
+	// The objects are borrowed from the mirror instead of copied
+	alternates, err := os.ReadFile(filepath.Join(dir, ".git", "objects", "info", "alternates"))
+	require.NoError(t, err)
+	assert.Contains(t, string(alternates), mirror)
+}
+
+func TestForcePush(t *testing.T) {
+	remote, work := newRemote(t)
+	pushed := runGit(t, work, "rev-parse", "HEAD")
+	runGit(t, work, "push", "-q", "origin", "main:rebase")
+
+	// Someone else pushes to the branch after it was at pushed
+	other := filepath.Join(t.TempDir(), "other")
+	runGit(t, work, "clone", "-q", "-b", "rebase", remote, other)
+	theirs := commitFiles(t, other, "Fix conflict", map[string]string{"a.c": "fixed\n"})
+	runGit(t, other, "push", "-q", "origin", "rebase")
+
+	runGit(t, work, "checkout", "-q", "-b", "rebased")
+	ours := commitFiles(t, work, "Rebased", map[string]string{"a.c": "rebased\n"})
+	service := NewService()
+	ctx := context.Background()
+
+	err := service.ForcePush(ctx, work, "rebased", "rebase", pushed)
+	assert.Error(t, err)
+	assert.Equal(t, theirs, runGit(t, remote, "rev-parse", "refs/heads/rebase"))
+
+	require.NoError(t, service.ForcePush(ctx, work, "rebased", "rebase", theirs))
+	assert.Equal(t, ours, runGit(t, remote, "rev-parse", "refs/heads/rebase"))
+}
@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/BlindspotSoftware/rebAIser/internal/markers"
 	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
 )
 
@@ -53,6 +56,11 @@ func (s *Service) Rebase(ctx context.Context, dir, branch string) error {
 		"branch": branch,
 	}).Info("Starting rebase")
 
+	// Replaying patches creates commits, so the committer must be known
+	if err := s.configureGitUser(ctx, dir); err != nil {
+		return fmt.Errorf("failed to configure git user: %w", err)
+	}
+
 	cmd := exec.CommandContext(ctx, "git", "-C", dir, "rebase", branch)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		// Check if it's a conflict (expected) or actual error
@@ -65,76 +73,543 @@ func (s *Service) Rebase(ctx context.Context, dir, branch string) error {
 	return nil
 }
 
+// ContinueRebase commits the staged resolution of the current stop and replays
+// the remaining patches. The original commit message of the patch is kept.
+func (s *Service) ContinueRebase(ctx context.Context, dir string) error {
+	s.log.WithField("dir", dir).Info("Continuing rebase")
+
+	if err := s.configureGitUser(ctx, dir); err != nil {
+		return fmt.Errorf("failed to configure git user: %w", err)
+	}
+
+	return s.runRebaseStep(ctx, dir, "--continue")
+}
+
+// AbortRebase stops an in-progress rebase and restores the original branch
+func (s *Service) AbortRebase(ctx context.Context, dir string) error {
+	s.log.WithField("dir", dir).Info("Aborting rebase")
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "rebase", "--abort")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to abort rebase: %w\nOutput: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// SkipCommit drops the patch the rebase stopped on and replays the remaining ones
+func (s *Service) SkipCommit(ctx context.Context, dir string) error {
+	s.log.WithField("dir", dir).Info("Skipping current rebase patch")
+
+	return s.runRebaseStep(ctx, dir, "--skip")
+}
+
+// RebaseInProgress reports whether the repository is stopped in the middle of a rebase
+func (s *Service) RebaseInProgress(ctx context.Context, dir string) (bool, error) {
+	for _, stateDir := range []string{"rebase-merge", "rebase-apply"} {
+		path, err := s.gitPath(ctx, dir, stateDir)
+		if err != nil {
+			return false, err
+		}
+		if _, err := os.Stat(path); err == nil {
+			return true, nil
+		} else if !os.IsNotExist(err) {
+			return false, fmt.Errorf("failed to check rebase state: %w", err)
+		}
+	}
+
+	return false, nil
+}
+
+// runRebaseStep runs a non-interactive "git rebase <flag>" and reports the next
+// stop as a conflict error so callers can keep driving the rebase.
+func (s *Service) runRebaseStep(ctx context.Context, dir, flag string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "rebase", flag)
+	// Never open an editor for the commit message of the replayed patch
+	cmd.Env = append(os.Environ(), "GIT_EDITOR=true")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if strings.Contains(string(output), "CONFLICT") || strings.Contains(string(output), "could not apply") {
+			return fmt.Errorf("rebase conflicts detected: %w\nOutput: %s", err, string(output))
+		}
+		return fmt.Errorf("failed to run rebase %s: %w\nOutput: %s", flag, err, string(output))
+	}
+
+	return nil
+}
+
+// gitPath resolves a path inside the repository's git directory
+func (s *Service) gitPath(ctx context.Context, dir, name string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--git-path", name)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve git path %s: %w", name, err)
+	}
+
+	path := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return path, nil
+}
+
 func (s *Service) GetConflicts(ctx context.Context, dir string) ([]interfaces.GitConflict, error) {
 	s.log.WithField("dir", dir).Info("Getting conflicts")
 
-	cmd := exec.CommandContext(ctx, "git", "-C", dir, "diff", "--name-only", "--diff-filter=U")
-	output, err := cmd.Output()
+	entries, err := s.unmergedEntries(ctx, dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get conflict files: %w", err)
+		return nil, err
+	}
+
+	// The patch being replayed is the same for every file of this stop
+	stopped, onto, err := s.rebaseStop(ctx, dir)
+	if err != nil {
+		s.log.WithError(err).Debug("No rebase stop information available")
 	}
 
-	files := strings.Split(strings.TrimSpace(string(output)), "\n")
-	conflicts := make([]interfaces.GitConflict, 0, len(files))
+	conflicts := make([]interfaces.GitConflict, 0, len(entries))
+	var renameParts []unmergedEntry
+
+	for _, entry := range entries {
+		var conflict interfaces.GitConflict
+		var err error
 
-	for _, file := range files {
-		if file == "" {
+		switch entry.code {
+		case "UU":
+			conflict, err = s.getConflictContent(ctx, dir, entry.path)
+			conflict.Type = interfaces.ConflictBothModified
+		case "AA":
+			conflict, err = s.getConflictContent(ctx, dir, entry.path)
+			conflict.Type = interfaces.ConflictAddedByBoth
+		case "DU":
+			conflict, err = s.getDeletedConflict(ctx, dir, entry.path, interfaces.ConflictDeletedByUs)
+		case "UD":
+			conflict, err = s.getDeletedConflict(ctx, dir, entry.path, interfaces.ConflictDeletedByThem)
+		default:
+			// AU, UA and DD are the parts of a rename/rename conflict
+			renameParts = append(renameParts, entry)
 			continue
 		}
 
-		conflict, err := s.getConflictContent(dir, file)
+		// An unreadable conflict must not be dropped, the rebase would
+		// otherwise continue with unresolved paths in the index
 		if err != nil {
-			s.log.WithError(err).WithField("file", file).Warn("Failed to get conflict content")
-			continue
+			return nil, fmt.Errorf("failed to get conflict for %s: %w", entry.path, err)
 		}
-
 		conflicts = append(conflicts, conflict)
 	}
 
+	if err := s.markReplayed(ctx, dir, conflicts); err != nil {
+		return nil, err
+	}
+
+	if len(renameParts) > 0 {
+		renamed, err := s.getRenameConflicts(ctx, dir, stopped, renameParts)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, renamed...)
+	}
+
+	if stopped != "" {
+		for i := range conflicts {
+			s.addCommitContext(ctx, dir, stopped, onto, &conflicts[i])
+		}
+	}
+
 	return conflicts, nil
 }
 
-func (s *Service) getConflictContent(dir, file string) (interfaces.GitConflict, error) {
-	filePath := fmt.Sprintf("%s/%s", dir, file)
-	content, err := os.ReadFile(filePath)
+// unmergedEntry is an unmerged path with its two letter status, e.g. UU or DU
+type unmergedEntry struct {
+	code string
+	path string
+}
+
+// unmergedEntries lists the unmerged paths of the index from the stage
+// information of git status
+func (s *Service) unmergedEntries(ctx context.Context, dir string) ([]unmergedEntry, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain=v2", "-z", "--untracked-files=no")
+	output, err := cmd.Output()
 	if err != nil {
-		return interfaces.GitConflict{}, fmt.Errorf("failed to read conflict file: %w", err)
+		return nil, fmt.Errorf("failed to get conflict files: %w", err)
 	}
 
-	lines := strings.Split(string(content), "\n")
-	var ours, theirs []string
-	var inOurs, inTheirs bool
+	var entries []unmergedEntry
+	records := strings.Split(string(output), "\x00")
+	for i := 0; i < len(records); i++ {
+		switch {
+		case strings.HasPrefix(records[i], "2 "):
+			// Rename and copy records are followed by the original path
+			i++
+		case strings.HasPrefix(records[i], "u "):
+			// Format: u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+			fields := strings.SplitN(records[i], " ", 11)
+			if len(fields) == 11 {
+				entries = append(entries, unmergedEntry{code: fields[1], path: fields[10]})
+			}
+		}
+	}
 
-	for _, line := range lines {
-		if strings.HasPrefix(line, "<<<<<<< ") {
-			inOurs = true
-			continue
+	return entries, nil
+}
+
+// getDeletedConflict reads the surviving side of a modify/delete conflict
+func (s *Service) getDeletedConflict(ctx context.Context, dir, file string, conflictType interfaces.ConflictType) (interfaces.GitConflict, error) {
+	conflict := interfaces.GitConflict{File: file, Type: conflictType}
+
+	if conflictType == interfaces.ConflictDeletedByUs {
+		content, err := s.stageContent(ctx, dir, 3, file)
+		if err != nil {
+			return interfaces.GitConflict{}, err
 		}
-		if strings.HasPrefix(line, "======= ") {
-			inOurs = false
-			inTheirs = true
-			continue
+		conflict.Content = content
+		conflict.Theirs = content
+	} else {
+		content, err := s.stageContent(ctx, dir, 2, file)
+		if err != nil {
+			return interfaces.GitConflict{}, err
 		}
-		if strings.HasPrefix(line, ">>>>>>> ") {
-			inTheirs = false
-			continue
+		conflict.Content = content
+		conflict.Ours = content
+	}
+	conflict.Binary = s.isBinary(ctx, dir, file, conflict.Content)
+
+	return conflict, nil
+}
+
+// getRenameConflicts pairs the parts of rename/rename conflicts: the original
+// path (DD), the upstream target (AU) and the target of the internal patch
+// (UA). The pairs are found with the same rename detection the merge used.
+func (s *Service) getRenameConflicts(ctx context.Context, dir, stopped string, parts []unmergedEntry) ([]interfaces.GitConflict, error) {
+	var bases, upstreamTargets, internalTargets []string
+	for _, part := range parts {
+		switch part.code {
+		case "DD":
+			bases = append(bases, part.path)
+		case "AU":
+			upstreamTargets = append(upstreamTargets, part.path)
+		case "UA":
+			internalTargets = append(internalTargets, part.path)
+		default:
+			return nil, fmt.Errorf("unknown conflict state %s for %s", part.code, part.path)
+		}
+	}
+
+	upstreamRenames := map[string]string{}
+	internalRenames := map[string]string{}
+	if stopped != "" {
+		upstreamRenames = s.renames(ctx, dir, stopped+"^", "HEAD")
+		internalRenames = s.renames(ctx, dir, stopped+"^", stopped)
+	}
+
+	var conflicts []interfaces.GitConflict
+	for _, base := range bases {
+		conflicts = append(conflicts, interfaces.GitConflict{
+			Type:        interfaces.ConflictRenamed,
+			RenamedFrom: base,
+			File:        takePath(&upstreamTargets, upstreamRenames[base]),
+			RenamedTo:   takePath(&internalTargets, internalRenames[base]),
+		})
+	}
+	// Targets without a known origin still need to be resolved
+	for _, target := range upstreamTargets {
+		conflicts = append(conflicts, interfaces.GitConflict{Type: interfaces.ConflictRenamed, File: target})
+	}
+	for _, target := range internalTargets {
+		conflicts = append(conflicts, interfaces.GitConflict{Type: interfaces.ConflictRenamed, RenamedTo: target})
+	}
+
+	for i := range conflicts {
+		if err := s.getRenamedContent(ctx, dir, &conflicts[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return conflicts, nil
+}
+
+// takePath removes want from paths and returns it. If want is unknown and
+// only a single path is left, that path is taken instead.
+func takePath(paths *[]string, want string) string {
+	for i, path := range *paths {
+		if path == want {
+			*paths = append((*paths)[:i], (*paths)[i+1:]...)
+			return path
+		}
+	}
+	if len(*paths) == 1 {
+		path := (*paths)[0]
+		*paths = nil
+		return path
+	}
+	return ""
+}
+
+// renames returns the renames between two revisions as a map from the old to
+// the new path
+func (s *Service) renames(ctx context.Context, dir, from, to string) map[string]string {
+	renames := map[string]string{}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "diff", "--name-status", "-z", "-M", "--diff-filter=R", from, to)
+	output, err := cmd.Output()
+	if err != nil {
+		s.log.WithError(err).Debug("Failed to detect renames")
+		return renames
+	}
+
+	// Format: R<score> NUL <old> NUL <new> NUL
+	records := strings.Split(string(output), "\x00")
+	for i := 0; i+2 < len(records); i += 3 {
+		renames[records[i+1]] = records[i+2]
+	}
+	return renames
+}
+
+// getRenamedContent reads the content of a file renamed by both sides. Git
+// already merges both versions and records the result, conflict markers
+// included, as the upstream and the internal stage.
+func (s *Service) getRenamedContent(ctx context.Context, dir string, conflict *interfaces.GitConflict) error {
+	stage, path := 2, conflict.File
+	switch {
+	case conflict.File == "" && conflict.RenamedTo == "":
+		// Both sides moved the file somewhere we could not find, so
+		// only the original path is left to remove
+		conflict.File = conflict.RenamedFrom
+		return nil
+	case conflict.File == "":
+		// Only the internal target exists, keep it where it is
+		conflict.File = conflict.RenamedTo
+		stage, path = 3, conflict.RenamedTo
+	}
+
+	content, err := s.stageContent(ctx, dir, stage, path)
+	if err != nil {
+		return err
+	}
+	conflict.Content = content
+
+	// Markers of rename conflicts are one character longer than usual
+	size := s.markerSize(ctx, dir, conflict.File)
+	hunks, err := markers.Parse(content, size, conflictContextLines)
+	if err == nil && len(hunks) == 0 {
+		size++
+		hunks, err = markers.Parse(content, size, conflictContextLines)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse conflict markers of %s: %w", conflict.File, err)
+	}
+
+	conflict.Hunks = hunks
+	conflict.MarkerSize = size
+	conflict.Ours, conflict.Theirs = markers.JoinSides(hunks)
+	return nil
+}
+
+// stageContent returns the content of file at an index stage: 1 is the merge
+// base, 2 is upstream (ours) and 3 is the internal patch (theirs)
+func (s *Service) stageContent(ctx context.Context, dir string, stage int, file string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "show", fmt.Sprintf(":%d:%s", stage, file))
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read stage %d of %s: %w", stage, file, err)
+	}
+
+	return string(output), nil
+}
+
+// maxUpstreamCommits limits how many upstream commits are listed per conflict
+const maxUpstreamCommits = 20
+
+// rebaseStop returns the SHA of the patch the rebase stopped on and the commit
+// the patches are being replayed onto
+func (s *Service) rebaseStop(ctx context.Context, dir string) (stopped, onto string, err error) {
+	stopped, err = s.revParse(ctx, dir, "REBASE_HEAD")
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, stateDir := range []string{"rebase-merge", "rebase-apply"} {
+		path, err := s.gitPath(ctx, dir, stateDir+"/onto")
+		if err != nil {
+			return "", "", err
+		}
+		if data, err := os.ReadFile(path); err == nil {
+			return stopped, strings.TrimSpace(string(data)), nil
 		}
+	}
+
+	return stopped, "", nil
+}
+
+// addCommitContext fills in the replayed patch and the upstream commits that
+// touched the conflicting file since the patch's merge base
+func (s *Service) addCommitContext(ctx context.Context, dir, stopped, onto string, conflict *interfaces.GitConflict) {
+	log := s.log.WithField("file", conflict.File)
+
+	commit, err := s.getCommitInfo(ctx, dir, stopped)
+	if err != nil {
+		log.WithError(err).Warn("Failed to get replayed commit information")
+		return
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "show", "--format=", "--patch", stopped, "--", conflict.File)
+	if output, err := cmd.Output(); err == nil {
+		commit.Diff = strings.TrimSpace(string(output))
+	}
+	conflict.Commit = commit
+
+	if onto == "" {
+		return
+	}
 
-		if inOurs {
-			ours = append(ours, line)
-		} else if inTheirs {
-			theirs = append(theirs, line)
+	mergeBase, err := s.mergeBase(ctx, dir, stopped, onto)
+	if err != nil {
+		log.WithError(err).Warn("Failed to find merge base of replayed commit")
+		return
+	}
+
+	cmd = exec.CommandContext(ctx, "git", "-C", dir, "log", fmt.Sprintf("-n%d", maxUpstreamCommits),
+		"--format=%H%x1f%an <%ae>%x1f%s", fmt.Sprintf("%s..%s", mergeBase, onto), "--", conflict.File)
+	output, err := cmd.Output()
+	if err != nil {
+		log.WithError(err).Warn("Failed to list upstream commits")
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.SplitN(line, "\x1f", 3)
+		if len(fields) != 3 {
+			continue
 		}
+		conflict.UpstreamCommits = append(conflict.UpstreamCommits, interfaces.CommitInfo{
+			SHA:     fields[0],
+			Author:  fields[1],
+			Subject: fields[2],
+		})
+	}
+}
+
+// getCommitInfo reads the metadata of a single commit
+func (s *Service) getCommitInfo(ctx context.Context, dir, rev string) (interfaces.CommitInfo, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "show", "-s", "--format=%H%x1f%an <%ae>%x1f%s%x1f%b", rev)
+	output, err := cmd.Output()
+	if err != nil {
+		return interfaces.CommitInfo{}, fmt.Errorf("failed to read commit %s: %w", rev, err)
+	}
+
+	fields := strings.SplitN(string(output), "\x1f", 4)
+	if len(fields) != 4 {
+		return interfaces.CommitInfo{}, fmt.Errorf("unexpected commit format for %s", rev)
+	}
+
+	return interfaces.CommitInfo{
+		SHA:     fields[0],
+		Author:  fields[1],
+		Subject: fields[2],
+		Body:    strings.TrimSpace(fields[3]),
+	}, nil
+}
+
+// revParse resolves a revision to its full SHA
+func (s *Service) revParse(ctx context.Context, dir, rev string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--verify", "--quiet", rev)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// mergeBase returns the best common ancestor of two commits
+func (s *Service) mergeBase(ctx context.Context, dir, a, b string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "merge-base", a, b)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find merge base of %s and %s: %w", a, b, err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// conflictContextLines bounds the unconflicted context kept around each hunk
+const conflictContextLines = 20
+
+func (s *Service) getConflictContent(ctx context.Context, dir, file string) (interfaces.GitConflict, error) {
+	filePath := fmt.Sprintf("%s/%s", dir, file)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return interfaces.GitConflict{}, fmt.Errorf("failed to read conflict file: %w", err)
 	}
 
+	// Git does not write conflict markers into binary files
+	if s.isBinary(ctx, dir, file, string(content)) {
+		return interfaces.GitConflict{
+			File:    file,
+			Content: string(content),
+			Binary:  true,
+		}, nil
+	}
+
+	size := s.markerSize(ctx, dir, file)
+	hunks, err := markers.Parse(string(content), size, conflictContextLines)
+	if err != nil {
+		return interfaces.GitConflict{
+			File:        file,
+			Content:     string(content),
+			MarkerSize:  size,
+			MarkerError: err.Error(),
+		}, nil
+	}
+
+	ours, theirs := markers.JoinSides(hunks)
 	return interfaces.GitConflict{
-		File:    file,
-		Content: string(content),
-		Ours:    strings.Join(ours, "\n"),
-		Theirs:  strings.Join(theirs, "\n"),
+		File:       file,
+		Content:    string(content),
+		Ours:       ours,
+		Theirs:     theirs,
+		Hunks:      hunks,
+		MarkerSize: size,
 	}, nil
 }
 
+// binarySniffLength is how much of a file git inspects for NUL bytes to
+// decide whether it is binary
+const binarySniffLength = 8000
+
+// isBinary reports whether file is binary, either by its diff attribute (the
+// binary macro unsets it) or because content contains a NUL byte
+func (s *Service) isBinary(ctx context.Context, dir, file, content string) bool {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "check-attr", "diff", "--", file)
+	if output, err := cmd.Output(); err == nil && strings.HasSuffix(strings.TrimSpace(string(output)), ": unset") {
+		return true
+	}
+
+	if len(content) > binarySniffLength {
+		content = content[:binarySniffLength]
+	}
+	return strings.Contains(content, "\x00")
+}
+
+// markerSize returns the conflict marker length git uses for file, honouring
+// the conflict-marker-size attribute
+func (s *Service) markerSize(ctx context.Context, dir, file string) int {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "check-attr", "conflict-marker-size", "--", file)
+	output, err := cmd.Output()
+	if err != nil {
+		return markers.DefaultSize
+	}
+
+	// Output format: "<file>: conflict-marker-size: <value>"
+	value := strings.TrimSpace(string(output))
+	value = value[strings.LastIndex(value, ":")+1:]
+	size, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || size <= 0 {
+		return markers.DefaultSize
+	}
+	return size
+}
+
 func (s *Service) ResolveConflict(ctx context.Context, dir, file, resolution string) error {
 	s.log.WithField("file", file).Info("Resolving conflict")
 
@@ -152,6 +627,57 @@ func (s *Service) ResolveConflict(ctx context.Context, dir, file, resolution str
 	return nil
 }
 
+// CheckoutSide resolves a conflicted file by taking one side and staging it
+func (s *Service) CheckoutSide(ctx context.Context, dir, file string, side interfaces.ConflictSide) error {
+	s.log.WithFields(logrus.Fields{
+		"file": file,
+		"side": side,
+	}).Info("Taking one side of conflict")
+
+	// During a rebase ours is the upstream branch and theirs the internal patch
+	flag := "--ours"
+	if side == interfaces.SideInternal {
+		flag = "--theirs"
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "checkout", flag, "--", file)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to checkout %s side of %s: %w\nOutput: %s", side, file, err, string(output))
+	}
+
+	cmd = exec.CommandContext(ctx, "git", "-C", dir, "add", "--", file)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add resolved file: %w\nOutput: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// StageFile marks a conflicted file as resolved with its working tree state,
+// which may also be its deletion
+func (s *Service) StageFile(ctx context.Context, dir, file string) error {
+	s.log.WithField("file", file).Info("Staging file")
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "add", "-A", "--", file)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stage %s: %w\nOutput: %s", file, err, string(output))
+	}
+
+	return nil
+}
+
+// RemoveFile resolves a conflicted file by deleting it
+func (s *Service) RemoveFile(ctx context.Context, dir, file string) error {
+	s.log.WithField("file", file).Info("Removing file")
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "rm", "-q", "--ignore-unmatch", "--", file)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove %s: %w\nOutput: %s", file, err, string(output))
+	}
+
+	return nil
+}
+
 func (s *Service) Commit(ctx context.Context, dir, message string) error {
 	s.log.WithField("message", message).Info("Committing changes")
 
@@ -168,6 +694,20 @@ func (s *Service) Commit(ctx context.Context, dir, message string) error {
 	return nil
 }
 
+// ApplyPatch applies a unified diff to the working tree and the index
+func (s *Service) ApplyPatch(ctx context.Context, dir, patch string) error {
+	s.log.WithField("dir", dir).Info("Applying patch")
+
+	// --recount tolerates wrong line counts in hunk headers of generated patches
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "apply", "--index", "--recount", "--whitespace=nowarn", "-")
+	cmd.Stdin = strings.NewReader(patch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to apply patch: %w\nOutput: %s", err, string(output))
+	}
+
+	return nil
+}
+
 func (s *Service) configureGitUser(ctx context.Context, dir string) error {
 	// Check if user.name is already configured
 	cmd := exec.CommandContext(ctx, "git", "-C", dir, "config", "user.name")
@@ -200,6 +740,26 @@ func (s *Service) Push(ctx context.Context, dir, branch string) error {
 	return nil
 }
 
+// ForcePush replaces remoteBranch on origin with localBranch. The push is
+// refused if someone else pushed to remoteBranch since it was at expectedSHA.
+func (s *Service) ForcePush(ctx context.Context, dir, localBranch, remoteBranch, expectedSHA string) error {
+	s.log.WithFields(logrus.Fields{
+		"branch": localBranch,
+		"remote": remoteBranch,
+	}).Info("Force pushing changes")
+
+	lease := "--force-with-lease=refs/heads/" + remoteBranch
+	if expectedSHA != "" {
+		lease += ":" + expectedSHA
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "push", lease, "origin", localBranch+":refs/heads/"+remoteBranch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to force push: %w\nOutput: %s", err, string(output))
+	}
+
+	return nil
+}
+
 func (s *Service) CreateBranch(ctx context.Context, dir, branch string) error {
 	s.log.WithField("branch", branch).Info("Creating branch")
 
@@ -282,4 +842,222 @@ func (s *Service) AddRemote(ctx context.Context, dir, name, url string) error {
 	}
 
 	return nil
+}
+
+// SetConfig sets a git configuration value in the repository
+func (s *Service) SetConfig(ctx context.Context, dir, key, value string) error {
+	s.log.WithFields(logrus.Fields{
+		"dir":   dir,
+		"key":   key,
+		"value": value,
+	}).Info("Setting git config")
+
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "config", key, value)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set git config %s: %w\nOutput: %s", key, err, string(output))
+	}
+
+	return nil
+}
+
+// Diff returns the unified diff between two revisions, limited to files if
+// any are given
+func (s *Service) Diff(ctx context.Context, dir, from, to string, files []string) (string, error) {
+	s.log.WithFields(logrus.Fields{
+		"from":  from,
+		"to":    to,
+		"files": len(files),
+	}).Info("Diffing revisions")
+
+	args := append([]string{"-C", dir, "diff", "--no-color", "--no-ext-diff", from, to, "--"}, files...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s..%s: %w", from, to, err)
+	}
+
+	return string(output), nil
+}
+
+// ShowFile returns the content of a file at a revision
+func (s *Service) ShowFile(ctx context.Context, dir, rev, file string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "show", fmt.Sprintf("%s:%s", rev, file))
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s at %s: %w", file, rev, err)
+	}
+
+	return string(output), nil
+}
+
+// EnableRerere lets git record and replay conflict resolutions. The rr-cache
+// of the repository is replaced by cacheDir so recorded resolutions outlive
+// the clone. If seed is set, the resolutions in the tree of that revision are
+// added to the cache first, without replacing resolutions it already has.
+func (s *Service) EnableRerere(ctx context.Context, dir, cacheDir, seed string) error {
+	s.log.WithFields(logrus.Fields{
+		"cache": cacheDir,
+		"seed":  seed,
+	}).Info("Enabling rerere")
+
+	if err := s.SetConfig(ctx, dir, "rerere.enabled", "true"); err != nil {
+		return err
+	}
+	// Resolutions are staged explicitly once they are accepted
+	if err := s.SetConfig(ctx, dir, "rerere.autoUpdate", "false"); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create rerere cache: %w", err)
+	}
+	if seed != "" {
+		if err := s.seedRerere(ctx, dir, cacheDir, seed); err != nil {
+			return err
+		}
+	}
+
+	rrCache, err := s.gitPath(ctx, dir, "rr-cache")
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(rrCache); err != nil {
+		return fmt.Errorf("failed to replace rr-cache: %w", err)
+	}
+	absCache, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve rerere cache: %w", err)
+	}
+	if err := os.Symlink(absCache, rrCache); err != nil {
+		return fmt.Errorf("failed to link rr-cache: %w", err)
+	}
+
+	return nil
+}
+
+// seedRerere copies the rr-cache entries in the tree of a revision into
+// cacheDir. Entries the cache already has are kept.
+func (s *Service) seedRerere(ctx context.Context, dir, cacheDir, rev string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "ls-tree", "-r", "-z", "--name-only", rev)
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list rerere seed %s: %w", rev, err)
+	}
+
+	seeded := 0
+	for _, name := range strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00") {
+		// Entries are <conflict id>/preimage, postimage or thisimage
+		if name == "" || strings.Count(name, "/") != 1 {
+			continue
+		}
+		target := filepath.Join(cacheDir, filepath.FromSlash(name))
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+
+		content, err := s.ShowFile(ctx, dir, rev, name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to seed rerere cache: %w", err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to seed rerere cache: %w", err)
+		}
+		seeded++
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"seed":  rev,
+		"files": seeded,
+	}).Info("Seeded rerere cache")
+	return nil
+}
+
+// ClearRerere drops what rerere would record for the conflicts of the
+// current stop. Resolutions recorded earlier are kept.
+func (s *Service) ClearRerere(ctx context.Context, dir string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "rerere", "clear")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clear rerere state: %w\nOutput: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// markReplayed marks the content conflicts that rerere resolved with a
+// recorded resolution. Their content is the resolved file.
+func (s *Service) markReplayed(ctx context.Context, dir string, conflicts []interfaces.GitConflict) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "config", "--get", "--bool", "rerere.enabled")
+	if output, err := cmd.Output(); err != nil || strings.TrimSpace(string(output)) != "true" {
+		return nil
+	}
+
+	// remaining lists the conflicts rerere did not resolve
+	cmd = exec.CommandContext(ctx, "git", "-C", dir, "rerere", "remaining")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list conflicts rerere did not resolve: %w", err)
+	}
+	remaining := map[string]bool{}
+	for _, path := range strings.Split(string(output), "\n") {
+		remaining[path] = true
+	}
+
+	for i := range conflicts {
+		conflict := &conflicts[i]
+		contentConflict := conflict.Type == interfaces.ConflictBothModified || conflict.Type == interfaces.ConflictAddedByBoth
+		if contentConflict && !conflict.Binary && !remaining[conflict.File] && len(conflict.Hunks) == 0 {
+			conflict.Replayed = true
+		}
+	}
+	return nil
+}
+
+// RemoteHead returns the commit a branch of a remote repository points to,
+// without fetching it
+func (s *Service) RemoteHead(ctx context.Context, repo, branch string) (string, error) {
+	ref := "refs/heads/" + branch
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", repo, ref)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s of %s: %w", ref, repo, err)
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == ref {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("branch %s not found in %s", branch, repo)
+}
+
+// CommitsByOthers lists the commits in base..head that were not committed with
+// the git identity of the repository at dir, so someone else made or rewrote
+// them
+func (s *Service) CommitsByOthers(ctx context.Context, dir, base, head string) ([]string, error) {
+	if err := s.configureGitUser(ctx, dir); err != nil {
+		return nil, fmt.Errorf("failed to configure git user: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "config", "user.email")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git user: %w", err)
+	}
+	email := strings.TrimSpace(string(output))
+
+	cmd = exec.CommandContext(ctx, "git", "-C", dir, "log", "--format=%H %ce", base+".."+head)
+	output, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits of %s: %w", head, err)
+	}
+
+	var commits []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] != email {
+			commits = append(commits, fields[0])
+		}
+	}
+	return commits, nil
 }
\ No newline at end of file
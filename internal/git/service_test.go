@@ -0,0 +1,230 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// gitIdentity is the identity the test repositories commit with
+var gitIdentity = []string{
+	"GIT_AUTHOR_NAME=Dev", "GIT_AUTHOR_EMAIL=dev@example.com",
+	"GIT_COMMITTER_NAME=Dev", "GIT_COMMITTER_EMAIL=dev@example.com",
+}
+
+// runGit runs git in dir and fails the test on errors
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), gitIdentity...)
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %v: %s", args, output)
+	return strings.TrimSpace(string(output))
+}
+
+// newRepo creates a repository on branch main in a new temporary directory
+func newRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+	return dir
+}
+
+// commitFiles writes files in the repository at dir and commits them
+func commitFiles(t *testing.T, dir, message string, files map[string]string) string {
+	t.Helper()
+	for file, content := range files {
+		path := filepath.Join(dir, file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", message)
+	return runGit(t, dir, "rev-parse", "HEAD")
+}
+
+func TestCommitsByOthers(t *testing.T) {
+	dir := newRepo(t)
+	base := commitFiles(t, dir, "Base", map[string]string{"a.c": "one\n"})
+	runGit(t, dir, "config", "user.name", "AI Rebaser")
+	runGit(t, dir, "config", "user.email", "ai-rebaser@example.com")
+
+	// The rebaser's own commit uses the repository's identity
+	cmd := exec.Command("git", "-C", dir, "commit", "-q", "--allow-empty", "-m", "Rebased patch")
+	require.NoError(t, cmd.Run())
+	human := commitFiles(t, dir, "Fix conflict", map[string]string{"a.c": "two\n"})
+
+	commits, err := NewService().CommitsByOthers(context.Background(), dir, base, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{human}, commits)
+
+	_, err = NewService().CommitsByOthers(context.Background(), dir, base, "0123456789abcdef0123456789abcdef01234567")
+	assert.Error(t, err)
+}
+
+func TestGetConflicts_Types(t *testing.T) {
+	dir := newRepo(t)
+	runGit(t, dir, "config", "merge.conflictStyle", "zdiff3")
+	commitFiles(t, dir, "Base", map[string]string{
+		"both.c":     "one\ntwo\nthree\n",
+		"upstream.c": "upstream deletes\n",
+		"internal.c": "internal deletes\n",
+		"rename.c":   "renamed\nby\nboth\n",
+	})
+
+	runGit(t, dir, "checkout", "-q", "-b", "upstream")
+	runGit(t, dir, "rm", "-q", "upstream.c")
+	runGit(t, dir, "mv", "rename.c", "rename-upstream.c")
+	commitFiles(t, dir, "Upstream", map[string]string{
+		"both.c":     "one\ntwo upstream\nthree\n",
+		"added.c":    "added upstream\n",
+		"internal.c": "internal deletes, upstream changes\n",
+	})
+
+	runGit(t, dir, "checkout", "-q", "main")
+	runGit(t, dir, "rm", "-q", "internal.c")
+	runGit(t, dir, "mv", "rename.c", "rename-internal.c")
+	commitFiles(t, dir, "Internal", map[string]string{
+		"both.c":     "one\ntwo internal\nthree\n",
+		"added.c":    "added internal\n",
+		"upstream.c": "upstream deletes, internal changes\n",
+	})
+
+	service := NewService()
+	ctx := context.Background()
+	require.Error(t, service.Rebase(ctx, dir, "upstream"))
+
+	conflicts, err := service.GetConflicts(ctx, dir)
+	require.NoError(t, err)
+	byFile := map[string]interfaces.GitConflict{}
+	for _, conflict := range conflicts {
+		byFile[conflict.File] = conflict
+	}
+	require.Len(t, byFile, 5)
+
+	both := byFile["both.c"]
+	assert.Equal(t, interfaces.ConflictBothModified, both.Type)
+	require.Len(t, both.Hunks, 1)
+	assert.Equal(t, "two upstream", both.Hunks[0].Ours)
+	assert.Equal(t, "two", both.Hunks[0].Base)
+	assert.Equal(t, "two internal", both.Hunks[0].Theirs)
+	assert.Equal(t, "Internal", both.Commit.Subject)
+
+	added := byFile["added.c"]
+	assert.Equal(t, interfaces.ConflictAddedByBoth, added.Type)
+	require.Len(t, added.Hunks, 1)
+	assert.Equal(t, "added upstream", added.Hunks[0].Ours)
+	assert.Equal(t, "added internal", added.Hunks[0].Theirs)
+
+	// Deleted upstream, modified by the internal patch (DU)
+	deletedByUs := byFile["upstream.c"]
+	assert.Equal(t, interfaces.ConflictDeletedByUs, deletedByUs.Type)
+	assert.Empty(t, deletedByUs.Ours)
+	assert.Equal(t, "upstream deletes, internal changes\n", deletedByUs.Theirs)
+	assert.Empty(t, deletedByUs.Hunks)
+
+	// Deleted by the internal patch, modified upstream (UD)
+	deletedByThem := byFile["internal.c"]
+	assert.Equal(t, interfaces.ConflictDeletedByThem, deletedByThem.Type)
+	assert.Equal(t, "internal deletes, upstream changes\n", deletedByThem.Ours)
+	assert.Empty(t, deletedByThem.Theirs)
+	assert.Empty(t, deletedByThem.Hunks)
+
+	// rename/rename shows up as DD on the source and AU/UA on the targets
+	renamed := byFile["rename-upstream.c"]
+	assert.Equal(t, interfaces.ConflictRenamed, renamed.Type)
+	assert.Equal(t, "rename.c", renamed.RenamedFrom)
+	assert.Equal(t, "rename-internal.c", renamed.RenamedTo)
+	assert.Equal(t, "renamed\nby\nboth\n", renamed.Content)
+}
+
+// conflictingOrigin creates a repository whose main branch conflicts with
+// its upstream branch in both.c
+func conflictingOrigin(t *testing.T) string {
+	t.Helper()
+	dir := newRepo(t)
+	commitFiles(t, dir, "Base", map[string]string{"both.c": "one\ntwo\nthree\n"})
+	runGit(t, dir, "checkout", "-q", "-b", "upstream")
+	commitFiles(t, dir, "Upstream", map[string]string{"both.c": "one\ntwo upstream\nthree\n"})
+	runGit(t, dir, "checkout", "-q", "main")
+	commitFiles(t, dir, "Internal", map[string]string{"both.c": "one\ntwo internal\nthree\n"})
+	return dir
+}
+
+// rebaseWithRerere clones origin with rerere sharing cacheDir and rebases
+// main onto upstream, which stops on the conflict in both.c
+func rebaseWithRerere(t *testing.T, origin, cacheDir string) string {
+	t.Helper()
+	service := NewService()
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "clone")
+	require.NoError(t, service.Clone(ctx, origin, dir))
+	require.NoError(t, service.EnableRerere(ctx, dir, cacheDir, ""))
+	require.Error(t, service.Rebase(ctx, dir, "origin/upstream"))
+	return dir
+}
+
+func TestRerere_ReplaysResolutionsAcrossClones(t *testing.T) {
+	origin := conflictingOrigin(t)
+	cacheDir := filepath.Join(t.TempDir(), "rr-cache")
+	service := NewService()
+	ctx := context.Background()
+	resolution := "one\ntwo upstream and internal\nthree\n"
+
+	dir := rebaseWithRerere(t, origin, cacheDir)
+	target, err := os.Readlink(filepath.Join(dir, ".git", "rr-cache"))
+	require.NoError(t, err)
+	assert.Equal(t, cacheDir, target)
+
+	conflicts, err := service.GetConflicts(ctx, dir)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	assert.False(t, conflicts[0].Replayed)
+	require.NoError(t, service.ResolveConflict(ctx, dir, "both.c", resolution))
+	require.NoError(t, service.ContinueRebase(ctx, dir))
+
+	// A fresh clone sharing the cache gets the recorded resolution
+	dir = rebaseWithRerere(t, origin, cacheDir)
+	conflicts, err = service.GetConflicts(ctx, dir)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	assert.True(t, conflicts[0].Replayed)
+	assert.Equal(t, resolution, conflicts[0].Content)
+	assert.Empty(t, conflicts[0].Hunks)
+}
+
+func TestRerere_ClearDropsResolution(t *testing.T) {
+	origin := conflictingOrigin(t)
+	cacheDir := filepath.Join(t.TempDir(), "rr-cache")
+	service := NewService()
+	ctx := context.Background()
+
+	dir := rebaseWithRerere(t, origin, cacheDir)
+	require.NoError(t, service.ResolveConflict(ctx, dir, "both.c", "one\ntwo by the AI\nthree\n"))
+	require.NoError(t, service.ClearRerere(ctx, dir))
+	require.NoError(t, service.ContinueRebase(ctx, dir))
+
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Nothing was recorded, so the next clone has to resolve the conflict again
+	dir = rebaseWithRerere(t, origin, cacheDir)
+	conflicts, err := service.GetConflicts(ctx, dir)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	assert.False(t, conflicts[0].Replayed)
+	require.Len(t, conflicts[0].Hunks, 1)
+}
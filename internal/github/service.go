@@ -3,7 +3,9 @@ package github
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v57/github"
 	"github.com/sirupsen/logrus"
@@ -62,17 +64,7 @@ func (s *Service) CreatePullRequest(ctx context.Context, req interfaces.CreatePR
 		return nil, fmt.Errorf("failed to create pull request: %w", err)
 	}
 
-	pr := &interfaces.PullRequest{
-		Number:    *ghPR.Number,
-		Title:     *ghPR.Title,
-		Body:      getStringValue(ghPR.Body),
-		State:     *ghPR.State,
-		Head:      *ghPR.Head.Ref,
-		Base:      *ghPR.Base.Ref,
-		HTMLURL:   *ghPR.HTMLURL,
-		Mergeable: getBoolValue(ghPR.Mergeable),
-		Draft:     getBoolValue(ghPR.Draft),
-	}
+	pr := toPullRequest(ghPR)
 
 	s.log.WithFields(logrus.Fields{
 		"prNumber": pr.Number,
@@ -82,8 +74,11 @@ func (s *Service) CreatePullRequest(ctx context.Context, req interfaces.CreatePR
 	return pr, nil
 }
 
-func (s *Service) MergePullRequest(ctx context.Context, prNumber int) error {
-	s.log.WithField("prNumber", prNumber).Info("Merging pull request with rebase method")
+func (s *Service) MergePullRequest(ctx context.Context, prNumber int, method string) error {
+	s.log.WithFields(logrus.Fields{
+		"prNumber": prNumber,
+		"method":   method,
+	}).Info("Merging pull request")
 
 	// First check if PR is mergeable
 	pr, _, err := s.client.PullRequests.Get(ctx, s.owner, s.repo, prNumber)
@@ -100,11 +95,11 @@ func (s *Service) MergePullRequest(ctx context.Context, prNumber int) error {
 		return fmt.Errorf("pull request #%d is not open (state: %s)", prNumber, *pr.State)
 	}
 
-	// Merge the pull request using rebase method
+	// The commit title only applies to merge and squash commits
 	commitMessage := fmt.Sprintf("Rebase pull request #%d", prNumber)
 	mergeOptions := &github.PullRequestOptions{
 		CommitTitle: commitMessage,
-		MergeMethod: "rebase", // Use rebase method for AI-assisted rebasing tool
+		MergeMethod: method,
 	}
 
 	mergeResult, _, err := s.client.PullRequests.Merge(ctx, s.owner, s.repo, prNumber, "", mergeOptions)
@@ -120,7 +115,7 @@ func (s *Service) MergePullRequest(ctx context.Context, prNumber int) error {
 	s.log.WithFields(logrus.Fields{
 		"prNumber": prNumber,
 		"sha":      getStringValue(mergeResult.SHA),
-	}).Info("Pull request rebased and merged successfully")
+	}).Info("Pull request merged successfully")
 
 	return nil
 }
@@ -134,19 +129,7 @@ func (s *Service) GetPullRequest(ctx context.Context, prNumber int) (*interfaces
 		return nil, fmt.Errorf("failed to get pull request: %w", err)
 	}
 
-	pr := &interfaces.PullRequest{
-		Number:    *ghPR.Number,
-		Title:     *ghPR.Title,
-		Body:      getStringValue(ghPR.Body),
-		State:     *ghPR.State,
-		Head:      *ghPR.Head.Ref,
-		Base:      *ghPR.Base.Ref,
-		HTMLURL:   *ghPR.HTMLURL,
-		Mergeable: getBoolValue(ghPR.Mergeable),
-		Draft:     getBoolValue(ghPR.Draft),
-	}
-
-	return pr, nil
+	return toPullRequest(ghPR), nil
 }
 
 func (s *Service) ListPullRequests(ctx context.Context, state string) ([]*interfaces.PullRequest, error) {
@@ -180,18 +163,7 @@ func (s *Service) ListPullRequests(ctx context.Context, state string) ([]*interf
 
 		// Convert GitHub PRs to interface PRs
 		for _, ghPR := range ghPRs {
-			pr := &interfaces.PullRequest{
-				Number:    *ghPR.Number,
-				Title:     *ghPR.Title,
-				Body:      getStringValue(ghPR.Body),
-				State:     *ghPR.State,
-				Head:      *ghPR.Head.Ref,
-				Base:      *ghPR.Base.Ref,
-				HTMLURL:   *ghPR.HTMLURL,
-				Mergeable: getBoolValue(ghPR.Mergeable),
-				Draft:     getBoolValue(ghPR.Draft),
-			}
-			allPRs = append(allPRs, pr)
+			allPRs = append(allPRs, toPullRequest(ghPR))
 		}
 
 		// Check if there are more pages
@@ -252,6 +224,256 @@ func (s *Service) AddReviewers(ctx context.Context, prNumber int, reviewers []st
 	return nil
 }
 
+// UpdatePullRequest replaces the title and body of a PR
+func (s *Service) UpdatePullRequest(ctx context.Context, prNumber int, title, body string) (*interfaces.PullRequest, error) {
+	s.log.WithField("prNumber", prNumber).Info("Updating pull request")
+
+	ghPR, _, err := s.client.PullRequests.Edit(ctx, s.owner, s.repo, prNumber, &github.PullRequest{
+		Title: github.String(title),
+		Body:  github.String(body),
+	})
+	if err != nil {
+		s.log.WithError(err).Error("Failed to update pull request")
+		return nil, fmt.Errorf("failed to update pull request: %w", err)
+	}
+
+	return toPullRequest(ghPR), nil
+}
+
+// ClosePullRequest closes a PR without merging it, explaining why in a
+// comment first
+func (s *Service) ClosePullRequest(ctx context.Context, prNumber int, comment string) error {
+	s.log.WithField("prNumber", prNumber).Info("Closing pull request")
+
+	if comment != "" {
+		if _, _, err := s.client.Issues.CreateComment(ctx, s.owner, s.repo, prNumber, &github.IssueComment{Body: github.String(comment)}); err != nil {
+			return fmt.Errorf("failed to comment on pull request: %w", err)
+		}
+	}
+
+	if _, _, err := s.client.PullRequests.Edit(ctx, s.owner, s.repo, prNumber, &github.PullRequest{State: github.String("closed")}); err != nil {
+		s.log.WithError(err).Error("Failed to close pull request")
+		return fmt.Errorf("failed to close pull request: %w", err)
+	}
+
+	return nil
+}
+
+// ChangesRequested reports if a reviewer's latest review of a PR requests
+// changes. Comments do not change a reviewer's verdict.
+func (s *Service) ChangesRequested(ctx context.Context, prNumber int) (bool, error) {
+	verdicts := map[string]string{}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := s.client.PullRequests.ListReviews(ctx, s.owner, s.repo, prNumber, opts)
+		if err != nil {
+			return false, fmt.Errorf("failed to list reviews: %w", err)
+		}
+
+		// Reviews are listed oldest first
+		for _, review := range reviews {
+			state := getStringValue(review.State)
+			if state == "COMMENTED" || state == "PENDING" {
+				continue
+			}
+			verdicts[review.GetUser().GetLogin()] = state
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	for _, state := range verdicts {
+		if state == "CHANGES_REQUESTED" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LastActivity returns when people last worked on a PR: the latest comment,
+// review comment or review that was not written by a bot, and the commit date
+// of its head. Label changes, status updates and edits of the description do
+// not count.
+func (s *Service) LastActivity(ctx context.Context, prNumber int, headSHA string) (time.Time, error) {
+	var latest time.Time
+	err := s.eachActivity(ctx, prNumber, func(user *github.User, at *github.Timestamp) {
+		if user.GetType() == "Bot" || at == nil {
+			return
+		}
+		if at.After(latest) {
+			latest = at.Time
+		}
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if headSHA != "" {
+		commit, _, err := s.client.Git.GetCommit(ctx, s.owner, s.repo, headSHA)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to get head commit: %w", err)
+		}
+		if date := commit.GetCommitter().Date; date != nil && date.After(latest) {
+			latest = date.Time
+		}
+	}
+
+	return latest, nil
+}
+
+// CommentedByOthers reports if anyone but author commented on or reviewed a
+// PR. Bots do not count.
+func (s *Service) CommentedByOthers(ctx context.Context, prNumber int, author string) (bool, error) {
+	others := false
+	err := s.eachActivity(ctx, prNumber, func(user *github.User, at *github.Timestamp) {
+		if user.GetType() != "Bot" && user.GetLogin() != author {
+			others = true
+		}
+	})
+	return others, err
+}
+
+// eachActivity calls seen with the author and time of every comment, review
+// comment and review of a PR
+func (s *Service) eachActivity(ctx context.Context, prNumber int, seen func(user *github.User, at *github.Timestamp)) error {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := s.client.Issues.ListComments(ctx, s.owner, s.repo, prNumber, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, comment := range comments {
+			seen(comment.User, comment.CreatedAt)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	reviewCommentOpts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := s.client.PullRequests.ListComments(ctx, s.owner, s.repo, prNumber, reviewCommentOpts)
+		if err != nil {
+			return fmt.Errorf("failed to list review comments: %w", err)
+		}
+		for _, comment := range comments {
+			seen(comment.User, comment.CreatedAt)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		reviewCommentOpts.Page = resp.NextPage
+	}
+
+	reviewOpts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := s.client.PullRequests.ListReviews(ctx, s.owner, s.repo, prNumber, reviewOpts)
+		if err != nil {
+			return fmt.Errorf("failed to list reviews: %w", err)
+		}
+		for _, review := range reviews {
+			seen(review.User, review.SubmittedAt)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		reviewOpts.Page = resp.NextPage
+	}
+
+	return nil
+}
+
+// CheckState sums up the commit statuses and check runs of ref. A single
+// failure fails all, and anything still running keeps them pending.
+func (s *Service) CheckState(ctx context.Context, ref string) (interfaces.CheckState, error) {
+	status, _, err := s.client.Repositories.GetCombinedStatus(ctx, s.owner, s.repo, ref, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit status: %w", err)
+	}
+
+	state := interfaces.CheckSuccess
+	// The combined state is pending without any statuses
+	if status.GetTotalCount() > 0 {
+		switch status.GetState() {
+		case "failure", "error":
+			return interfaces.CheckFailure, nil
+		case "pending":
+			state = interfaces.CheckPending
+		}
+	}
+
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, resp, err := s.client.Checks.ListCheckRunsForRef(ctx, s.owner, s.repo, ref, opts)
+		if err != nil {
+			return "", fmt.Errorf("failed to list check runs: %w", err)
+		}
+
+		for _, run := range runs.CheckRuns {
+			if run.GetStatus() != "completed" {
+				state = interfaces.CheckPending
+				continue
+			}
+			switch run.GetConclusion() {
+			case "success", "neutral", "skipped":
+			default:
+				return interfaces.CheckFailure, nil
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return state, nil
+}
+
+// ContainsCommit reports if sha is part of the history of ref. A commit the
+// repository does not have is not part of any history.
+func (s *Service) ContainsCommit(ctx context.Context, ref, sha string) (bool, error) {
+	comparison, resp, err := s.client.Repositories.CompareCommits(ctx, s.owner, s.repo, sha, ref, &github.ListOptions{PerPage: 1})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to compare %s with %s: %w", ref, sha, err)
+	}
+
+	switch comparison.GetStatus() {
+	case "ahead", "identical":
+		return true, nil
+	}
+	return false, nil
+}
+
+// toPullRequest converts a GitHub PR
+func toPullRequest(ghPR *github.PullRequest) *interfaces.PullRequest {
+	return &interfaces.PullRequest{
+		Number:    *ghPR.Number,
+		Title:     *ghPR.Title,
+		Author:    ghPR.GetUser().GetLogin(),
+		Body:      getStringValue(ghPR.Body),
+		State:     *ghPR.State,
+		Head:      *ghPR.Head.Ref,
+		HeadSHA:   getStringValue(ghPR.Head.SHA),
+		Base:      *ghPR.Base.Ref,
+		HTMLURL:   *ghPR.HTMLURL,
+		Mergeable: getBoolValue(ghPR.Mergeable),
+		Draft:     getBoolValue(ghPR.Draft),
+		CreatedAt: formatTimestamp(ghPR.CreatedAt),
+		UpdatedAt: formatTimestamp(ghPR.UpdatedAt),
+
+		Merged:         getBoolValue(ghPR.Merged),
+		MergeCommitSHA: getStringValue(ghPR.MergeCommitSHA),
+	}
+}
+
 // Helper functions for safe pointer dereferencing
 
 func getStringValue(s *string) string {
@@ -266,4 +488,11 @@ func getBoolValue(b *bool) bool {
 		return false
 	}
 	return *b
+}
+
+func formatTimestamp(t *github.Timestamp) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
 }
\ No newline at end of file
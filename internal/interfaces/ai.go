@@ -3,8 +3,119 @@ package interfaces
 import "context"
 
 type AIService interface {
-	ResolveConflict(ctx context.Context, conflict GitConflict) (string, error)
+	ResolveConflict(ctx context.Context, conflict GitConflict) (*ConflictResolution, error)
+	ResolveConflictHunk(ctx context.Context, conflict GitConflict, hunk ConflictHunk) (*ConflictResolution, error)
 	GenerateCommitMessage(ctx context.Context, changes []string) (string, error)
 	GenerateCommitMessageWithConflicts(ctx context.Context, changes []string, conflicts []GitConflict) (string, error)
 	GeneratePRDescription(ctx context.Context, commits []string, conflicts []GitConflict) (string, error)
-}
\ No newline at end of file
+	RepairBuild(ctx context.Context, request RepairRequest) (string, error)
+	ReviewRebase(ctx context.Context, request ReviewRequest) ([]ReviewFinding, error)
+}
+
+// ConflictResolution is the AI's answer for a conflict or conflict hunk
+type ConflictResolution struct {
+	// Resolution is the resolved content without conflict markers
+	Resolution string
+	// Confidence is how sure the model is about the resolution, from 0 to 1
+	Confidence float64
+	Strategy   ResolutionStrategy
+	// Rationale explains why the resolution was chosen
+	Rationale string
+	// Risks lists what a reviewer should double check
+	Risks []string
+}
+
+// ResolutionStrategy describes how a resolution relates to the two sides
+type ResolutionStrategy string
+
+const (
+	// StrategyOurs keeps the upstream side
+	StrategyOurs ResolutionStrategy = "ours"
+	// StrategyTheirs keeps the internal side
+	StrategyTheirs ResolutionStrategy = "theirs"
+	// StrategyCombined merges the changes of both sides
+	StrategyCombined ResolutionStrategy = "combined"
+	// StrategyRewritten replaces both sides with new code
+	StrategyRewritten ResolutionStrategy = "rewritten"
+)
+
+// RepairRequest describes a build or test failure after a rebase. The AI is
+// asked for a unified diff against Files that fixes the failures.
+type RepairRequest struct {
+	Failures []CommandResult
+	Files    []FileContent
+	// Feedback explains why earlier repair patches were rejected
+	Feedback []string
+}
+
+// FileContent is the current content of a file in the working tree
+type FileContent struct {
+	Path    string
+	Content string
+}
+
+// ReviewRequest asks for a review of a finished rebase. Diff is the unified
+// diff between upstream and the rebased branch for the files that had
+// conflicts, Conflicts records how they were resolved.
+type ReviewRequest struct {
+	Diff      string
+	Conflicts []GitConflict
+}
+
+// ReviewFinding is a problem the AI found in the rebased changes
+type ReviewFinding struct {
+	File string
+	// Line is the line in the rebased file, zero if the finding is not about
+	// a single line
+	Line     int
+	Severity ReviewSeverity
+	Category ReviewCategory
+	Message  string
+}
+
+// ReviewSeverity rates how bad a finding is
+type ReviewSeverity string
+
+const (
+	// SeverityInfo is worth a look but most likely harmless
+	SeverityInfo ReviewSeverity = "info"
+	// SeverityWarning may change behavior and should be checked
+	SeverityWarning ReviewSeverity = "warning"
+	// SeverityError breaks the build or loses an internal change
+	SeverityError ReviewSeverity = "error"
+)
+
+// AtLeast reports whether the severity is as bad as other or worse. Unknown
+// severities rank below all known ones.
+func (s ReviewSeverity) AtLeast(other ReviewSeverity) bool {
+	return severityRank(s) >= severityRank(other)
+}
+
+func severityRank(severity ReviewSeverity) int {
+	switch severity {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityError:
+		return 3
+	}
+	return 0
+}
+
+// ReviewCategory names the kind of problem of a finding
+type ReviewCategory string
+
+const (
+	// CategoryDuplicateDefinition is a definition that both sides added
+	CategoryDuplicateDefinition ReviewCategory = "duplicate_definition"
+	// CategoryLostChange is an internal change that the rebase dropped
+	CategoryLostChange ReviewCategory = "lost_change"
+	// CategorySyntax is broken syntax such as mismatched braces
+	CategorySyntax ReviewCategory = "syntax"
+	// CategorySemanticDrift is code that still builds but means something
+	// else than either side intended
+	CategorySemanticDrift ReviewCategory = "semantic_drift"
+	// CategoryOther is anything else
+	CategoryOther ReviewCategory = "other"
+)
\ No newline at end of file
@@ -4,22 +4,125 @@ import "context"
 
 type GitService interface {
 	Clone(ctx context.Context, repo, dir string) error
+	UpdateMirror(ctx context.Context, dir, repo string, remotes map[string]string) error
+	CloneShared(ctx context.Context, mirror, repo, dir string) error
 	Fetch(ctx context.Context, dir string) error
 	Rebase(ctx context.Context, dir, branch string) error
+	ContinueRebase(ctx context.Context, dir string) error
+	AbortRebase(ctx context.Context, dir string) error
+	SkipCommit(ctx context.Context, dir string) error
+	RebaseInProgress(ctx context.Context, dir string) (bool, error)
 	GetConflicts(ctx context.Context, dir string) ([]GitConflict, error)
 	ResolveConflict(ctx context.Context, dir, file, resolution string) error
+	CheckoutSide(ctx context.Context, dir, file string, side ConflictSide) error
+	RemoveFile(ctx context.Context, dir, file string) error
+	StageFile(ctx context.Context, dir, file string) error
 	Commit(ctx context.Context, dir, message string) error
+	ApplyPatch(ctx context.Context, dir, patch string) error
 	Push(ctx context.Context, dir, branch string) error
+	ForcePush(ctx context.Context, dir, localBranch, remoteBranch, expectedSHA string) error
 	CreateBranch(ctx context.Context, dir, branch string) error
 	GetStatus(ctx context.Context, dir string) (GitStatus, error)
 	AddRemote(ctx context.Context, dir, name, url string) error
+	SetConfig(ctx context.Context, dir, key, value string) error
+	Diff(ctx context.Context, dir, from, to string, files []string) (string, error)
+	ShowFile(ctx context.Context, dir, rev, file string) (string, error)
+	EnableRerere(ctx context.Context, dir, cacheDir, seed string) error
+	ClearRerere(ctx context.Context, dir string) error
+	RemoteHead(ctx context.Context, repo, branch string) (string, error)
+	CommitsByOthers(ctx context.Context, dir, base, head string) ([]string, error)
 }
 
+// ConflictType classifies a conflict by the index stages of its paths. During
+// a rebase "us" is upstream and "them" is the internal patch being replayed.
+type ConflictType string
+
+const (
+	ConflictBothModified  ConflictType = "both-modified"
+	ConflictAddedByBoth   ConflictType = "added-by-both"
+	ConflictDeletedByUs   ConflictType = "deleted-by-us"   // deleted upstream, modified by the internal patch
+	ConflictDeletedByThem ConflictType = "deleted-by-them" // deleted by the internal patch, modified upstream
+	ConflictRenamed       ConflictType = "renamed"         // renamed to different paths by both sides
+)
+
+// ConflictSide selects one side of a conflict
+type ConflictSide string
+
+const (
+	SideUpstream ConflictSide = "upstream"
+	SideInternal ConflictSide = "internal"
+)
+
 type GitConflict struct {
 	File    string
+	Type    ConflictType
 	Content string
-	Ours    string
-	Theirs  string
+	// Binary files have no conflict markers and are never sent to the AI
+	Binary bool
+	// Ours and Theirs hold the respective sides of all hunks joined together
+	Ours   string
+	Theirs string
+	// Hunks are the individual conflict regions of Content in file order
+	Hunks []ConflictHunk
+	// MarkerSize is the length of the conflict markers in Content, zero
+	// means the default of 7
+	MarkerSize int
+	// MarkerError is set if the conflict markers in Content cannot be
+	// parsed, for example because they nest inside the markers of a file
+	// left for a human at an earlier stop. Such conflicts have no hunks.
+	MarkerError string
+
+	// Commit is the internal patch being replayed when the rebase stopped
+	Commit CommitInfo
+	// UpstreamCommits touched File between the merge base and the rebase target
+	UpstreamCommits []CommitInfo
+
+	// RenamedFrom and RenamedTo are the original path and the path the
+	// internal patch moved it to for renamed conflicts. File is the upstream
+	// path, where the merged content is kept.
+	RenamedFrom string
+	RenamedTo   string
+
+	// Replayed is set if git rerere resolved the conflict with a recorded
+	// resolution. Content is then the resolved file.
+	Replayed bool
+
+	// Feedback explains why earlier AI resolutions were rejected
+	Feedback []string
+
+	// Action records how the conflict was resolved, ResolvedByAI is set if
+	// the resolved content was written by the AI
+	Action       string
+	ResolvedByAI bool
+	// Resolution is the AI's answer if ResolvedByAI is set
+	Resolution *ConflictResolution
+	// Unresolved is set if the conflict was committed with its conflict
+	// markers for a human to resolve
+	Unresolved bool
+}
+
+// ConflictHunk is a single conflict region of a file. StartLine and EndLine are
+// 1-based and include the conflict marker lines. Base is only set when the
+// file was written with the diff3 or zdiff3 conflict style.
+type ConflictHunk struct {
+	StartLine int
+	EndLine   int
+	Ours      string
+	Base      string
+	Theirs    string
+	// Before and After hold the unconflicted lines surrounding the hunk
+	Before string
+	After  string
+}
+
+// CommitInfo describes a commit that gives context to a conflict. Diff is
+// limited to the conflicting file and may be empty.
+type CommitInfo struct {
+	SHA     string
+	Author  string
+	Subject string
+	Body    string
+	Diff    string
 }
 
 type GitStatus struct {
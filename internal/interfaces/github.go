@@ -1,15 +1,35 @@
 package interfaces
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type GitHubService interface {
 	CreatePullRequest(ctx context.Context, req CreatePRRequest) (*PullRequest, error)
-	MergePullRequest(ctx context.Context, prNumber int) error
+	MergePullRequest(ctx context.Context, prNumber int, method string) error
 	GetPullRequest(ctx context.Context, prNumber int) (*PullRequest, error)
 	ListPullRequests(ctx context.Context, state string) ([]*PullRequest, error)
 	AddReviewers(ctx context.Context, prNumber int, reviewers []string) error
+	UpdatePullRequest(ctx context.Context, prNumber int, title, body string) (*PullRequest, error)
+	ClosePullRequest(ctx context.Context, prNumber int, comment string) error
+	ChangesRequested(ctx context.Context, prNumber int) (bool, error)
+	LastActivity(ctx context.Context, prNumber int, headSHA string) (time.Time, error)
+	CommentedByOthers(ctx context.Context, prNumber int, author string) (bool, error)
+	CheckState(ctx context.Context, ref string) (CheckState, error)
+	ContainsCommit(ctx context.Context, ref, sha string) (bool, error)
 }
 
+// CheckState sums up the commit statuses and check runs of a commit
+type CheckState string
+
+const (
+	// CheckSuccess means every check passed, or there are none
+	CheckSuccess CheckState = "success"
+	CheckPending CheckState = "pending"
+	CheckFailure CheckState = "failure"
+)
+
 type CreatePRRequest struct {
 	Title       string
 	Body        string
@@ -25,10 +45,22 @@ type PullRequest struct {
 	Body      string
 	State     string
 	Head      string
+	HeadSHA   string
 	Base      string
 	HTMLURL   string
 	Mergeable bool
 	Draft     bool
+	// CreatedAt and UpdatedAt are RFC 3339 timestamps. UpdatedAt changes
+	// with any change to the PR, also labels, status updates and edits of
+	// its description. LastActivity only counts what people did.
 	CreatedAt string
 	UpdatedAt string
+
+	// Author is the login of the user who opened the PR
+	Author string
+
+	// Merged is set for closed PRs that were merged, MergeCommitSHA is the
+	// commit on the base branch that contains their changes
+	Merged         bool
+	MergeCommitSHA string
 }
\ No newline at end of file
@@ -11,6 +11,9 @@ type NotificationMessage struct {
 	Message string
 	URL     string
 	Level   NotificationLevel
+	// ActionRequired marks messages that ask someone to act, such as
+	// finishing conflicts the AI left unresolved
+	ActionRequired bool
 }
 
 type NotificationLevel string
@@ -0,0 +1,170 @@
+package markers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BlindspotSoftware/rebAIser/internal/interfaces"
+)
+
+// DefaultSize is the length of the conflict markers git writes unless the
+// conflict-marker-size attribute of a file says otherwise
+const DefaultSize = 7
+
+type section int
+
+const (
+	sectionNone section = iota
+	sectionOurs
+	sectionBase
+	sectionTheirs
+)
+
+// Parse finds all conflict hunks in content. markerSize is the conflict marker
+// length git used for the file and contextLines bounds the number of unconflicted
+// lines kept before and after each hunk. Context never reaches into a
+// neighbouring hunk.
+func Parse(content string, markerSize, contextLines int) ([]interfaces.ConflictHunk, error) {
+	if markerSize <= 0 {
+		markerSize = DefaultSize
+	}
+
+	lines := strings.Split(content, "\n")
+
+	var hunks []interfaces.ConflictHunk
+	var ours, base, theirs []string
+	current := sectionNone
+	start := 0
+
+	for i, line := range lines {
+		// Conflict markers keep the line ending style of the file
+		marker := strings.TrimSuffix(line, "\r")
+
+		switch {
+		case isMarker(marker, '<', markerSize, true):
+			if current != sectionNone {
+				return nil, fmt.Errorf("line %d: nested conflict marker inside hunk starting at line %d", i+1, start+1)
+			}
+			current = sectionOurs
+			start = i
+			ours, base, theirs = nil, nil, nil
+		case current == sectionOurs && isMarker(marker, '|', markerSize, true):
+			current = sectionBase
+		case (current == sectionOurs || current == sectionBase) && isMarker(marker, '=', markerSize, false):
+			current = sectionTheirs
+		case current == sectionTheirs && isMarker(marker, '>', markerSize, true):
+			hunks = append(hunks, interfaces.ConflictHunk{
+				StartLine: start + 1,
+				EndLine:   i + 1,
+				Ours:      strings.Join(ours, "\n"),
+				Base:      strings.Join(base, "\n"),
+				Theirs:    strings.Join(theirs, "\n"),
+			})
+			current = sectionNone
+		case current == sectionOurs:
+			ours = append(ours, line)
+		case current == sectionBase:
+			base = append(base, line)
+		case current == sectionTheirs:
+			theirs = append(theirs, line)
+		}
+	}
+
+	if current != sectionNone {
+		return nil, fmt.Errorf("line %d: unterminated conflict hunk", start+1)
+	}
+
+	addContext(hunks, lines, contextLines)
+	return hunks, nil
+}
+
+// isMarker reports whether line is a conflict marker made of exactly size
+// repetitions of char. Labelled markers may be followed by a space and a label.
+func isMarker(line string, char byte, size int, labelled bool) bool {
+	if len(line) < size {
+		return false
+	}
+	for i := 0; i < size; i++ {
+		if line[i] != char {
+			return false
+		}
+	}
+	if len(line) == size {
+		return true
+	}
+	return labelled && line[size] == ' '
+}
+
+// addContext fills in the unconflicted lines around each hunk
+func addContext(hunks []interfaces.ConflictHunk, lines []string, contextLines int) {
+	if contextLines <= 0 {
+		return
+	}
+
+	for i := range hunks {
+		// Line numbers are 1-based, slice indexes 0-based
+		lower := 0
+		if i > 0 {
+			lower = hunks[i-1].EndLine
+		}
+		upper := len(lines)
+		if i < len(hunks)-1 {
+			upper = hunks[i+1].StartLine - 1
+		}
+
+		from := max(lower, hunks[i].StartLine-1-contextLines)
+		to := min(upper, hunks[i].EndLine+contextLines)
+
+		hunks[i].Before = strings.Join(lines[from:hunks[i].StartLine-1], "\n")
+		hunks[i].After = strings.Join(lines[hunks[i].EndLine:to], "\n")
+	}
+}
+
+// JoinSides concatenates one side of all hunks, separating hunks by a newline
+func JoinSides(hunks []interfaces.ConflictHunk) (ours, theirs string) {
+	oursParts := make([]string, len(hunks))
+	theirsParts := make([]string, len(hunks))
+	for i, hunk := range hunks {
+		oursParts[i] = hunk.Ours
+		theirsParts[i] = hunk.Theirs
+	}
+	return strings.Join(oursParts, "\n"), strings.Join(theirsParts, "\n")
+}
+
+// Splice replaces every hunk of content with its resolution and returns the
+// reassembled file. hunks must come from Parse on the same content and
+// resolutions must match them by index. Lines outside the hunks are copied
+// unchanged, and resolutions follow the CRLF line endings of the file.
+func Splice(content string, hunks []interfaces.ConflictHunk, resolutions []string) (string, error) {
+	if len(hunks) != len(resolutions) {
+		return "", fmt.Errorf("got %d resolutions for %d hunks", len(resolutions), len(hunks))
+	}
+
+	lines := strings.Split(content, "\n")
+	result := make([]string, 0, len(lines))
+	next := 0
+
+	for i, hunk := range hunks {
+		start, end := hunk.StartLine-1, hunk.EndLine
+		if start < next || end > len(lines) || start >= end {
+			return "", fmt.Errorf("hunk %d has invalid line range %d-%d", i+1, hunk.StartLine, hunk.EndLine)
+		}
+
+		result = append(result, lines[next:start]...)
+
+		if resolutions[i] != "" {
+			crlf := strings.HasSuffix(lines[start], "\r")
+			for _, line := range strings.Split(strings.TrimSuffix(resolutions[i], "\n"), "\n") {
+				if crlf && !strings.HasSuffix(line, "\r") {
+					line += "\r"
+				}
+				result = append(result, line)
+			}
+		}
+
+		next = end
+	}
+
+	result = append(result, lines[next:]...)
+	return strings.Join(result, "\n"), nil
+}
@@ -0,0 +1,144 @@
+package markers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_TwoWayConflict(t *testing.T) {
+	content := "package main\n<<<<<<< HEAD\nupstream line\n=======\ninternal line\n>>>>>>> 1a2b3c4 (internal change)\nfunc main() {}\n"
+
+	hunks, err := Parse(content, DefaultSize, 3)
+	require.NoError(t, err)
+	require.Len(t, hunks, 1)
+
+	assert.Equal(t, 2, hunks[0].StartLine)
+	assert.Equal(t, 6, hunks[0].EndLine)
+	assert.Equal(t, "upstream line", hunks[0].Ours)
+	assert.Equal(t, "", hunks[0].Base)
+	assert.Equal(t, "internal line", hunks[0].Theirs)
+	assert.Equal(t, "package main", hunks[0].Before)
+	assert.Equal(t, "func main() {}\n", hunks[0].After)
+}
+
+func TestParse_Zdiff3BaseSection(t *testing.T) {
+	content := "<<<<<<< HEAD\nvalue = 2\n||||||| parent of 1a2b3c4 (tune value)\nvalue = 1\n=======\nvalue = 3\n>>>>>>> 1a2b3c4 (tune value)\n"
+
+	hunks, err := Parse(content, DefaultSize, 0)
+	require.NoError(t, err)
+	require.Len(t, hunks, 1)
+
+	assert.Equal(t, "value = 2", hunks[0].Ours)
+	assert.Equal(t, "value = 1", hunks[0].Base)
+	assert.Equal(t, "value = 3", hunks[0].Theirs)
+	assert.Empty(t, hunks[0].Before)
+	assert.Empty(t, hunks[0].After)
+}
+
+func TestParse_MultipleHunksKeepContextApart(t *testing.T) {
+	content := "a\nb\n<<<<<<< HEAD\nc1\n=======\nc2\n>>>>>>> x\nd\n<<<<<<< HEAD\ne1\ne2\n=======\n>>>>>>> x\nf\ng\n"
+
+	hunks, err := Parse(content, DefaultSize, 5)
+	require.NoError(t, err)
+	require.Len(t, hunks, 2)
+
+	assert.Equal(t, 3, hunks[0].StartLine)
+	assert.Equal(t, 7, hunks[0].EndLine)
+	assert.Equal(t, "a\nb", hunks[0].Before)
+	assert.Equal(t, "d", hunks[0].After)
+
+	assert.Equal(t, 9, hunks[1].StartLine)
+	assert.Equal(t, 13, hunks[1].EndLine)
+	assert.Equal(t, "e1\ne2", hunks[1].Ours)
+	assert.Equal(t, "", hunks[1].Theirs)
+	assert.Equal(t, "d", hunks[1].Before)
+	assert.Equal(t, "f\ng\n", hunks[1].After)
+}
+
+func TestParse_CustomMarkerSize(t *testing.T) {
+	content := "<<<<<<<<<< HEAD\n<<<<<<< not a marker\n=======\n==========\n>>>>>>> still content\n>>>>>>>>>> x\n"
+
+	hunks, err := Parse(content, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, hunks, 1)
+
+	assert.Equal(t, "<<<<<<< not a marker\n=======", hunks[0].Ours)
+	assert.Equal(t, ">>>>>>> still content", hunks[0].Theirs)
+}
+
+func TestParse_CRLFLineEndings(t *testing.T) {
+	content := "<<<<<<< HEAD\r\nours\r\n=======\r\ntheirs\r\n>>>>>>> x\r\n"
+
+	hunks, err := Parse(content, DefaultSize, 0)
+	require.NoError(t, err)
+	require.Len(t, hunks, 1)
+
+	assert.Equal(t, "ours\r", hunks[0].Ours)
+	assert.Equal(t, "theirs\r", hunks[0].Theirs)
+}
+
+func TestParse_NoConflicts(t *testing.T) {
+	hunks, err := Parse("just\nsome\ncode\n", DefaultSize, 3)
+	require.NoError(t, err)
+	assert.Empty(t, hunks)
+}
+
+func TestParse_Errors(t *testing.T) {
+	_, err := Parse("<<<<<<< HEAD\nours\n=======\ntheirs\n", DefaultSize, 0)
+	assert.ErrorContains(t, err, "unterminated")
+
+	_, err = Parse("<<<<<<< HEAD\n<<<<<<< HEAD\n", DefaultSize, 0)
+	assert.ErrorContains(t, err, "nested")
+}
+
+func TestJoinSides(t *testing.T) {
+	hunks, err := Parse("<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n<<<<<<< HEAD\nc\n=======\nd\n>>>>>>> x\n", DefaultSize, 0)
+	require.NoError(t, err)
+
+	ours, theirs := JoinSides(hunks)
+	assert.Equal(t, "a\nc", ours)
+	assert.Equal(t, "b\nd", theirs)
+}
+
+func TestSplice(t *testing.T) {
+	content := "keep 1\n<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\nkeep 2\n<<<<<<< HEAD\nc\n=======\nd\n>>>>>>> x\nkeep 3\n"
+
+	hunks, err := Parse(content, DefaultSize, 2)
+	require.NoError(t, err)
+
+	merged, err := Splice(content, hunks, []string{"a\nb", "cd\n"})
+	require.NoError(t, err)
+	assert.Equal(t, "keep 1\na\nb\nkeep 2\ncd\nkeep 3\n", merged)
+}
+
+func TestSplice_EmptyResolutionRemovesHunk(t *testing.T) {
+	content := "keep\n<<<<<<< HEAD\na\n=======\n>>>>>>> x\nkeep\n"
+
+	hunks, err := Parse(content, DefaultSize, 0)
+	require.NoError(t, err)
+
+	merged, err := Splice(content, hunks, []string{""})
+	require.NoError(t, err)
+	assert.Equal(t, "keep\nkeep\n", merged)
+}
+
+func TestSplice_KeepsCRLFLineEndings(t *testing.T) {
+	content := "keep\r\n<<<<<<< HEAD\r\na\r\n=======\r\nb\r\n>>>>>>> x\r\nkeep\r\n"
+
+	hunks, err := Parse(content, DefaultSize, 0)
+	require.NoError(t, err)
+
+	merged, err := Splice(content, hunks, []string{"a\nb"})
+	require.NoError(t, err)
+	assert.Equal(t, "keep\r\na\r\nb\r\nkeep\r\n", merged)
+}
+
+func TestSplice_ResolutionCountMismatch(t *testing.T) {
+	hunks, err := Parse("<<<<<<< HEAD\na\n=======\nb\n>>>>>>> x\n", DefaultSize, 0)
+	require.NoError(t, err)
+
+	_, err = Splice("", hunks, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,346 @@
+// Package memory keeps the conflicts of past rebases together with the
+// resolutions that were finally merged, so similar conflicts can be resolved
+// the same way again.
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// maxCases bounds the size of the store, the oldest cases are forgotten first
+const maxCases = 1000
+
+// minSimilarity is the score from which a past case is similar enough to be
+// worth showing
+const minSimilarity = 0.5
+
+// Case is a single conflict hunk and its resolution
+type Case struct {
+	File   string `json:"file"`
+	Base   string `json:"base,omitempty"`
+	Ours   string `json:"ours"`
+	Theirs string `json:"theirs"`
+	// Before and After are the lines around the hunk, used to find the
+	// resolution in the merged file
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+	// Resolution is the merged code that replaced the hunk, empty while the
+	// PR is pending
+	Resolution string    `json:"resolution,omitempty"`
+	PR         int       `json:"pr"`
+	Learned    time.Time `json:"learned"`
+}
+
+// Pending are the cases of a PR that was not merged yet
+type Pending struct {
+	PR    int    `json:"pr"`
+	Cases []Case `json:"cases"`
+}
+
+type storeData struct {
+	Cases   []Case    `json:"cases"`
+	Pending []Pending `json:"pending"`
+}
+
+// Store is a JSON file of past cases. It is safe for concurrent use, and a
+// nil Store remembers nothing.
+type Store struct {
+	path string
+
+	mu   sync.Mutex
+	data storeData
+}
+
+// Open loads the store at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	store := &Store{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resolution memory: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &store.data); err != nil {
+		return nil, fmt.Errorf("failed to parse resolution memory %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// Save writes the store back to its file. The file is replaced atomically so
+// an interrupted run does not lose what was learned before.
+func (s *Store) Save() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode resolution memory: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write resolution memory: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write resolution memory: %w", err)
+	}
+	return nil
+}
+
+// SetPending remembers the cases of a PR until it is merged or closed. They
+// replace the cases remembered for an earlier version of the PR, which no
+// longer has their conflicts.
+func (s *Store) SetPending(pr int, cases []Case) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forget(pr)
+	if len(cases) > 0 {
+		s.data.Pending = append(s.data.Pending, Pending{PR: pr, Cases: cases})
+	}
+}
+
+// Pending returns the PRs whose cases wait for their outcome
+func (s *Store) Pending() []Pending {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Pending(nil), s.data.Pending...)
+}
+
+// Learn stores the resolved cases of a merged PR and stops waiting for it.
+// Cases without a resolution are dropped.
+func (s *Store) Learn(pr int, cases []Case) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forget(pr)
+
+	now := time.Now()
+	for _, c := range cases {
+		if c.Resolution == "" {
+			continue
+		}
+		c.PR = pr
+		c.Learned = now
+		s.data.Cases = append(s.data.Cases, c)
+	}
+	if excess := len(s.data.Cases) - maxCases; excess > 0 {
+		s.data.Cases = s.data.Cases[excess:]
+	}
+}
+
+// Forget stops waiting for a PR that was closed without being merged
+func (s *Store) Forget(pr int) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forget(pr)
+}
+
+func (s *Store) forget(pr int) {
+	pending := s.data.Pending[:0]
+	for _, p := range s.data.Pending {
+		if p.PR != pr {
+			pending = append(pending, p)
+		}
+	}
+	s.data.Pending = pending
+}
+
+// Similar returns up to n past cases most similar to a conflict, the most
+// similar first. code is the conflicting code of both sides. Cases in the same
+// file rank above cases in related files, and cases whose code shares more
+// words rank higher.
+func (s *Store) Similar(file, code string, n int) []Case {
+	if s == nil || n <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	cases := append([]Case(nil), s.data.Cases...)
+	s.mu.Unlock()
+
+	type scored struct {
+		c     Case
+		score float64
+		index int
+	}
+	words := wordSet(code)
+	var candidates []scored
+	for i, c := range cases {
+		score := pathSimilarity(c.File, file) + jaccard(wordSet(c.Ours+"\n"+c.Theirs), words)
+		if score >= minSimilarity {
+			candidates = append(candidates, scored{c: c, score: score, index: i})
+		}
+	}
+
+	// Newer cases win ties, they reflect the current code best
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].index > candidates[j].index
+	})
+
+	similar := make([]Case, 0, min(n, len(candidates)))
+	for _, candidate := range candidates[:min(n, len(candidates))] {
+		similar = append(similar, candidate.c)
+	}
+	return similar
+}
+
+// pathSimilarity rates how related two files are: the same file, a file of
+// the same name or in the same directory, or unrelated
+func pathSimilarity(a, b string) float64 {
+	switch {
+	case a == b:
+		return 0.5
+	case path.Base(a) == path.Base(b) || path.Dir(a) == path.Dir(b):
+		return 0.25
+	}
+	return 0
+}
+
+// wordSet returns the identifiers and numbers of code
+func wordSet(code string) map[string]bool {
+	words := map[string]bool{}
+	for _, word := range strings.FieldsFunc(code, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		words[word] = true
+	}
+	return words
+}
+
+// jaccard returns the share of words two sets have in common
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// anchorLines is the number of lines around a hunk that must at least match
+// to find its resolution in the merged file
+const anchorLines = 3
+
+// ExtractResolution finds the code that replaced the hunk of a case in the
+// merged content of its file. The hunk is located by the lines around it, it
+// is not found if they changed as well or do not point to a single place.
+func ExtractResolution(content string, c Case) (string, bool) {
+	lines := strings.Split(content, "\n")
+	before := contextLines(c.Before)
+	after := contextLines(c.After)
+
+	start := 0
+	if len(before) > 0 {
+		index, ok := findAnchor(lines, before, true, 0)
+		if !ok {
+			return "", false
+		}
+		start = index
+	}
+
+	end := len(lines)
+	if len(after) > 0 {
+		index, ok := findAnchor(lines, after, false, start)
+		if !ok {
+			return "", false
+		}
+		end = index
+	}
+
+	resolution := strings.Join(lines[start:end], "\n")
+	if strings.TrimSpace(resolution) == "" {
+		return "", false
+	}
+	return resolution, true
+}
+
+// findAnchor finds the context of a hunk in lines from start on. It uses the
+// last lines of the context before the hunk or the first lines of the context
+// after it, as many as are needed to point to a single place. It returns the
+// line where the hunk ends or begins.
+func findAnchor(lines, context []string, before bool, start int) (int, bool) {
+	for n := min(anchorLines, len(context)); n <= len(context); n++ {
+		anchor := context[:n]
+		if before {
+			anchor = context[len(context)-n:]
+		}
+
+		index, count := findLines(lines, anchor, start)
+		switch {
+		case count == 0:
+			return 0, false
+		case count == 1 && before:
+			return index + n, true
+		case count == 1:
+			return index, true
+		}
+	}
+	return 0, false
+}
+
+// findLines returns the index of the first occurrence of want in lines from
+// start on and the number of occurrences
+func findLines(lines, want []string, start int) (int, int) {
+	first, count := -1, 0
+	for i := start; i+len(want) <= len(lines); i++ {
+		if slices.Equal(lines[i:i+len(want)], want) {
+			if count == 0 {
+				first = i
+			}
+			count++
+		}
+	}
+	return first, count
+}
+
+// contextLines splits the context of a hunk into lines. A trailing newline at
+// the end of the file does not count as a line.
+func contextLines(text string) []string {
+	if text = strings.TrimSuffix(text, "\n"); text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_LearnAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "resolutions.json")
+
+	store, err := Open(path)
+	require.NoError(t, err)
+	store.SetPending(7, []Case{{File: "src/gpio.c", Ours: "a", Theirs: "b"}})
+	store.SetPending(8, []Case{{File: "src/soc.c", Ours: "c", Theirs: "d"}})
+	require.NoError(t, store.Save())
+
+	store, err = Open(path)
+	require.NoError(t, err)
+	require.Len(t, store.Pending(), 2)
+
+	store.Learn(7, []Case{
+		{File: "src/gpio.c", Ours: "a", Theirs: "b", Resolution: "ab"},
+		{File: "src/gpio.c", Ours: "x", Theirs: "y"},
+	})
+	store.Forget(8)
+	require.NoError(t, store.Save())
+
+	store, err = Open(path)
+	require.NoError(t, err)
+	assert.Empty(t, store.Pending())
+
+	similar := store.Similar("src/gpio.c", "a\nb", 3)
+	require.Len(t, similar, 1)
+	assert.Equal(t, "ab", similar[0].Resolution)
+	assert.Equal(t, 7, similar[0].PR)
+}
+
+func TestStore_SetPendingReplaces(t *testing.T) {
+	store := &Store{}
+	store.SetPending(7, []Case{{File: "src/gpio.c", Ours: "a", Theirs: "b"}})
+	store.SetPending(8, []Case{{File: "src/soc.c", Ours: "c", Theirs: "d"}})
+
+	// PR 7 was updated with other conflicts
+	store.SetPending(7, []Case{{File: "src/uart.c", Ours: "e", Theirs: "f"}})
+	pending := store.Pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, 8, pending[0].PR)
+	assert.Equal(t, []Case{{File: "src/uart.c", Ours: "e", Theirs: "f"}}, pending[1].Cases)
+
+	// and then without any
+	store.SetPending(7, nil)
+	pending = store.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, 8, pending[0].PR)
+}
+
+func TestStore_Nil(t *testing.T) {
+	var store *Store
+	store.SetPending(1, []Case{{File: "a.c"}})
+	store.Learn(1, nil)
+	assert.Nil(t, store.Similar("a.c", "a\nb", 3))
+	assert.NoError(t, store.Save())
+}
+
+func TestStore_Similar(t *testing.T) {
+	store := &Store{data: storeData{Cases: []Case{
+		{File: "src/soc/gpio.c", Ours: "pad_cfg(GPP_A1, NATIVE)", Theirs: "pad_cfg(GPP_A1, GPIO)", Resolution: "old"},
+		{File: "docs/README", Ours: "pad_cfg GPP_A2 NATIVE", Theirs: "GPIO", Resolution: "docs"},
+		{File: "src/soc/uart.c", Ours: "uart_init(0)", Theirs: "uart_init(1)", Resolution: "uart"},
+		{File: "src/soc/gpio.c", Ours: "pad_cfg(GPP_A1, NATIVE)", Theirs: "pad_cfg(GPP_A1, GPIO)", Resolution: "new"},
+	}}}
+
+	similar := store.Similar("src/soc/gpio.c", "pad_cfg(GPP_A2, NATIVE)\npad_cfg(GPP_A2, GPIO)", 3)
+
+	var resolutions []string
+	for _, c := range similar {
+		resolutions = append(resolutions, c.Resolution)
+	}
+	// The same file ranks first with newer cases ahead, unrelated code in
+	// the same directory is not similar enough but the same code elsewhere is
+	assert.Equal(t, []string{"new", "old", "docs"}, resolutions)
+}
+
+func TestExtractResolution(t *testing.T) {
+	content := "package main\n\nimport \"fmt\"\n\nfunc a() {\n\tfmt.Println(\"merged\")\n}\n\nfunc b() {\n}\n"
+
+	tests := map[string]struct {
+		c    Case
+		want string
+		ok   bool
+	}{
+		"between context": {
+			c:    Case{Before: "import \"fmt\"\n\nfunc a() {", After: "}\n\nfunc b() {\n}\n"},
+			want: "\tfmt.Println(\"merged\")",
+			ok:   true,
+		},
+		"start of file": {
+			c:    Case{After: "\nimport \"fmt\""},
+			want: "package main",
+			ok:   true,
+		},
+		"context changed": {
+			c: Case{Before: "func c() {", After: "}"},
+		},
+		"ambiguous context": {
+			// "}" occurs twice and there is no more context
+			c: Case{Before: "}"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := ExtractResolution(content, tt.c)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
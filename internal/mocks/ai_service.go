@@ -12,9 +12,16 @@ type MockAIService struct {
 	mock.Mock
 }
 
-func (m *MockAIService) ResolveConflict(ctx context.Context, conflict interfaces.GitConflict) (string, error) {
+func (m *MockAIService) ResolveConflict(ctx context.Context, conflict interfaces.GitConflict) (*interfaces.ConflictResolution, error) {
 	args := m.Called(ctx, conflict)
-	return args.String(0), args.Error(1)
+	resolution, _ := args.Get(0).(*interfaces.ConflictResolution)
+	return resolution, args.Error(1)
+}
+
+func (m *MockAIService) ResolveConflictHunk(ctx context.Context, conflict interfaces.GitConflict, hunk interfaces.ConflictHunk) (*interfaces.ConflictResolution, error) {
+	args := m.Called(ctx, conflict, hunk)
+	resolution, _ := args.Get(0).(*interfaces.ConflictResolution)
+	return resolution, args.Error(1)
 }
 
 func (m *MockAIService) GenerateCommitMessage(ctx context.Context, changes []string) (string, error) {
@@ -30,4 +37,15 @@ func (m *MockAIService) GenerateCommitMessageWithConflicts(ctx context.Context,
 func (m *MockAIService) GeneratePRDescription(ctx context.Context, commits []string, conflicts []interfaces.GitConflict) (string, error) {
 	args := m.Called(ctx, commits, conflicts)
 	return args.String(0), args.Error(1)
+}
+
+func (m *MockAIService) RepairBuild(ctx context.Context, request interfaces.RepairRequest) (string, error) {
+	args := m.Called(ctx, request)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockAIService) ReviewRebase(ctx context.Context, request interfaces.ReviewRequest) ([]interfaces.ReviewFinding, error) {
+	args := m.Called(ctx, request)
+	findings, _ := args.Get(0).([]interfaces.ReviewFinding)
+	return findings, args.Error(1)
 }
\ No newline at end of file
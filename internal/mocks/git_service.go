@@ -17,6 +17,16 @@ func (m *MockGitService) Clone(ctx context.Context, repo, dir string) error {
 	return args.Error(0)
 }
 
+func (m *MockGitService) UpdateMirror(ctx context.Context, dir, repo string, remotes map[string]string) error {
+	args := m.Called(ctx, dir, repo, remotes)
+	return args.Error(0)
+}
+
+func (m *MockGitService) CloneShared(ctx context.Context, mirror, repo, dir string) error {
+	args := m.Called(ctx, mirror, repo, dir)
+	return args.Error(0)
+}
+
 func (m *MockGitService) Fetch(ctx context.Context, dir string) error {
 	args := m.Called(ctx, dir)
 	return args.Error(0)
@@ -27,6 +37,26 @@ func (m *MockGitService) Rebase(ctx context.Context, dir, branch string) error {
 	return args.Error(0)
 }
 
+func (m *MockGitService) ContinueRebase(ctx context.Context, dir string) error {
+	args := m.Called(ctx, dir)
+	return args.Error(0)
+}
+
+func (m *MockGitService) AbortRebase(ctx context.Context, dir string) error {
+	args := m.Called(ctx, dir)
+	return args.Error(0)
+}
+
+func (m *MockGitService) SkipCommit(ctx context.Context, dir string) error {
+	args := m.Called(ctx, dir)
+	return args.Error(0)
+}
+
+func (m *MockGitService) RebaseInProgress(ctx context.Context, dir string) (bool, error) {
+	args := m.Called(ctx, dir)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockGitService) GetConflicts(ctx context.Context, dir string) ([]interfaces.GitConflict, error) {
 	args := m.Called(ctx, dir)
 	return args.Get(0).([]interfaces.GitConflict), args.Error(1)
@@ -37,16 +67,41 @@ func (m *MockGitService) ResolveConflict(ctx context.Context, dir, file, resolut
 	return args.Error(0)
 }
 
+func (m *MockGitService) CheckoutSide(ctx context.Context, dir, file string, side interfaces.ConflictSide) error {
+	args := m.Called(ctx, dir, file, side)
+	return args.Error(0)
+}
+
+func (m *MockGitService) RemoveFile(ctx context.Context, dir, file string) error {
+	args := m.Called(ctx, dir, file)
+	return args.Error(0)
+}
+
+func (m *MockGitService) StageFile(ctx context.Context, dir, file string) error {
+	args := m.Called(ctx, dir, file)
+	return args.Error(0)
+}
+
 func (m *MockGitService) Commit(ctx context.Context, dir, message string) error {
 	args := m.Called(ctx, dir, message)
 	return args.Error(0)
 }
 
+func (m *MockGitService) ApplyPatch(ctx context.Context, dir, patch string) error {
+	args := m.Called(ctx, dir, patch)
+	return args.Error(0)
+}
+
 func (m *MockGitService) Push(ctx context.Context, dir, branch string) error {
 	args := m.Called(ctx, dir, branch)
 	return args.Error(0)
 }
 
+func (m *MockGitService) ForcePush(ctx context.Context, dir, localBranch, remoteBranch, expectedSHA string) error {
+	args := m.Called(ctx, dir, localBranch, remoteBranch, expectedSHA)
+	return args.Error(0)
+}
+
 func (m *MockGitService) CreateBranch(ctx context.Context, dir, branch string) error {
 	args := m.Called(ctx, dir, branch)
 	return args.Error(0)
@@ -60,4 +115,40 @@ func (m *MockGitService) GetStatus(ctx context.Context, dir string) (interfaces.
 func (m *MockGitService) AddRemote(ctx context.Context, dir, name, url string) error {
 	args := m.Called(ctx, dir, name, url)
 	return args.Error(0)
+}
+
+func (m *MockGitService) SetConfig(ctx context.Context, dir, key, value string) error {
+	args := m.Called(ctx, dir, key, value)
+	return args.Error(0)
+}
+
+func (m *MockGitService) Diff(ctx context.Context, dir, from, to string, files []string) (string, error) {
+	args := m.Called(ctx, dir, from, to, files)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockGitService) ShowFile(ctx context.Context, dir, rev, file string) (string, error) {
+	args := m.Called(ctx, dir, rev, file)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockGitService) EnableRerere(ctx context.Context, dir, cacheDir, seed string) error {
+	args := m.Called(ctx, dir, cacheDir, seed)
+	return args.Error(0)
+}
+
+func (m *MockGitService) ClearRerere(ctx context.Context, dir string) error {
+	args := m.Called(ctx, dir)
+	return args.Error(0)
+}
+
+func (m *MockGitService) RemoteHead(ctx context.Context, repo, branch string) (string, error) {
+	args := m.Called(ctx, repo, branch)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockGitService) CommitsByOthers(ctx context.Context, dir, base, head string) ([]string, error) {
+	args := m.Called(ctx, dir, base, head)
+	commits, _ := args.Get(0).([]string)
+	return commits, args.Error(1)
 }
\ No newline at end of file
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 
@@ -17,8 +18,8 @@ func (m *MockGitHubService) CreatePullRequest(ctx context.Context, req interface
 	return args.Get(0).(*interfaces.PullRequest), args.Error(1)
 }
 
-func (m *MockGitHubService) MergePullRequest(ctx context.Context, prNumber int) error {
-	args := m.Called(ctx, prNumber)
+func (m *MockGitHubService) MergePullRequest(ctx context.Context, prNumber int, method string) error {
+	args := m.Called(ctx, prNumber, method)
 	return args.Error(0)
 }
 
@@ -35,4 +36,39 @@ func (m *MockGitHubService) ListPullRequests(ctx context.Context, state string)
 func (m *MockGitHubService) AddReviewers(ctx context.Context, prNumber int, reviewers []string) error {
 	args := m.Called(ctx, prNumber, reviewers)
 	return args.Error(0)
+}
+
+func (m *MockGitHubService) UpdatePullRequest(ctx context.Context, prNumber int, title, body string) (*interfaces.PullRequest, error) {
+	args := m.Called(ctx, prNumber, title, body)
+	return args.Get(0).(*interfaces.PullRequest), args.Error(1)
+}
+
+func (m *MockGitHubService) ClosePullRequest(ctx context.Context, prNumber int, comment string) error {
+	args := m.Called(ctx, prNumber, comment)
+	return args.Error(0)
+}
+
+func (m *MockGitHubService) ChangesRequested(ctx context.Context, prNumber int) (bool, error) {
+	args := m.Called(ctx, prNumber)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockGitHubService) LastActivity(ctx context.Context, prNumber int, headSHA string) (time.Time, error) {
+	args := m.Called(ctx, prNumber, headSHA)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockGitHubService) CommentedByOthers(ctx context.Context, prNumber int, author string) (bool, error) {
+	args := m.Called(ctx, prNumber, author)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockGitHubService) CheckState(ctx context.Context, ref string) (interfaces.CheckState, error) {
+	args := m.Called(ctx, ref)
+	return args.Get(0).(interfaces.CheckState), args.Error(1)
+}
+
+func (m *MockGitHubService) ContainsCommit(ctx context.Context, ref, sha string) (bool, error) {
+	args := m.Called(ctx, ref, sha)
+	return args.Bool(0), args.Error(1)
 }
\ No newline at end of file
@@ -120,6 +120,11 @@ func (s *Service) createSlackPayload(message interfaces.NotificationMessage) Sla
 		IconEmoji:   s.getEmojiForLevel(message.Level),
 		Attachments: []SlackAttachment{attachment},
 	}
+
+	// Mention the channel so the message is not missed
+	if message.ActionRequired {
+		payload.Text = "<!here> :rotating_light: *Action required*"
+	}
 	
 	return payload
 }
@@ -82,6 +82,22 @@ func TestService_createSlackPayload(t *testing.T) {
 	assert.Equal(t, "This is a test message", attachment.Text)
 	assert.Equal(t, "AI Rebaser", attachment.Footer)
 	assert.Greater(t, attachment.Timestamp, int64(0))
+	assert.Empty(t, payload.Text)
+}
+
+func TestService_createSlackPayload_ActionRequired(t *testing.T) {
+	service := &Service{channel: "#test-channel"}
+
+	payload := service.createSlackPayload(interfaces.NotificationMessage{
+		Title:          "AI Rebaser - Action Required",
+		Message:        "Draft PR #7 needs a human",
+		Level:          interfaces.NotificationLevelWarning,
+		ActionRequired: true,
+	})
+
+	assert.Contains(t, payload.Text, "<!here>")
+	assert.Contains(t, payload.Text, "Action required")
+	assert.Equal(t, ":warning:", payload.IconEmoji)
 }
 
 func TestService_getColorForLevel(t *testing.T) {
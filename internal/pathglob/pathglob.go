@@ -0,0 +1,57 @@
+// Package pathglob matches slash separated repository paths against glob
+// patterns in the style of .gitattributes.
+package pathglob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether file matches pattern. Each path segment is matched with
+// path.Match, and a "**" segment matches any number of directories. A pattern
+// without a slash matches the base name of file in any directory.
+func Match(pattern, file string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	file = strings.TrimPrefix(file, "/")
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(file))
+		return ok
+	}
+
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(file, "/"))
+}
+
+// Valid reports whether pattern is well formed
+func Valid(pattern string) bool {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func matchSegments(pattern, file []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try to let ** swallow zero or more segments
+			for skip := 0; skip <= len(file); skip++ {
+				if matchSegments(pattern[1:], file[skip:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(file) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], file[0]); !ok {
+			return false
+		}
+		pattern, file = pattern[1:], file[1:]
+	}
+
+	return len(file) == 0
+}
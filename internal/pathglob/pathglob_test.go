@@ -0,0 +1,37 @@
+package pathglob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{"*.bin", "3rdparty/blobs/cpu/microcode.bin", true},
+		{"*.bin", "src/cpu/microcode.c", false},
+		{"go.sum", "tools/go.sum", true},
+		{"3rdparty/blobs/**", "3rdparty/blobs/soc/intel/fsp.fd", true},
+		{"3rdparty/blobs/**", "3rdparty/other/fsp.fd", false},
+		{"src/**/vbt.bin", "src/mainboard/acme/board/vbt.bin", true},
+		{"src/**/vbt.bin", "src/vbt.bin", true},
+		{"src/*/vbt.bin", "src/mainboard/acme/vbt.bin", false},
+		{"/build/generated/*.h", "build/generated/config.h", true},
+		{"**/static.c", "build/static.c", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.file, func(t *testing.T) {
+			assert.Equal(t, tt.want, Match(tt.pattern, tt.file))
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid("src/**/*.[ch]"))
+	assert.False(t, Valid("src/[a-"))
+}
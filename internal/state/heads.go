@@ -0,0 +1,63 @@
+// Package state records the upstream and internal commits the last successful
+// rebase started from, so runs with nothing new to rebase can be skipped.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Heads are the commits the branch pointed to in both repositories
+type Heads struct {
+	Upstream string    `json:"upstream"`
+	Internal string    `json:"internal"`
+	Rebased  time.Time `json:"rebased,omitempty"`
+}
+
+// Read returns the heads recorded at path, nil if none were recorded yet
+func Read(path string) (*Heads, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rebase state: %w", err)
+	}
+
+	var heads Heads
+	if err := json.Unmarshal(data, &heads); err != nil {
+		return nil, fmt.Errorf("failed to parse rebase state %s: %w", path, err)
+	}
+	return &heads, nil
+}
+
+// Write records heads at path. The file is replaced at once, so a crash
+// never leaves half of it behind.
+func Write(path string, heads Heads) error {
+	data, err := json.MarshalIndent(heads, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode rebase state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write rebase state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write rebase state: %w", err)
+	}
+	return nil
+}
+
+// Unchanged reports if both repositories are still at the recorded heads. A
+// nil Heads never matches.
+func (h *Heads) Unchanged(upstream, internal string) bool {
+	return h != nil && h.Upstream == upstream && h.Internal == internal
+}
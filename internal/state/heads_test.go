@@ -0,0 +1,46 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "last-rebase.json")
+
+	heads, err := Read(path)
+	require.NoError(t, err)
+	assert.Nil(t, heads)
+
+	rebased := time.Date(2025, 10, 6, 9, 0, 0, 0, time.UTC)
+	require.NoError(t, Write(path, Heads{Upstream: "aaa", Internal: "bbb", Rebased: rebased}))
+
+	heads, err = Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, &Heads{Upstream: "aaa", Internal: "bbb", Rebased: rebased}, heads)
+	assert.NoFileExists(t, path+".tmp")
+}
+
+func TestRead_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last-rebase.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+
+	_, err := Read(path)
+	assert.ErrorContains(t, err, path)
+}
+
+func TestUnchanged(t *testing.T) {
+	heads := &Heads{Upstream: "aaa", Internal: "bbb"}
+
+	assert.True(t, heads.Unchanged("aaa", "bbb"))
+	assert.False(t, heads.Unchanged("ccc", "bbb"))
+	assert.False(t, heads.Unchanged("aaa", "ccc"))
+
+	var none *Heads
+	assert.False(t, none.Unchanged("", ""))
+}
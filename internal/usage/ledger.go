@@ -0,0 +1,202 @@
+// Package usage accounts the tokens and cost of the AI calls of a run and
+// enforces per-run limits on them.
+package usage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrLimitExceeded is returned once a run has used up its token or cost limit
+var ErrLimitExceeded = errors.New("AI usage limit of the run reached")
+
+// Price is the cost of a model in US dollars per million tokens. Prompt cache
+// reads and writes default to a tenth and five fourths of the input price,
+// what Anthropic charges.
+type Price struct {
+	Input      float64
+	Output     float64
+	CacheRead  float64
+	CacheWrite float64
+}
+
+// Default multipliers of the input price for prompt cache tokens
+const (
+	cacheReadFactor  = 0.1
+	cacheWriteFactor = 1.25
+)
+
+// cost returns the cost of a call in US dollars
+func (p Price) cost(record Record) float64 {
+	cacheRead, cacheWrite := p.CacheRead, p.CacheWrite
+	if cacheRead == 0 {
+		cacheRead = p.Input * cacheReadFactor
+	}
+	if cacheWrite == 0 {
+		cacheWrite = p.Input * cacheWriteFactor
+	}
+
+	uncached := record.InputTokens - record.CacheReadTokens - record.CacheWriteTokens
+	return (float64(uncached)*p.Input +
+		float64(record.CacheReadTokens)*cacheRead +
+		float64(record.CacheWriteTokens)*cacheWrite +
+		float64(record.OutputTokens)*p.Output) / 1e6
+}
+
+// Limits caps the usage of a run. Zero values are unlimited.
+type Limits struct {
+	MaxCost   float64
+	MaxTokens int
+}
+
+// Record is the usage of a single AI call
+type Record struct {
+	Operation    string
+	File         string
+	Provider     string
+	Model        string
+	InputTokens  int
+	OutputTokens int
+	// Prompt cache tokens are part of InputTokens but priced on their own
+	CacheReadTokens  int
+	CacheWriteTokens int
+	// Cost is in US dollars, zero for models without a price
+	Cost float64
+}
+
+// Totals sums up the usage of a number of calls
+type Totals struct {
+	Calls            int
+	InputTokens      int
+	OutputTokens     int
+	CacheReadTokens  int
+	CacheWriteTokens int
+	Cost             float64
+}
+
+// Tokens returns the input and output tokens
+func (t Totals) Tokens() int {
+	return t.InputTokens + t.OutputTokens
+}
+
+func (t *Totals) add(record Record) {
+	t.Calls++
+	t.InputTokens += record.InputTokens
+	t.OutputTokens += record.OutputTokens
+	t.CacheReadTokens += record.CacheReadTokens
+	t.CacheWriteTokens += record.CacheWriteTokens
+	t.Cost += record.Cost
+}
+
+// Ledger records the AI calls of a run. It is safe for concurrent use, and a
+// nil Ledger records nothing and has no limits.
+type Ledger struct {
+	prices map[string]Price
+	limits Limits
+
+	mu      sync.Mutex
+	records []Record
+}
+
+// NewLedger creates a ledger that prices calls by model name
+func NewLedger(prices map[string]Price, limits Limits) *Ledger {
+	return &Ledger{prices: prices, limits: limits}
+}
+
+// Reset forgets all records, for the start of a new run
+func (l *Ledger) Reset() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = nil
+}
+
+// Record adds a call to the ledger and returns it with its cost
+func (l *Ledger) Record(record Record) Record {
+	if l == nil {
+		return record
+	}
+
+	if price, ok := l.prices[record.Model]; ok {
+		record.Cost = price.cost(record)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, record)
+	return record
+}
+
+// Check returns ErrLimitExceeded if the run has reached one of its limits
+func (l *Ledger) Check() error {
+	if l == nil {
+		return nil
+	}
+
+	totals := l.Totals()
+	if l.limits.MaxTokens > 0 && totals.Tokens() >= l.limits.MaxTokens {
+		return fmt.Errorf("%w: %d of %d tokens used", ErrLimitExceeded, totals.Tokens(), l.limits.MaxTokens)
+	}
+	if l.limits.MaxCost > 0 && totals.Cost >= l.limits.MaxCost {
+		return fmt.Errorf("%w: $%.2f of $%.2f spent", ErrLimitExceeded, totals.Cost, l.limits.MaxCost)
+	}
+	return nil
+}
+
+// Totals sums up all calls of the run
+func (l *Ledger) Totals() Totals {
+	var totals Totals
+	for _, record := range l.Records() {
+		totals.add(record)
+	}
+	return totals
+}
+
+// ByOperation sums up the calls of the run per operation
+func (l *Ledger) ByOperation() map[string]Totals {
+	return l.group(func(record Record) string { return record.Operation })
+}
+
+// ByFile sums up the calls of the run per file. Calls that are not about a
+// single file are left out.
+func (l *Ledger) ByFile() map[string]Totals {
+	totals := l.group(func(record Record) string { return record.File })
+	delete(totals, "")
+	return totals
+}
+
+func (l *Ledger) group(key func(Record) string) map[string]Totals {
+	groups := make(map[string]Totals)
+	for _, record := range l.Records() {
+		totals := groups[key(record)]
+		totals.add(record)
+		groups[key(record)] = totals
+	}
+	return groups
+}
+
+// Records returns a copy of all calls of the run in order
+func (l *Ledger) Records() []Record {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Record(nil), l.records...)
+}
+
+// SortedKeys returns the keys of grouped totals in order
+func SortedKeys(groups map[string]Totals) []string {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
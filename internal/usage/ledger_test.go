@@ -0,0 +1,87 @@
+package usage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedger_RecordPricesCalls(t *testing.T) {
+	ledger := NewLedger(map[string]Price{"gpt-4": {Input: 30, Output: 60}}, Limits{})
+
+	record := ledger.Record(Record{Operation: "resolve_conflict", File: "a.c", Model: "gpt-4", InputTokens: 1000, OutputTokens: 500})
+	assert.InDelta(t, 0.06, record.Cost, 1e-9)
+
+	// Models without a price are counted but free
+	record = ledger.Record(Record{Operation: "commit_message", Model: "llama3", InputTokens: 100, OutputTokens: 10})
+	assert.Zero(t, record.Cost)
+
+	totals := ledger.Totals()
+	assert.Equal(t, 2, totals.Calls)
+	assert.Equal(t, 1610, totals.Tokens())
+	assert.InDelta(t, 0.06, totals.Cost, 1e-9)
+}
+
+func TestLedger_RecordPricesCacheTokens(t *testing.T) {
+	ledger := NewLedger(map[string]Price{
+		"claude-sonnet-4-5": {Input: 3, Output: 15},
+		"claude-opus-4-1":   {Input: 15, Output: 75, CacheRead: 1, CacheWrite: 20},
+	}, Limits{})
+
+	// 1000 uncached, 8000 read from and 1000 written to the cache
+	record := ledger.Record(Record{Model: "claude-sonnet-4-5", InputTokens: 10000, OutputTokens: 100, CacheReadTokens: 8000, CacheWriteTokens: 1000})
+	assert.InDelta(t, (1000*3+8000*0.3+1000*3.75+100*15)/1e6, record.Cost, 1e-9)
+
+	record = ledger.Record(Record{Model: "claude-opus-4-1", InputTokens: 10000, CacheReadTokens: 8000, CacheWriteTokens: 1000})
+	assert.InDelta(t, (1000*15+8000*1+1000*20)/1e6, record.Cost, 1e-9)
+
+	totals := ledger.Totals()
+	assert.Equal(t, 20000, totals.InputTokens)
+	assert.Equal(t, 16000, totals.CacheReadTokens)
+	assert.Equal(t, 2000, totals.CacheWriteTokens)
+}
+
+func TestLedger_Groups(t *testing.T) {
+	ledger := NewLedger(nil, Limits{})
+	ledger.Record(Record{Operation: "resolve_conflict", File: "a.c", InputTokens: 10})
+	ledger.Record(Record{Operation: "resolve_conflict", File: "b.c", InputTokens: 20})
+	ledger.Record(Record{Operation: "resolve_conflict", File: "a.c", InputTokens: 30})
+	ledger.Record(Record{Operation: "pr_description", InputTokens: 40})
+
+	byOperation := ledger.ByOperation()
+	assert.Equal(t, []string{"pr_description", "resolve_conflict"}, SortedKeys(byOperation))
+	assert.Equal(t, 3, byOperation["resolve_conflict"].Calls)
+
+	byFile := ledger.ByFile()
+	assert.Equal(t, []string{"a.c", "b.c"}, SortedKeys(byFile))
+	assert.Equal(t, 40, byFile["a.c"].InputTokens)
+}
+
+func TestLedger_Limits(t *testing.T) {
+	ledger := NewLedger(map[string]Price{"gpt-4": {Input: 1000000}}, Limits{MaxTokens: 100})
+	require.NoError(t, ledger.Check())
+
+	ledger.Record(Record{Model: "llama3", InputTokens: 60, OutputTokens: 40})
+	assert.ErrorIs(t, ledger.Check(), ErrLimitExceeded)
+
+	ledger = NewLedger(map[string]Price{"gpt-4": {Input: 1000000}}, Limits{MaxCost: 2})
+	ledger.Record(Record{Model: "gpt-4", InputTokens: 1})
+	require.NoError(t, ledger.Check())
+	ledger.Record(Record{Model: "gpt-4", InputTokens: 1})
+	assert.ErrorContains(t, ledger.Check(), "$2.00 of $2.00 spent")
+
+	ledger.Reset()
+	assert.NoError(t, ledger.Check())
+	assert.Zero(t, ledger.Totals().Calls)
+}
+
+func TestLedger_Nil(t *testing.T) {
+	var ledger *Ledger
+	ledger.Record(Record{InputTokens: 10})
+	ledger.Reset()
+
+	assert.NoError(t, ledger.Check())
+	assert.Zero(t, ledger.Totals())
+	assert.Empty(t, ledger.ByOperation())
+}
@@ -0,0 +1,88 @@
+package validate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// syntaxTimeout bounds a single syntax check
+const syntaxTimeout = 30 * time.Second
+
+// syntaxCheck runs an external tool on a file. args receives the path of a
+// temporary copy of the content.
+type syntaxCheck struct {
+	tool string
+	args func(path string) []string
+}
+
+var syntaxChecks = map[string]syntaxCheck{
+	".go": {"gofmt", func(path string) []string { return []string{"-l", "-e", path} }},
+	".py": {"python3", func(path string) []string { return []string{"-m", "py_compile", path} }},
+	".dts": {"dtc", func(path string) []string {
+		return []string{"-q", "-I", "dts", "-O", "dtb", "-o", os.DevNull, path}
+	}},
+	".c": {"cpp", func(path string) []string { return []string{"-MM", "-MG", "-o", os.DevNull, path} }},
+	".h": {"cpp", func(path string) []string { return []string{"-MM", "-MG", "-o", os.DevNull, path} }},
+}
+
+func init() {
+	syntaxChecks[".dtsi"] = syntaxChecks[".dts"]
+}
+
+// HasSyntaxCheck reports whether a syntax check exists for file and its tool
+// is installed
+func HasSyntaxCheck(file string) bool {
+	check, ok := syntaxChecks[strings.ToLower(filepath.Ext(file))]
+	if !ok {
+		return false
+	}
+	_, err := exec.LookPath(check.tool)
+	return err == nil
+}
+
+// Syntax parses content with a language specific tool chosen by the extension
+// of file: gofmt for Go, py_compile for Python, dtc for device trees and the C
+// preprocessor for C sources and headers. Files without a check, or whose tool
+// is not installed, pass.
+func Syntax(ctx context.Context, file, content string) error {
+	if !HasSyntaxCheck(file) {
+		return nil
+	}
+	check := syntaxChecks[strings.ToLower(filepath.Ext(file))]
+
+	tempDir, err := os.MkdirTemp("", "rebaiser-syntax-*")
+	if err != nil {
+		return fmt.Errorf("failed to create syntax check directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, filepath.Base(file))
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write syntax check input: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, syntaxTimeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, check.tool, check.args(path)...)
+	cmd.Dir = tempDir
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		// Report the messages relative to the file, not the temporary copy
+		message := strings.ReplaceAll(strings.TrimSpace(output.String()), path, file)
+		if _, ok := err.(*exec.ExitError); !ok || message == "" {
+			message = err.Error()
+		}
+		return fmt.Errorf("%s reports: %s", check.tool, message)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package validate checks AI generated conflict resolutions before they are
+// written into the repository.
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// fence matches a markdown code fence line, optionally naming a language
+var fence = regexp.MustCompile("^\\s*```[\\w+.-]*\\s*$")
+
+// preamble matches chatty introductions such as "Here is the resolved file:"
+var preamble = regexp.MustCompile(`(?i)^\s*(here('s| is| are)|sure|certainly|below is)\b.*:\s*$`)
+
+// Clean strips a markdown code fence and a preamble line that a model may wrap
+// around a resolution despite being asked not to. Content that is not wrapped
+// is returned unchanged.
+func Clean(output string) string {
+	lines := strings.Split(output, "\n")
+
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	if start < len(lines) && preamble.MatchString(lines[start]) {
+		// Only drop the preamble if a fence follows, a colon at the end of
+		// the first line of real code is not unusual
+		next := start + 1
+		for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+			next++
+		}
+		if next < len(lines) && fence.MatchString(lines[next]) {
+			start = next
+		}
+	}
+
+	if start >= len(lines) || !fence.MatchString(lines[start]) {
+		return output
+	}
+
+	end := len(lines) - 1
+	for end > start && strings.TrimSpace(lines[end]) == "" {
+		end--
+	}
+	if end == start || !fence.MatchString(lines[end]) {
+		return output
+	}
+
+	cleaned := strings.Join(lines[start+1:end], "\n")
+	if strings.HasSuffix(output, "\n") && cleaned != "" {
+		cleaned += "\n"
+	}
+	return cleaned
+}
+
+// Markers returns an error if content still contains conflict markers of the
+// given size. Separator lines are not reported since "=======" is also used
+// as an underline in plain text.
+func Markers(content string, size int) error {
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		for _, marker := range []string{"<", "|", ">"} {
+			prefix := strings.Repeat(marker, size)
+			if line == prefix || strings.HasPrefix(line, prefix+" ") {
+				return fmt.Errorf("line %d still contains the conflict marker %q", i+1, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// minSideLength is the size below which sides are too small to tell whether a
+// resolution lost content
+const minSideLength = 200
+
+// Size returns an error if a resolution is implausibly short or long for the
+// two sides it merges. A resolution much shorter than both sides usually means
+// the output was cut off, one much longer than both sides together means the
+// model added content that was never there.
+func Size(resolution, ours, theirs string) error {
+	shorter := len(ours)
+	if len(theirs) < shorter {
+		shorter = len(theirs)
+	}
+	if shorter >= minSideLength && len(resolution) < shorter/2 {
+		return fmt.Errorf("resolution has %d bytes, less than half of the smaller side (%d bytes)", len(resolution), shorter)
+	}
+
+	limit := 2*(len(ours)+len(theirs)) + minSideLength
+	if len(resolution) > limit {
+		return fmt.Errorf("resolution has %d bytes, more than twice both sides together (%d bytes)", len(resolution), len(ours)+len(theirs))
+	}
+
+	return nil
+}
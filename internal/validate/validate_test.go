@@ -0,0 +1,78 @@
+package validate
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"plain", "int a;\nint b;\n", "int a;\nint b;\n"},
+		{"fence", "```\nint a;\n```", "int a;"},
+		{"fence with language", "```c\nint a;\nint b;\n```\n", "int a;\nint b;\n"},
+		{"preamble and fence", "Here is the resolved file:\n\n```go\npackage main\n```", "package main"},
+		{"preamble without fence is kept", "Here is a label:\nint a;", "Here is a label:\nint a;"},
+		{"unterminated fence is kept", "```\nint a;", "```\nint a;"},
+		{"inner fences are kept", "# Docs\n```\nexample\n```\nmore", "# Docs\n```\nexample\n```\nmore"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Clean(tt.output))
+		})
+	}
+}
+
+func TestMarkers(t *testing.T) {
+	assert.NoError(t, Markers("int a;\n=======\nTitle\n", 7))
+	assert.NoError(t, Markers("<<<<<<<< longer marker\n", 7))
+
+	err := Markers("int a;\n<<<<<<< HEAD\nint b;\n", 7)
+	assert.ErrorContains(t, err, "line 2")
+
+	assert.Error(t, Markers(">>>>>>> 1a2b3c (patch)\r\n", 7))
+	assert.Error(t, Markers("|||||||\n", 7))
+}
+
+func TestSize(t *testing.T) {
+	side := strings.Repeat("x", 400)
+
+	assert.NoError(t, Size(side, side, side))
+	assert.NoError(t, Size("", "short", "sides"))
+	// One side deleting the region makes an empty resolution plausible
+	assert.NoError(t, Size("", side, ""))
+
+	assert.ErrorContains(t, Size(side[:100], side, side), "less than half")
+	assert.ErrorContains(t, Size(strings.Repeat(side, 5), side, side), "more than twice")
+}
+
+func TestSyntax(t *testing.T) {
+	ctx := context.Background()
+
+	assert.NoError(t, Syntax(ctx, "README.md", "<<<<<<< anything goes"))
+
+	if !HasSyntaxCheck("main.go") {
+		t.Skip("gofmt is not installed")
+	}
+	assert.NoError(t, Syntax(ctx, "cmd/main.go", "package main\n\nfunc main() {}\n"))
+
+	err := Syntax(ctx, "cmd/main.go", "package main\n\nfunc main() {\n")
+	assert.ErrorContains(t, err, "cmd/main.go")
+}
+
+func TestSyntax_CPreprocessor(t *testing.T) {
+	if !HasSyntaxCheck("gpio.c") {
+		t.Skip("cpp is not installed")
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, Syntax(ctx, "src/gpio.c", "#include <missing.h>\n#if CONFIG_X\nint a;\n#endif\n"))
+	assert.Error(t, Syntax(ctx, "src/gpio.c", "#if CONFIG_X\nint a;\n"))
+}
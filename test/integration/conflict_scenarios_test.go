@@ -106,8 +106,9 @@ func testConflictScenario(t *testing.T, setupFunc func(t *testing.T, upstream, i
 		t.Logf("Resolving conflict in: %s", conflict.File)
 		
 		// Use AI to resolve
-		resolution, err := aiService.ResolveConflict(ctx, conflict)
+		result, err := aiService.ResolveConflict(ctx, conflict)
 		require.NoError(t, err)
+		resolution := result.Resolution
 		
 		// Validate the resolution
 		validateFunc(t, resolution, conflict)
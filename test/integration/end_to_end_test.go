@@ -430,8 +430,9 @@ func testCompleteWorkflow(t *testing.T, scenario *TestScenario, apiKey string) {
 		t.Logf("Resolving conflict %d/%d: %s", i+1, len(conflicts), conflict.File)
 		
 		// Resolve with AI
-		resolution, err := aiService.ResolveConflict(ctx, conflict)
+		result, err := aiService.ResolveConflict(ctx, conflict)
 		require.NoError(t, err)
+		resolution := result.Resolution
 		
 		// Validate resolution
 		assert.NotContains(t, resolution, "<<<<<<< HEAD")
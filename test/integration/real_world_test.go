@@ -318,8 +318,9 @@ func testFullRebaseWorkflow(t *testing.T, upstreamDir, internalDir, workDir stri
 		assert.NotEmpty(t, conflict.Theirs, "Their version should not be empty")
 		
 		// Use AI to resolve the conflict
-		resolution, err := aiService.ResolveConflict(ctx, conflict)
+		result, err := aiService.ResolveConflict(ctx, conflict)
 		require.NoError(t, err, "AI should be able to resolve conflict")
+		resolution := result.Resolution
 		assert.NotEmpty(t, resolution, "Resolution should not be empty")
 		
 		// Verify resolution doesn't contain conflict markers